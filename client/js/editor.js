@@ -41,12 +41,48 @@ batch. The output of your pipeline will be printed in this window.
 </p>
 
 <p>
-Is your config ugly or incomplete? Click 'Normalise' to have Benthos format it.
+Add more named datasets from the input tab, such as malformed or empty inputs,
+and execute them all at once by clicking 'Run All'.
+</p>
+
+<p>
+Is your config ugly or incomplete? Click 'Normalise' to have Benthos format it,
+the settings tab chooses whether every field is written or only those that
+differ from their defaults, and whether it's written as YAML or JSON.
+</p>
+
+<p>
+Place the cursor within a component and use 'Refactor at cursor' in order to
+remove it, move it, change its type or wrap it within another processor.
+</p>
+
+<p>
+Still using deprecated processors such as <code>text</code> or
+<code>filter_parts</code>? Click 'Upgrade' to rewrite them as Bloblang, the
+changes are printed here along with anything that couldn't be upgraded.
 </p>
 
 <p>
 Some components might not work within the sandbox of your browser, but you can
-still write and share configs that use them.
+still write and share configs that use them. Enable the sandbox from the
+settings tab in order to see what those outputs would have received.
+</p>
+
+<p>
+Configs are interpolated with the environment variables of the settings tab,
+such as <code>\${KAFKA_TOPIC:default}</code>, and 'Preview' shows the values
+that each variable resolves to.
+</p>
+
+<p>
+HTTP requests made by your pipeline are printed as they happen, and can be
+served canned responses by adding HTTP mocks from the settings tab.
+</p>
+
+<p>
+Components that read files, such as lookup tables, can be given files from the
+files tab. Files written by your pipeline are listed after each execution with
+links to download them.
 </p>`;
 
     var aboutContent3 = document.createElement("div");
@@ -76,56 +112,335 @@ For more information about Benthos check out the website at
         onchange(settingField);
     }
 
-    var configTab, inputTab, settingsTab;
+    var configTab, inputTab, filesTab, settingsTab;
 
     var openConfig = function () {
         if (benthosLab.addProcessor !== undefined) {
             document.getElementById("addComponentWindow").classList.remove("hidden");
         }
+        document.getElementById("datasetWindow").classList.add("hidden");
+        document.getElementById("fileWindow").classList.add("hidden");
         document.getElementById("editor").classList.remove("hidden");
         document.getElementById("settings").classList.add("hidden");
         configTab.classList.add("openTab");
         inputTab.classList.remove("openTab");
+        filesTab.classList.remove("openTab");
         settingsTab.classList.remove("openTab");
         editor.setSession(configSession);
     };
 
     var openInput = function () {
         document.getElementById("addComponentWindow").classList.add("hidden");
+        document.getElementById("datasetWindow").classList.remove("hidden");
+        document.getElementById("fileWindow").classList.add("hidden");
         document.getElementById("editor").classList.remove("hidden");
         document.getElementById("settings").classList.add("hidden");
         configTab.classList.remove("openTab");
         inputTab.classList.add("openTab");
+        filesTab.classList.remove("openTab");
         settingsTab.classList.remove("openTab");
         editor.setSession(inputSession);
     };
 
+    var openFiles = function () {
+        document.getElementById("addComponentWindow").classList.add("hidden");
+        document.getElementById("datasetWindow").classList.add("hidden");
+        document.getElementById("fileWindow").classList.remove("hidden");
+        document.getElementById("editor").classList.remove("hidden");
+        document.getElementById("settings").classList.add("hidden");
+        configTab.classList.remove("openTab");
+        inputTab.classList.remove("openTab");
+        filesTab.classList.add("openTab");
+        settingsTab.classList.remove("openTab");
+        editor.setSession(filesSession);
+    };
+
     var openSettings = function () {
         document.getElementById("addComponentWindow").classList.add("hidden");
+        document.getElementById("datasetWindow").classList.add("hidden");
+        document.getElementById("fileWindow").classList.add("hidden");
         document.getElementById("editor").classList.add("hidden");
         document.getElementById("settings").classList.remove("hidden");
         configTab.classList.remove("openTab");
         inputTab.classList.remove("openTab");
+        filesTab.classList.remove("openTab");
         settingsTab.classList.add("openTab");
     };
 
     var initTabs = function () {
         configTab = document.getElementById("configTab");
         inputTab = document.getElementById("inputTab");
+        filesTab = document.getElementById("filesTab");
         settingsTab = document.getElementById("settingsTab");
         configTab.classList.add("openTab");
 
         configTab.onclick = openConfig;
         inputTab.onclick = openInput;
+        filesTab.onclick = openFiles;
         settingsTab.onclick = openSettings;
 
         if (window.location.hash === "#input") {
             openInput();
+        } else if (window.location.hash === "#files") {
+            openFiles();
         }
     };
 
     let inputMethod = "batches";
 
+    // Whether normalising writes every field, or only those that differ from
+    // their defaults, whether deprecated fields are kept and the format.
+    let normaliseOptions = { mode: "standard", deprecated: "keep", format: "yaml" };
+
+    // Each dataset is a named input with its own input method and optionally
+    // the name of a benthos_lab input to target, the input editor always holds
+    // the selected dataset.
+    var datasets = [];
+    var activeDataset = 0;
+
+    var saveDataset = function () {
+        if (datasets.length > 0) {
+            datasets[activeDataset].input = inputSession.getValue();
+            datasets[activeDataset].method = inputMethod;
+            datasets[activeDataset].target = document.getElementById("datasetTargetInput").value;
+        }
+    };
+
+    var loadDataset = function (index) {
+        activeDataset = index;
+        inputSession.setValue(datasets[index].input);
+        inputMethod = datasets[index].method;
+        sessionSettings["inputMethodSelect"] = inputMethod;
+        document.getElementById("inputMethodSelect").value = inputMethod;
+        document.getElementById("datasetSelect").value = String(index);
+        document.getElementById("datasetTargetInput").value = datasets[index].target || "";
+    };
+
+    var selectDataset = function (index) {
+        saveDataset();
+        loadDataset(index);
+    };
+
+    var populateDatasetSelect = function () {
+        let s = document.getElementById("datasetSelect");
+        while (s.options.length > 0) {
+            s.remove(0);
+        }
+        datasets.forEach(function (d, i) {
+            let opt = document.createElement("option");
+            opt.text = d.name;
+            opt.value = String(i);
+            s.add(opt);
+        });
+        s.value = String(activeDataset);
+    };
+
+    var getDatasets = function () {
+        saveDataset();
+        return datasets;
+    };
+
+    var initDatasets = function () {
+        if (Array.isArray(model.datasets) && model.datasets.length > 0) {
+            datasets = model.datasets;
+        } else {
+            datasets = [{ name: "default", method: inputMethod, input: model.input }];
+        }
+        populateDatasetSelect();
+        loadDataset(0);
+
+        document.getElementById("datasetSelect").onchange = function (e) {
+            selectDataset(parseInt(e.target.value, 10));
+        };
+        document.getElementById("addDatasetBtn").onclick = function () {
+            let name = window.prompt("Dataset name:");
+            if (typeof (name) !== "string" || name.length === 0) {
+                return;
+            }
+            if (datasets.some(function (d) { return d.name === name; })) {
+                writeOutput("Error: A dataset named '" + name + "' already exists.\n", "errorMessage");
+                return;
+            }
+            datasets.push({ name: name, method: inputMethod, input: "", target: "" });
+            populateDatasetSelect();
+            selectDataset(datasets.length - 1);
+        };
+        document.getElementById("removeDatasetBtn").onclick = function () {
+            if (datasets.length < 2) {
+                writeOutput("Error: The last dataset cannot be removed.\n", "errorMessage");
+                return;
+            }
+            datasets.splice(activeDataset, 1);
+            populateDatasetSelect();
+            loadDataset(Math.min(activeDataset, datasets.length - 1));
+        };
+    };
+
+    // Files are seeded into the filesystem of the runtime each time a config is
+    // compiled, the files editor always holds the selected file. Binary files
+    // are kept as base64 and can't be edited.
+    var files = [];
+    var activeFile = 0;
+
+    var saveFile = function () {
+        if (files.length > 0 && files[activeFile].base64 === undefined) {
+            files[activeFile].content = filesSession.getValue();
+        }
+    };
+
+    var loadFile = function (index) {
+        activeFile = index;
+        if (files.length === 0) {
+            filesSession.setValue("");
+        } else if (files[index].base64 !== undefined) {
+            filesSession.setValue("Binary file, " + atob(files[index].base64).length + " bytes.");
+        } else {
+            filesSession.setValue(files[index].content);
+        }
+        editor.setReadOnly(files.length === 0 || files[index].base64 !== undefined);
+        document.getElementById("fileSelect").value = String(index);
+    };
+
+    var selectFile = function (index) {
+        saveFile();
+        loadFile(index);
+    };
+
+    var populateFileSelect = function () {
+        let s = document.getElementById("fileSelect");
+        while (s.options.length > 0) {
+            s.remove(0);
+        }
+        if (files.length === 0) {
+            let opt = document.createElement("option");
+            opt.text = "No files";
+            opt.value = "0";
+            s.add(opt);
+        }
+        files.forEach(function (f, i) {
+            let opt = document.createElement("option");
+            opt.text = f.path;
+            opt.value = String(i);
+            s.add(opt);
+        });
+        s.value = String(activeFile);
+    };
+
+    var getFixtures = function () {
+        saveFile();
+        return files;
+    };
+
+    var addFile = function (file) {
+        let existing = files.findIndex(function (f) { return f.path === file.path; });
+        if (existing >= 0) {
+            files[existing] = file;
+        } else {
+            files.push(file);
+            existing = files.length - 1;
+        }
+        populateFileSelect();
+        loadFile(existing);
+    };
+
+    var initFiles = function () {
+        if (Array.isArray(model.files)) {
+            files = model.files;
+        }
+        populateFileSelect();
+
+        // The read only state of the editor only applies to the files tab.
+        editor.on("changeSession", function (e) {
+            if (e.session === filesSession) {
+                loadFile(activeFile);
+            } else {
+                editor.setReadOnly(false);
+            }
+        });
+
+        document.getElementById("fileSelect").onchange = function (e) {
+            selectFile(parseInt(e.target.value, 10));
+        };
+        document.getElementById("addFileBtn").onclick = function () {
+            let path = window.prompt("File path:");
+            if (typeof (path) !== "string" || path.length === 0) {
+                return;
+            }
+            saveFile();
+            addFile({ path: path, content: "" });
+        };
+        let uploadInput = document.getElementById("uploadFileInput");
+        document.getElementById("uploadFileBtn").onclick = function () {
+            uploadInput.click();
+        };
+        uploadInput.onchange = function () {
+            let upload = uploadInput.files[0];
+            if (upload === undefined) {
+                return;
+            }
+            let path = window.prompt("File path:", "/" + upload.name);
+            if (typeof (path) !== "string" || path.length === 0) {
+                return;
+            }
+            let reader = new FileReader();
+            reader.onload = function () {
+                let bytes = new Uint8Array(reader.result);
+                saveFile();
+                try {
+                    addFile({ path: path, content: new TextDecoder("utf-8", { fatal: true }).decode(bytes) });
+                } catch (e) {
+                    let binary = "";
+                    bytes.forEach(function (b) {
+                        binary += String.fromCharCode(b);
+                    });
+                    addFile({ path: path, base64: btoa(binary) });
+                }
+            };
+            reader.readAsArrayBuffer(upload);
+            uploadInput.value = "";
+        };
+        document.getElementById("removeFileBtn").onclick = function () {
+            if (files.length === 0) {
+                return;
+            }
+            files.splice(activeFile, 1);
+            activeFile = Math.max(0, Math.min(activeFile, files.length - 1));
+            populateFileSelect();
+            loadFile(activeFile);
+        };
+    };
+
+    // writeFileLinks lists the files written by a pipeline with links to
+    // download them.
+    var writeFileLinks = function () {
+        if (benthosLab.getFiles === undefined) {
+            return;
+        }
+        let written = (benthosLab.getFiles() || []).filter(function (f) { return f.written; });
+        if (written.length === 0) {
+            return;
+        }
+        let div = document.createElement("div");
+        let span = document.createElement("span");
+        span.innerText = "Files written:";
+        span.classList.add("infoMessage");
+        div.appendChild(span);
+        written.forEach(function (f) {
+            let data = f.content;
+            if (f.base64 !== undefined) {
+                data = Uint8Array.from(atob(f.base64), function (c) { return c.charCodeAt(0); });
+            }
+            let a = document.createElement("a");
+            a.href = URL.createObjectURL(new Blob([data]));
+            a.download = f.path.split("/").pop();
+            a.innerText = f.path + " (" + f.size + " bytes)";
+            let line = document.createElement("div");
+            line.appendChild(a);
+            div.appendChild(line);
+        });
+        writeOutputElement(div);
+    };
+
     window.onload = function () {
         if (typeof (model.settings) === "object" && model.settings !== null) {
             sessionSettings = model.settings;
@@ -136,6 +451,19 @@ For more information about Benthos check out the website at
         useSessionSetting("inputMethodSelect", inputMethod, function (e) {
             inputMethod = e.value;
         });
+        useSessionSetting("normaliseModeSelect", normaliseOptions.mode, function (e) {
+            normaliseOptions.mode = e.value;
+        });
+        useSessionSetting("normaliseDeprecatedSelect", normaliseOptions.deprecated, function (e) {
+            normaliseOptions.deprecated = e.value;
+        });
+        useSessionSetting("normaliseFormatSelect", normaliseOptions.format, function (e) {
+            normaliseOptions.format = e.value;
+        });
+        initDatasets();
+        initHTTPMocks();
+        initEnv();
+        initFiles();
 
         let setWelcomeText = function () {
             writeOutputElement(aboutContent);
@@ -152,7 +480,7 @@ For more information about Benthos check out the website at
         document.getElementById("normaliseBtn").onclick = function () {
             benthosLab.normalise(getConfig(), function (conf) {
                 setConfig(conf);
-            });
+            }, normaliseOptions);
         };
 
         var expandAddCompBtn = document.getElementById("expandAddComponentSelects");
@@ -225,11 +553,27 @@ For more information about Benthos check out the website at
                 writeOutput("Error: Request failed with status: " + xhr.status + "\n", "errorMessage");
             }
         };
-        xhr.send(JSON.stringify({
+        let state = {
             input: input,
             config: config,
             settings: sessionSettings
-        }));
+        };
+        let sets = getDatasets();
+        if (sets.length > 1 || sets[0].target) {
+            state.input = sets[0].input;
+            state.datasets = sets;
+        }
+        if (httpMocks.length > 0) {
+            state.http_mocks = httpMocks;
+        }
+        if (Object.keys(env).length > 0) {
+            state.env = env;
+        }
+        let fixtures = getFixtures();
+        if (fixtures.length > 0) {
+            state.files = fixtures;
+        }
+        xhr.send(JSON.stringify(state));
     };
 
     var getNews = function (success) {
@@ -243,9 +587,10 @@ For more information about Benthos check out the website at
         xhr.send();
     };
 
-    var normaliseViaAPI = function (config, success) {
+    var normaliseViaAPI = function (config, success, options) {
+        var query = new URLSearchParams(options || {});
         var xhr = new XMLHttpRequest();
-        xhr.open('POST', '/normalise');
+        xhr.open('POST', '/normalise?' + query.toString());
         xhr.setRequestHeader('Content-Type', 'text/yaml');
         xhr.onload = function () {
             if (xhr.status === 200) {
@@ -296,6 +641,162 @@ For more information about Benthos check out the website at
         });
     };
 
+    // HTTP mocks are edited as JSON and saved with the lab session.
+    var httpMocks = Array.isArray(model.http_mocks) ? model.http_mocks : [];
+
+    var initHTTPMocks = function () {
+        let text = document.getElementById("httpMocksText");
+        if (httpMocks.length > 0) {
+            text.value = JSON.stringify(httpMocks, null, 2);
+        }
+        text.onchange = function () {
+            let mocks = [];
+            if (text.value.trim().length > 0) {
+                try {
+                    mocks = JSON.parse(text.value);
+                } catch (e) {
+                    writeOutput("Error: Failed to parse HTTP mocks: " + e + "\n", "errorMessage");
+                    return;
+                }
+            }
+            if (!Array.isArray(mocks)) {
+                writeOutput("Error: HTTP mocks must be an array\n", "errorMessage");
+                return;
+            }
+            httpMocks = mocks;
+            if (benthosLab.setHttpMocks !== undefined) {
+                benthosLab.setHttpMocks(httpMocks);
+            }
+        };
+    };
+
+    // Refactors act on the innermost component at the cursor of the config.
+    var initRefactorSelect = function () {
+        let s = document.getElementById("refactorSelect");
+        s.addEventListener("change", function () {
+            let action = this.value;
+            this.value = "";
+            if (action === "") {
+                return;
+            }
+            let config = getConfig();
+            let target = benthosLab.componentAt(editor.getCursorPosition().row + 1, config);
+            if (target === undefined || target === null) {
+                writeOutput("Error: There is no component at the cursor\n", "errorMessage");
+                return;
+            }
+            let index = parseInt(target.path.split(".").pop(), 10);
+            let newConfig;
+            switch (action) {
+                case "remove":
+                    newConfig = benthosLab.removeComponent(target.path, config);
+                    break;
+                case "moveUp":
+                case "moveDown":
+                    if (isNaN(index)) {
+                        writeOutput("Error: The " + target.kind + " at the cursor is not within a list\n", "errorMessage");
+                        return;
+                    }
+                    newConfig = benthosLab.moveComponent(target.path, action === "moveUp" ? index - 1 : index + 1, config);
+                    break;
+                case "replace":
+                    let cType = window.prompt("Replace the " + target.kind + " at " + target.path + " with type:");
+                    if (!cType) {
+                        return;
+                    }
+                    newConfig = benthosLab.replaceComponent(target.path, cType, config);
+                    break;
+                default:
+                    newConfig = benthosLab.wrapProcessor(target.path, action, config);
+            }
+            if (typeof (newConfig) === "string") {
+                setConfig(newConfig);
+            }
+        });
+    };
+
+    // Upgrades rewrite deprecated components of the config, the changes are
+    // written to the output as a diff along with anything left as it was.
+    var upgradeConfig = function () {
+        let result = benthosLab.upgradeConfig(getConfig());
+        if (result === undefined || result === null) {
+            return;
+        }
+        if (result.upgrades.length === 0) {
+            writeOutput("The config doesn't contain any deprecated components.\n", "infoMessage");
+            return;
+        }
+        result.diff.forEach(function (line) {
+            let style;
+            if (line.startsWith("+")) {
+                style = "infoMessage";
+            } else if (line.startsWith("-")) {
+                style = "errorMessage";
+            }
+            writeOutput(line + "\n", style);
+        });
+        result.upgrades.forEach(function (u) {
+            if (u.upgraded && u.warning) {
+                writeOutput("Upgraded " + u.from + " to " + u.to + " at " + u.path + ", but " + u.warning + "\n", "lintMessage");
+            } else if (u.upgraded) {
+                writeOutput("Upgraded " + u.from + " to " + u.to + " at " + u.path + "\n", "infoMessage");
+            } else {
+                writeOutput("Could not upgrade " + u.from + " at " + u.path + ": " + u.reason + "\n", "lintMessage");
+            }
+        });
+        setConfig(result.config);
+    };
+
+    // Environment variables are edited as KEY=value lines and saved with the
+    // lab session, configs are interpolated with them when compiled.
+    var env = (typeof (model.env) === "object" && model.env !== null) ? model.env : {};
+
+    var initEnv = function () {
+        let text = document.getElementById("envText");
+        text.value = Object.keys(env).map(function (k) {
+            return k + "=" + env[k];
+        }).join("\n");
+        text.addEventListener("change", function () {
+            let parsed = {};
+            let lines = text.value.split("\n");
+            for (let i = 0; i < lines.length; i++) {
+                let line = lines[i].trim();
+                if (line.length === 0 || line.startsWith("#")) {
+                    continue;
+                }
+                let eq = line.indexOf("=");
+                if (eq <= 0) {
+                    writeOutput("Error: Environment variable on line " + (i + 1) + " must be of the form KEY=value\n", "errorMessage");
+                    return;
+                }
+                parsed[line.slice(0, eq).trim()] = line.slice(eq + 1);
+            }
+            env = parsed;
+            if (benthosLab.setEnv !== undefined) {
+                benthosLab.setEnv(env);
+            }
+        });
+    };
+
+    var previewEnv = function () {
+        let preview = benthosLab.getEnv(getConfig());
+        if (preview === undefined || preview === null) {
+            return;
+        }
+        if (preview.variables.length === 0) {
+            writeOutput("The config doesn't reference any environment variables.\n", "infoMessage");
+        }
+        preview.variables.forEach(function (v) {
+            let desc = v.name + " = " + JSON.stringify(v.value);
+            if (!v.set) {
+                desc += v.default !== undefined ? " (not set, using default)" : " (not set, no default)";
+            }
+            desc += (v.lines.length > 1 ? " on lines " : " on line ") + v.lines.join(", ");
+            writeOutput(desc + "\n", v.set || v.default !== undefined ? "infoMessage" : "lintMessage");
+        });
+        writeOutput(preview.config);
+    };
+
     let initLabControls = function () {
         document.getElementById("failedText").classList.add("hidden");
         if (configTab == null || configTab.classList.contains("openTab")) {
@@ -308,15 +809,18 @@ For more information about Benthos check out the website at
         populateInsertSelect(benthosLab.getOutputs(), benthosLab.addOutput, "outputSelect");
         populateInsertSelect(benthosLab.getCaches(), benthosLab.addCache, "cacheSelect");
         populateInsertSelect(benthosLab.getRatelimits(), benthosLab.addRatelimit, "ratelimitSelect");
+        initRefactorSelect();
 
         document.getElementById("normaliseBtn").onclick = function () {
             benthosLab.normalise(getConfig(), function (result) {
                 setConfig(result);
-            });
+            }, normaliseOptions);
         };
+        document.getElementById("upgradeBtn").onclick = upgradeConfig;
 
         var hasCompiled = false;
         var compile = function (onSuccess) {
+            benthosLab.setFiles(getFixtures());
             benthosLab.compile(getConfig(), function () {
                 hasCompiled = true;
                 compileBtn.classList.add("btn-disabled");
@@ -328,26 +832,67 @@ For more information about Benthos check out the website at
             });
         };
 
+        // Datasets that target a named input can only be routed by runAll.
+        let executeActive = function () {
+            let d = getDatasets()[activeDataset];
+            if (d.target) {
+                benthosLab.runAll([d], writeFileLinks);
+            } else {
+                benthosLab.execute(inputMethod, getInput(), writeFileLinks);
+            }
+        };
+
         let executeBtn = document.getElementById("executeBtn");
         executeBtn.onclick = function () {
+            if (!hasCompiled) {
+                compile(executeActive);
+            } else {
+                executeActive();
+            }
+        };
+
+        document.getElementById("runAllBtn").onclick = function () {
             if (!hasCompiled) {
                 compile(function () {
-                    benthosLab.execute(inputMethod, getInput());
+                    benthosLab.runAll(getDatasets(), writeFileLinks);
                 });
             } else {
-                benthosLab.execute(inputMethod, getInput());
+                benthosLab.runAll(getDatasets(), writeFileLinks);
             }
         };
 
         let compileBtn = document.getElementById("compileBtn");
         compileBtn.onclick = compile;
 
-        configSession.on("change", function () {
+        document.getElementById("cancelBtn").onclick = function () {
+            benthosLab.cancel();
+        };
+
+        useSetting("executeTimeoutSelect", function (e) {
+            benthosLab.setTimeouts({ execute: parseInt(e.value, 10) });
+        });
+
+        let requireCompile = function () {
             compileBtn.classList.remove("btn-disabled");
             compileBtn.classList.add("btn-primary");
             compileBtn.disabled = false;
             hasCompiled = false;
-        })
+        };
+        configSession.on("change", requireCompile);
+        filesSession.on("change", requireCompile);
+
+        useSessionSetting("sandboxSelect", "", function (e) {
+            benthosLab.setSandbox({
+                outputs: e.value.length > 0,
+                inputs: e.value === "all"
+            });
+            requireCompile();
+        });
+
+        benthosLab.setHttpMocks(httpMocks);
+        benthosLab.setEnv(env);
+        document.getElementById("envText").addEventListener("change", requireCompile);
+        document.getElementById("envPreviewBtn").onclick = previewEnv;
 
         writeOutput("Running Benthos version: " + benthosLab.version + "\n", "infoMessage");
     };
@@ -0,0 +1,423 @@
+// An in-memory filesystem implementing the subset of the Node.js fs API that
+// the Go runtime calls, which gives file based components somewhere to read
+// from and write to within the browser. It must be loaded before wasm_exec.js,
+// and is installed as the global fs unless one already exists. Writes to
+// stdout and stderr are given to an output function, which defaults to the
+// console.
+
+(function () {
+    "use strict";
+
+    const constants = {
+        O_RDONLY: 0,
+        O_WRONLY: 1,
+        O_RDWR: 2,
+        O_CREAT: 64,
+        O_EXCL: 128,
+        O_TRUNC: 512,
+        O_APPEND: 1024,
+        O_DIRECTORY: 65536,
+    };
+
+    const S_IFCHR = 0o020000;
+    const S_IFDIR = 0o040000;
+    const S_IFREG = 0o100000;
+
+    const fsError = function (code, path) {
+        const err = new Error(code + ": " + path);
+        err.code = code;
+        return err;
+    };
+
+    // Paths are resolved from the root as there is no working directory.
+    const normalise = function (path) {
+        const parts = [];
+        String(path).split("/").forEach(function (p) {
+            if (p === "" || p === ".") {
+                return;
+            }
+            if (p === "..") {
+                parts.pop();
+                return;
+            }
+            parts.push(p);
+        });
+        return "/" + parts.join("/");
+    };
+
+    const parentOf = function (path) {
+        const i = path.lastIndexOf("/");
+        return i <= 0 ? "/" : path.slice(0, i);
+    };
+
+    let nextIno = 1;
+    const newNode = function (dir, mode) {
+        const now = Date.now();
+        return {
+            dir: dir,
+            mode: mode & 0o777,
+            data: new Uint8Array(0),
+            ino: nextIno++,
+            atimeMs: now,
+            mtimeMs: now,
+            ctimeMs: now,
+        };
+    };
+
+    const touch = function (node) {
+        node.mtimeMs = Date.now();
+        node.ctimeMs = node.mtimeMs;
+    };
+
+    const resize = function (node, length) {
+        const data = new Uint8Array(length);
+        data.set(node.data.subarray(0, Math.min(length, node.data.length)));
+        node.data = data;
+        touch(node);
+    };
+
+    const statOf = function (node) {
+        const size = node.dir ? 0 : node.data.length;
+        return {
+            dev: 0,
+            ino: node.ino,
+            mode: (node.dir ? S_IFDIR : S_IFREG) | node.mode,
+            nlink: 1,
+            uid: 0,
+            gid: 0,
+            rdev: 0,
+            size: size,
+            blksize: 4096,
+            blocks: Math.ceil(size / 512),
+            atimeMs: node.atimeMs,
+            mtimeMs: node.mtimeMs,
+            ctimeMs: node.ctimeMs,
+            isDirectory() {
+                return node.dir;
+            },
+        };
+    };
+
+    const stdio = statOf({ dir: false, mode: 0o666, data: new Uint8Array(0), ino: 0, atimeMs: 0, mtimeMs: 0, ctimeMs: 0 });
+    stdio.mode = S_IFCHR | 0o666;
+
+    const nodes = new Map([["/", newNode(true, 0o755)]]);
+    const fds = new Map();
+    let nextFD = 3;
+
+    const children = function (path) {
+        const names = [];
+        nodes.forEach(function (_, p) {
+            if (p !== "/" && parentOf(p) === path) {
+                names.push(p.slice(path === "/" ? 1 : path.length + 1));
+            }
+        });
+        return names.sort();
+    };
+
+    const withNode = function (path, callback, fn) {
+        path = normalise(path);
+        const node = nodes.get(path);
+        if (node === undefined) {
+            callback(fsError("ENOENT", path));
+            return;
+        }
+        fn(node, path);
+    };
+
+    const withFD = function (fd, callback, fn) {
+        const f = fds.get(fd);
+        if (f === undefined) {
+            callback(fsError("EBADF", fd));
+            return;
+        }
+        fn(f);
+    };
+
+    const decoder = new TextDecoder("utf-8");
+    let outputBuf = "";
+    let output = function (fd, buf) {
+        outputBuf += decoder.decode(buf);
+        const nl = outputBuf.lastIndexOf("\n");
+        if (nl != -1) {
+            console.log(outputBuf.substr(0, nl));
+            outputBuf = outputBuf.substr(nl + 1);
+        }
+    };
+
+    const fs = {
+        constants: constants,
+
+        writeSync(fd, buf) {
+            if (fd > 2) {
+                throw fsError("ENOSYS", fd);
+            }
+            output(fd, buf);
+            return buf.length;
+        },
+
+        open(path, flags, mode, callback) {
+            path = normalise(path);
+            let node = nodes.get(path);
+            if (node === undefined) {
+                if (!(flags & constants.O_CREAT)) {
+                    callback(fsError("ENOENT", path));
+                    return;
+                }
+                const parent = nodes.get(parentOf(path));
+                if (parent === undefined || !parent.dir) {
+                    callback(fsError("ENOENT", path));
+                    return;
+                }
+                node = newNode(false, mode);
+                nodes.set(path, node);
+            } else {
+                if ((flags & constants.O_CREAT) && (flags & constants.O_EXCL)) {
+                    callback(fsError("EEXIST", path));
+                    return;
+                }
+                if (node.dir && (flags & (constants.O_WRONLY | constants.O_RDWR))) {
+                    callback(fsError("EISDIR", path));
+                    return;
+                }
+                if (!node.dir && (flags & constants.O_DIRECTORY)) {
+                    callback(fsError("ENOTDIR", path));
+                    return;
+                }
+                if (!node.dir && (flags & constants.O_TRUNC)) {
+                    resize(node, 0);
+                }
+            }
+            const fd = nextFD++;
+            fds.set(fd, { node: node, flags: flags, pos: 0 });
+            callback(null, fd);
+        },
+
+        close(fd, callback) {
+            fds.delete(fd);
+            callback(null);
+        },
+
+        read(fd, buffer, offset, length, position, callback) {
+            withFD(fd, callback, function (f) {
+                if (f.node.dir) {
+                    callback(fsError("EISDIR", fd));
+                    return;
+                }
+                const pos = (position === null || position === undefined) ? f.pos : position;
+                const data = f.node.data;
+                const n = Math.max(0, Math.min(length, data.length - pos));
+                buffer.set(data.subarray(pos, pos + n), offset);
+                if (position === null || position === undefined) {
+                    f.pos += n;
+                }
+                f.node.atimeMs = Date.now();
+                callback(null, n);
+            });
+        },
+
+        write(fd, buffer, offset, length, position, callback) {
+            if (fd <= 2) {
+                output(fd, buffer.subarray(offset, offset + length));
+                callback(null, length);
+                return;
+            }
+            withFD(fd, callback, function (f) {
+                if (!(f.flags & (constants.O_WRONLY | constants.O_RDWR))) {
+                    callback(fsError("EBADF", fd));
+                    return;
+                }
+                const positioned = position !== null && position !== undefined;
+                let pos = positioned ? position : f.pos;
+                if (!positioned && (f.flags & constants.O_APPEND)) {
+                    pos = f.node.data.length;
+                }
+                const end = pos + length;
+                if (end > f.node.data.length) {
+                    resize(f.node, end);
+                }
+                f.node.data.set(buffer.subarray(offset, offset + length), pos);
+                touch(f.node);
+                if (!positioned) {
+                    f.pos = end;
+                }
+                callback(null, length);
+            });
+        },
+
+        fstat(fd, callback) {
+            if (fd <= 2) {
+                callback(null, stdio);
+                return;
+            }
+            withFD(fd, callback, function (f) {
+                callback(null, statOf(f.node));
+            });
+        },
+
+        stat(path, callback) {
+            withNode(path, callback, function (node) {
+                callback(null, statOf(node));
+            });
+        },
+
+        lstat(path, callback) {
+            fs.stat(path, callback);
+        },
+
+        readdir(path, callback) {
+            withNode(path, callback, function (node, path) {
+                if (!node.dir) {
+                    callback(fsError("ENOTDIR", path));
+                    return;
+                }
+                callback(null, children(path));
+            });
+        },
+
+        mkdir(path, perm, callback) {
+            path = normalise(path);
+            if (nodes.has(path)) {
+                callback(fsError("EEXIST", path));
+                return;
+            }
+            const parent = nodes.get(parentOf(path));
+            if (parent === undefined || !parent.dir) {
+                callback(fsError("ENOENT", path));
+                return;
+            }
+            nodes.set(path, newNode(true, perm));
+            callback(null);
+        },
+
+        unlink(path, callback) {
+            withNode(path, callback, function (node, path) {
+                if (node.dir) {
+                    callback(fsError("EISDIR", path));
+                    return;
+                }
+                nodes.delete(path);
+                callback(null);
+            });
+        },
+
+        rmdir(path, callback) {
+            withNode(path, callback, function (node, path) {
+                if (!node.dir) {
+                    callback(fsError("ENOTDIR", path));
+                    return;
+                }
+                if (path === "/") {
+                    callback(fsError("EBUSY", path));
+                    return;
+                }
+                if (children(path).length > 0) {
+                    callback(fsError("ENOTEMPTY", path));
+                    return;
+                }
+                nodes.delete(path);
+                callback(null);
+            });
+        },
+
+        rename(from, to, callback) {
+            withNode(from, callback, function (node, from) {
+                to = normalise(to);
+                const parent = nodes.get(parentOf(to));
+                if (parent === undefined || !parent.dir) {
+                    callback(fsError("ENOENT", to));
+                    return;
+                }
+                const existing = nodes.get(to);
+                if (existing !== undefined && existing.dir && children(to).length > 0) {
+                    callback(fsError("ENOTEMPTY", to));
+                    return;
+                }
+                const moved = [];
+                nodes.forEach(function (n, p) {
+                    if (p === from || p.startsWith(from + "/")) {
+                        moved.push([p, n]);
+                    }
+                });
+                moved.forEach(function (m) {
+                    nodes.delete(m[0]);
+                });
+                moved.forEach(function (m) {
+                    nodes.set(to + m[0].slice(from.length), m[1]);
+                });
+                callback(null);
+            });
+        },
+
+        truncate(path, length, callback) {
+            withNode(path, callback, function (node, path) {
+                if (node.dir) {
+                    callback(fsError("EISDIR", path));
+                    return;
+                }
+                resize(node, length);
+                callback(null);
+            });
+        },
+
+        ftruncate(fd, length, callback) {
+            withFD(fd, callback, function (f) {
+                resize(f.node, length);
+                callback(null);
+            });
+        },
+
+        chmod(path, mode, callback) {
+            withNode(path, callback, function (node) {
+                node.mode = mode & 0o777;
+                callback(null);
+            });
+        },
+
+        fchmod(fd, mode, callback) {
+            withFD(fd, callback, function (f) {
+                f.node.mode = mode & 0o777;
+                callback(null);
+            });
+        },
+
+        utimes(path, atime, mtime, callback) {
+            withNode(path, callback, function (node) {
+                node.atimeMs = atime * 1000;
+                node.mtimeMs = mtime * 1000;
+                callback(null);
+            });
+        },
+
+        chown(path, uid, gid, callback) { callback(null); },
+        fchown(fd, uid, gid, callback) { callback(null); },
+        lchown(path, uid, gid, callback) { callback(null); },
+        fsync(fd, callback) { callback(null); },
+        link(path, link, callback) { callback(fsError("ENOSYS", path)); },
+        symlink(path, link, callback) { callback(fsError("ENOSYS", path)); },
+        readlink(path, callback) { callback(fsError("ENOSYS", path)); },
+    };
+
+    const labFS = {
+        fs: fs,
+
+        // install sets the filesystem as the global fs, with an optional
+        // function that receives writes to stdout and stderr.
+        install(outputFn) {
+            if (typeof (outputFn) === "function") {
+                output = outputFn;
+            }
+            globalThis.fs = fs;
+            globalThis.labFS = labFS;
+        },
+    };
+
+    if (typeof (module) === "object" && module.exports) {
+        module.exports = labFS;
+    } else {
+        globalThis.labFS = labFS;
+        if (!globalThis.fs) {
+            labFS.install();
+        }
+    }
+})();
@@ -0,0 +1,29 @@
+// Runs the Benthos Lab runtime within a Web Worker so that heavy pipelines do
+// not block the editor. Commands are posted as {id, command, args} envelopes
+// and answered with {type: "response", id, result|error}, whilst output, logs
+// and errors are streamed back as typed messages. The runtime announces itself
+// with {type: "ready"}, commands posted before then are queued.
+
+importScripts("/js/labfs.js", "/js/wasm_exec.js");
+
+var benthosLab = {
+    queue: [],
+};
+
+self.onmessage = function (e) {
+    benthosLab.queue.push(e);
+};
+
+if (!WebAssembly.instantiateStreaming) {
+    // polyfill
+    WebAssembly.instantiateStreaming = async (resp, importObject) => {
+        const source = await (await resp).arrayBuffer();
+        return await WebAssembly.instantiate(source, importObject);
+    };
+}
+
+const go = new Go();
+
+WebAssembly.instantiateStreaming(fetch("/wasm/benthos-lab.wasm"), go.importObject).then((result) => {
+    go.run(result.instance);
+});
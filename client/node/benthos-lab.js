@@ -0,0 +1,87 @@
+#!/usr/bin/env node
+
+// Runs the Benthos Lab runtime headless under Node.js. Requests are read from
+// stdin as JSON lines of the form {"id": 1, "command": "compile", "args": []}
+// and every message sent by the runtime, including the responses to requests,
+// is written to stdout as a JSON line. The protocol is the same as the one used
+// when the runtime runs within a Web Worker.
+//
+// usage: node benthos-lab.js [path/to/benthos-lab.wasm]
+//
+// The wasm_exec.js used must match the Go version that built the runtime, it
+// defaults to the one served to browsers and can be set with WASM_EXEC.
+
+"use strict";
+
+const fs = require("fs");
+const path = require("path");
+const readline = require("readline");
+
+// The runtime is given the same in-memory filesystem as it has within a
+// browser. Anything it writes to stdout directly would corrupt the protocol and
+// is therefore sent to stderr instead.
+require(path.join(__dirname, "../js/labfs.js")).install(function (fd, buf) {
+    process.stderr.write(buf);
+});
+
+require(process.env.WASM_EXEC || path.join(__dirname, "../js/wasm_exec.js"));
+
+const wasmPath = process.argv[2] || path.join(__dirname, "../wasm/benthos-lab.wasm");
+
+const outstanding = new Set();
+let inputClosed = false;
+
+const exitIfDone = function () {
+    if (inputClosed && outstanding.size === 0) {
+        process.exit(0);
+    }
+};
+
+globalThis.benthosLab = {
+    headless: true,
+    queue: [],
+};
+
+globalThis.postMessage = function (msg) {
+    process.stdout.write(JSON.stringify(msg) + "\n");
+    if (msg.type === "response") {
+        outstanding.delete(msg.id);
+        exitIfDone();
+    }
+};
+
+const send = function (req) {
+    outstanding.add(req.id);
+    if (typeof (globalThis.onmessage) === "function") {
+        globalThis.onmessage({ data: req });
+    } else {
+        globalThis.benthosLab.queue.push({ data: req });
+    }
+};
+
+const lines = readline.createInterface({ input: process.stdin });
+lines.on("line", function (line) {
+    if (line.trim().length === 0) {
+        return;
+    }
+    let req;
+    try {
+        req = JSON.parse(line);
+    } catch (e) {
+        postMessage({ type: "error", message: "Error: failed to parse request: " + e.message + "\n" });
+        return;
+    }
+    send(req);
+});
+lines.on("close", function () {
+    inputClosed = true;
+    exitIfDone();
+});
+
+const go = new Go();
+WebAssembly.instantiate(fs.readFileSync(wasmPath), go.importObject).then((result) => {
+    go.run(result.instance);
+}).catch((err) => {
+    console.error(err);
+    process.exit(1);
+});
@@ -0,0 +1,215 @@
+#!/usr/bin/env node
+
+// Checks that the headless runner produces the same results as the runtime
+// does when driven through the global functions used by the browser.
+//
+// usage: node parity.js [path/to/benthos-lab.wasm]
+
+"use strict";
+
+const childProcess = require("child_process");
+const fs = require("fs");
+const path = require("path");
+
+const wasmExec = process.env.WASM_EXEC || path.join(__dirname, "../../js/wasm_exec.js");
+const wasmPath = path.resolve(process.argv[2] || path.join(__dirname, "../../wasm/benthos-lab.wasm"));
+
+const cases = [
+    {
+        name: "bloblang messages",
+        config: `pipeline:
+  processors:
+  - bloblang: 'root.doc = this.name.uppercase()'
+`,
+        method: "messages",
+        input: `{"name":"foo"}
+{"name":"bar"}`,
+    },
+    {
+        name: "batches with switch",
+        config: `pipeline:
+  processors:
+  - switch:
+    - check: content().contains("a")
+      processors:
+      - bloblang: 'root = content() + " has a"'
+    - processors:
+      - bloblang: 'root = content() + " has no a"'
+`,
+        method: "batches",
+        input: `bar
+buz
+
+qux`,
+    },
+    {
+        name: "archive to single message",
+        config: `pipeline:
+  processors:
+  - archive:
+      format: lines
+`,
+        method: "message",
+        input: `first
+second`,
+    },
+    {
+        name: "processing errors",
+        config: `pipeline:
+  processors:
+  - bloblang: 'root = this.does.not.exist.number()'
+  - catch:
+    - bloblang: 'root = "caught: " + error()'
+`,
+        method: "messages",
+        input: `{}`,
+    },
+    {
+        name: "invalid config",
+        config: `pipeline:
+  processors:
+  - nope: {}
+`,
+        method: "messages",
+        input: `foo`,
+    },
+];
+
+// Styles of output that should match between runtimes, logs are excluded as
+// they are timing dependent.
+const relevant = function (entry) {
+    return entry.style === "" || entry.style === "errorMessage";
+};
+
+// runBrowser drives the runtime in-process via the global functions, in the
+// same way that the editor does.
+const runBrowser = function () {
+    require(path.join(__dirname, "../../js/labfs.js")).install();
+    require(wasmExec);
+
+    return new Promise((resolve, reject) => {
+        let output = [];
+        globalThis.benthosLab = {
+            print: function (message, style) {
+                output.push({ style: style, message: message });
+            },
+            onLoad: async function () {
+                const results = [];
+                for (const c of cases) {
+                    output = [];
+                    await new Promise((done) => {
+                        // The compile callback is only called on success.
+                        let finished = false;
+                        const finish = () => {
+                            if (!finished) {
+                                finished = true;
+                                done();
+                            }
+                        };
+                        globalThis.benthosLab.compile(c.config, () => {
+                            globalThis.benthosLab.execute(c.method, c.input, finish);
+                        });
+                        const poll = setInterval(() => {
+                            if (output.some((o) => o.style === "errorMessage" && o.message.includes("failed to create pipeline"))) {
+                                clearInterval(poll);
+                                finish();
+                            }
+                            if (finished) {
+                                clearInterval(poll);
+                            }
+                        }, 10);
+                    });
+                    results.push(output.filter(relevant));
+                }
+                resolve(results);
+            },
+        };
+        const go = new Go();
+        WebAssembly.instantiate(fs.readFileSync(wasmPath), go.importObject).then((r) => {
+            go.run(r.instance);
+        }).catch(reject);
+    });
+};
+
+// runHeadless drives the headless runner over stdin and stdout, executing
+// input only after a successful compile like the editor does.
+const runHeadless = function () {
+    const proc = childProcess.spawn(process.execPath, [path.join(__dirname, "../benthos-lab.js"), wasmPath], {
+        env: Object.assign({}, process.env, { WASM_EXEC: wasmExec }),
+        stdio: ["pipe", "pipe", "inherit"],
+    });
+
+    let output = [];
+    const pending = {};
+    let nextID = 0;
+    const call = function (command, ...args) {
+        const id = nextID++;
+        proc.stdin.write(JSON.stringify({ id: id, command: command, args: args }) + "\n");
+        return new Promise((resolve) => {
+            pending[id] = resolve;
+        });
+    };
+
+    let buffered = "";
+    proc.stdout.on("data", (data) => {
+        buffered += data.toString();
+        let lines = buffered.split("\n");
+        buffered = lines.pop();
+        lines.forEach((line) => {
+            const msg = JSON.parse(line);
+            switch (msg.type) {
+                case "response":
+                    pending[msg.id](msg);
+                    delete pending[msg.id];
+                    break;
+                case "output":
+                    output.push({ style: "", message: msg.message });
+                    break;
+                case "error":
+                    output.push({ style: "errorMessage", message: msg.message });
+                    break;
+            }
+        });
+    });
+
+    return (async function () {
+        const results = [];
+        for (const c of cases) {
+            output = [];
+            const compiled = await call("compile", c.config);
+            if (compiled.error) {
+                // Mirrors the formatting of errors reported by compile.
+                output.push({ style: "errorMessage", message: "Error: " + compiled.error + "\n" });
+            } else {
+                const executed = await call("execute", c.method, c.input);
+                if (executed.error) {
+                    output.push({ style: "errorMessage", message: "Error: failed to execute: " + executed.error + "\n" });
+                }
+            }
+            results.push(output);
+        }
+        proc.stdin.end();
+        return results;
+    })();
+};
+
+(async function () {
+    const headless = await runHeadless();
+    const browser = await runBrowser();
+
+    let failed = 0;
+    cases.forEach((c, i) => {
+        const exp = JSON.stringify(browser[i], null, 2);
+        const act = JSON.stringify(headless[i], null, 2);
+        if (exp !== act) {
+            failed++;
+            console.error(`FAIL: ${c.name}\nbrowser: ${exp}\nheadless: ${act}`);
+        } else {
+            console.log(`PASS: ${c.name}`);
+        }
+    });
+    process.exit(failed > 0 ? 1 : 0);
+})().catch((err) => {
+    console.error(err);
+    process.exit(1);
+});
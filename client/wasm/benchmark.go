@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall/js"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/types"
+	"github.com/benthosdev/benthos-lab/lib/probe"
+)
+
+//------------------------------------------------------------------------------
+
+type benchmarkReport struct {
+	Iterations int
+	Batches    int
+	Messages   int
+	Duration   time.Duration
+	Mallocs    uint64
+	AllocBytes uint64
+	Processors []probe.ProcessorStats
+}
+
+func (r benchmarkReport) toJS() map[string]interface{} {
+	procs := make([]interface{}, len(r.Processors))
+	for i, p := range r.Processors {
+		procs[i] = map[string]interface{}{
+			"path":    p.Path,
+			"type":    p.Type,
+			"label":   p.Label,
+			"calls":   p.Calls,
+			"mean_ns": p.Mean.Nanoseconds(),
+			"p50_ns":  p.P50.Nanoseconds(),
+			"p99_ns":  p.P99.Nanoseconds(),
+			"max_ns":  p.Max.Nanoseconds(),
+		}
+	}
+	seconds := r.Duration.Seconds()
+	return map[string]interface{}{
+		"iterations":          r.Iterations,
+		"batches":             r.Batches,
+		"messages":            r.Messages,
+		"duration_ns":         r.Duration.Nanoseconds(),
+		"batches_per_second":  float64(r.Batches) / seconds,
+		"messages_per_second": float64(r.Messages) / seconds,
+		"mallocs":             r.Mallocs,
+		"alloc_bytes":         r.AllocBytes,
+		"processors":          procs,
+	}
+}
+
+func (r benchmarkReport) print(s *streamState) {
+	seconds := r.Duration.Seconds()
+	s.writeOutput(fmt.Sprintf(
+		"Benchmark: %v iterations, %v batches (%v messages) in %v, %.1f batches/s, %.1f messages/s\n",
+		r.Iterations, r.Batches, r.Messages, r.Duration,
+		float64(r.Batches)/seconds, float64(r.Messages)/seconds,
+	), "infoMessage")
+	if r.Batches > 0 {
+		s.writeOutput(fmt.Sprintf(
+			"Allocations: %v (%v bytes), %v (%v bytes) per batch\n",
+			r.Mallocs, r.AllocBytes,
+			r.Mallocs/uint64(r.Batches), r.AllocBytes/uint64(r.Batches),
+		), "infoMessage")
+	}
+	for _, p := range r.Processors {
+		s.writeOutput(fmt.Sprintf(
+			"%v (%v): calls %v, p50 %v, p99 %v, max %v\n",
+			p.Path, p.Type, p.Calls, p.P50, p.P99, p.Max,
+		), "infoMessage")
+	}
+}
+
+// runBenchmark feeds the input batches through the compiled stream a number
+// of times, waiting for each batch to complete before sending the next, and
+// profiles the processors along the way.
+func (s *streamState) runBenchmark(inputMsgs []types.Message, iterations int) (benchmarkReport, error) {
+	report := benchmarkReport{Iterations: iterations}
+
+	var sends []types.Message
+	for _, m := range inputMsgs {
+		if m.Len() > 0 {
+			sends = append(sends, m)
+		}
+	}
+	if len(sends) == 0 {
+		return report, errors.New("the input contains no messages")
+	}
+	if s.Consumers() == 0 {
+		return report, errors.New("the pipeline has no benthos_lab inputs")
+	}
+
+	// SendAll waits for all results to arrive.
+	results, restore := s.collectResults()
+	defer restore()
+
+	s.debugger.Suspend(true)
+	defer s.debugger.Suspend(false)
+
+	s.profiler.Reset()
+	s.profiler.Enable(true)
+	defer s.profiler.Enable(false)
+
+	var memBefore, memAfter runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+	start := time.Now()
+
+	for i := 0; i < iterations; i++ {
+		for _, m := range sends {
+			if err := s.SendAll([]types.Message{m.DeepCopy()}); err != nil {
+				return report, err
+			}
+			if _, err := results.take(); err != nil {
+				return report, err
+			}
+			report.Batches++
+			report.Messages += m.Len()
+		}
+	}
+
+	report.Duration = time.Since(start)
+	runtime.ReadMemStats(&memAfter)
+	report.Mallocs = memAfter.Mallocs - memBefore.Mallocs
+	report.AllocBytes = memAfter.TotalAlloc - memBefore.TotalAlloc
+	report.Processors = s.profiler.Stats()
+	return report, nil
+}
+
+//------------------------------------------------------------------------------
+
+// benchmarkArgs parses the input method, content and optional iterations
+// arguments of a benchmark.
+func benchmarkArgs(args []js.Value) ([]types.Message, int, error) {
+	method, err := argString(args, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	content, err := argString(args, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	inputMsgs, err := parseInput(method, content)
+	if err != nil {
+		return nil, 0, err
+	}
+	iterations := 100
+	if len(args) > 2 && args[2].Type() == js.TypeNumber {
+		iterations = args[2].Int()
+	}
+	if iterations < 1 {
+		return nil, 0, errors.New("iterations must be at least 1")
+	}
+	return inputMsgs, iterations, nil
+}
+
+func benchmark(s *streamState, args []js.Value) interface{} {
+	inputMsgs, iterations, err := benchmarkArgs(args)
+	if err != nil {
+		s.reportRunErr("benchmark", err)
+		return nil
+	}
+	var resultFunc js.Value
+	if len(args) > 3 {
+		resultFunc = args[3]
+	}
+
+	go func() {
+		defer recoverPanic(s, "benchmark", true)
+		report, err := s.runBenchmark(inputMsgs, iterations)
+		if err != nil {
+			s.reportRunErr("benchmark", err)
+			return
+		}
+		report.print(s)
+		if resultFunc.Type() == js.TypeFunction {
+			resultFunc.Invoke(report.toJS())
+		}
+	}()
+	return nil
+}
+
+//------------------------------------------------------------------------------
@@ -3,7 +3,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"net/http"
 	"runtime/debug"
 	"sort"
 	"strings"
@@ -17,7 +16,6 @@ import (
 	"github.com/Jeffail/benthos/v3/lib/log"
 	"github.com/Jeffail/benthos/v3/lib/manager"
 	"github.com/Jeffail/benthos/v3/lib/message"
-	"github.com/Jeffail/benthos/v3/lib/message/roundtrip"
 	"github.com/Jeffail/benthos/v3/lib/metrics"
 	"github.com/Jeffail/benthos/v3/lib/output"
 	"github.com/Jeffail/benthos/v3/lib/processor"
@@ -26,6 +24,8 @@ import (
 	"github.com/Jeffail/benthos/v3/lib/types"
 	labConfig "github.com/benthosdev/benthos-lab/lib/config"
 	"github.com/benthosdev/benthos-lab/lib/connectors"
+	"github.com/benthosdev/benthos-lab/lib/httpmock"
+	"github.com/benthosdev/benthos-lab/lib/probe"
 )
 
 //------------------------------------------------------------------------------
@@ -40,181 +40,723 @@ func reportErr(msg string, err error) {
 	writeOutput("Error: "+fmt.Sprintf(msg, err), "errorMessage")
 }
 
-func reportLints(msg []string) {
-	for _, m := range msg {
-		writeOutput("Lint: "+m+"\n", "lintMessage")
+//------------------------------------------------------------------------------
+
+func reportUsage(path string) {
+	if isHeadless() {
+		return
 	}
+	usageClient.Post("/usage/"+path, "text/plain", nil)
 }
 
 //------------------------------------------------------------------------------
 
-func reportUsage(path string) {
-	http.Post("/usage/"+path, "text/plain", nil)
+var (
+	errExecutionCancelled = errors.New("execution cancelled")
+	errExecutionTimedOut  = errors.New("execution timed out")
+	errPipelineReplaced   = errors.New("pipeline was replaced during execution")
+)
+
+// labConsumer is the channel of a benthos_lab input along with its name.
+type labConsumer struct {
+	name string
+	c    chan types.Message
 }
 
-//------------------------------------------------------------------------------
+const (
+	statusIdle      = "idle"
+	statusCompiling = "compiling"
+	statusReady     = "ready"
+	statusExecuting = "executing"
+	statusPaused    = "paused"
+	statusResetting = "resetting"
+)
 
+// streamState holds everything that belongs to a lab session.
 type streamState struct {
-	str           *stream.Type
-	mgr           *manager.Type
-	consumerChans []chan types.Message
+	handle js.Value
+
+	str         *stream.Type
+	mgr         *manager.Type
+	consumers   []labConsumer
+	closeChan   chan struct{}
+	generation  int
+	resultsFunc func([]types.Message, error)
+	status      string
+
+	// The most recently compiled config, used in order to rebuild the stream
+	// after an execution is cancelled or times out.
+	contents string
+
+	pending    int
+	panicked   bool
+	resultChan chan struct{}
+	cancelChan chan struct{}
+
+	executeTimeout  time.Duration
+	shutdownTimeout time.Duration
+
+	// Applied to configs as they are compiled.
+	sandbox sandboxConfig
+
+	// Canned responses served to HTTP requests made during execution.
+	httpMocks *httpmock.Table
+
+	// Environment variables that configs are interpolated with as they are
+	// compiled.
+	env map[string]string
+
+	debugger *debugger
+	coverage *coverageState
+	profiler *probe.Profiler
+
+	// Only one execution may be in flight at a time.
+	execMut sync.Mutex
+
+	// Compiles may overlap and must not interleave.
+	buildMut sync.Mutex
 
 	sync.RWMutex
 }
 
-func (s *streamState) Register(c chan types.Message) {
+// SetResultsFunc replaces the function that receives the results of each
+// executed batch and returns the previous one.
+func (s *streamState) SetResultsFunc(fn func([]types.Message, error)) func([]types.Message, error) {
+	s.Lock()
+	prev := s.resultsFunc
+	s.resultsFunc = fn
+	s.Unlock()
+	return prev
+}
+
+// Results is called with the results of a batch from a consumer registered
+// during a given generation of the stream. Results from previous generations
+// are ignored.
+func (s *streamState) Results(generation int, msgs []types.Message, err error) {
 	s.Lock()
-	s.consumerChans = append(s.consumerChans, c)
+	if generation != s.generation {
+		s.Unlock()
+		return
+	}
+	// Results can arrive before the send is counted, so pending may briefly
+	// be negative.
+	s.pending--
+	fn := s.resultsFunc
+	var perr *probe.PanicError
+	if errors.As(err, &perr) {
+		s.panicked = true
+	}
 	s.Unlock()
+
+	if perr != nil {
+		s.reportProcessorPanic(perr)
+	}
+
+	fn(msgs, err)
+	select {
+	case s.resultChan <- struct{}{}:
+	default:
+	}
 }
 
-func (s *streamState) SendAll(msgs []types.Message) {
+func (s *streamState) Consumers() int {
 	s.RLock()
 	defer s.RUnlock()
+	return len(s.consumers)
+}
+
+// InputNames returns the names of the benthos_lab inputs of the stream that
+// have one.
+func (s *streamState) InputNames() []string {
+	s.RLock()
+	defer s.RUnlock()
+	var names []string
+	for _, c := range s.consumers {
+		if len(c.name) > 0 {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// consumersFor returns the channels that batches sent to a target input should
+// be written to. Batches without a target are written to every unnamed input,
+// or to every input when they are all named.
+func consumersFor(consumers []labConsumer, target string) ([]chan types.Message, error) {
+	var chans []chan types.Message
+	for _, c := range consumers {
+		if c.name == target {
+			chans = append(chans, c.c)
+		}
+	}
+	if len(chans) > 0 || len(consumers) == 0 {
+		return chans, nil
+	}
+	if len(target) > 0 {
+		return nil, fmt.Errorf("no benthos_lab input named '%v'", target)
+	}
+	for _, c := range consumers {
+		chans = append(chans, c.c)
+	}
+	return chans, nil
+}
+
+// copyBatch deep copies a batch whilst keeping the context of each part.
+func copyBatch(msg types.Message) types.Message {
+	copied := message.New(nil)
+	msg.Iter(func(i int, p types.Part) error {
+		copied.Append(message.WithContext(message.GetContext(p), p.DeepCopy()))
+		return nil
+	})
+	return copied
+}
+
+// Register a named consumer channel, returns a channel that is closed when the
+// consumer should shut down along with the current generation of the stream.
+func (s *streamState) Register(name string, c chan types.Message) (<-chan struct{}, int) {
+	s.Lock()
+	s.consumers = append(s.consumers, labConsumer{name: name, c: c})
+	closeChan, generation := s.closeChan, s.generation
+	s.Unlock()
+	return closeChan, generation
+}
+
+// SendAll dispatches batches to all consumers and blocks until their results
+// have been received. If the pipeline stops making progress for longer than
+// the execution timeout, or the execution is cancelled, an error is returned.
+func (s *streamState) SendAll(msgs []types.Message) error {
+	return s.SendTo("", msgs)
+}
+
+// SendTo dispatches batches to the benthos_lab inputs of a given name, or to
+// the unnamed inputs when the target is empty, and waits for their results.
+func (s *streamState) SendTo(target string, msgs []types.Message) error {
+	s.execMut.Lock()
+	defer s.execMut.Unlock()
+
+	cancelChan := make(chan struct{})
+
+	s.Lock()
+	chans, err := consumersFor(s.consumers, target)
+	if err != nil {
+		s.Unlock()
+		return err
+	}
+	closeChan, timeout := s.closeChan, s.executeTimeout
+	s.cancelChan = cancelChan
+	s.panicked = false
+	if s.status == statusReady {
+		s.status = statusExecuting
+	}
+	s.Unlock()
+
+	startExecuting(s)
+	defer func() {
+		stopExecuting(s)
+		s.Lock()
+		s.cancelChan = nil
+		if s.status == statusExecuting {
+			s.status = statusReady
+		}
+		s.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	resetTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(timeout)
+	}
+
+	// Waits for progress, batches held at a breakpoint can take as long as
+	// they need.
+	waitFor := func(sendChan chan types.Message, msg types.Message) (bool, error) {
+		select {
+		case sendChan <- msg:
+			s.Lock()
+			s.pending++
+			s.Unlock()
+			resetTimer()
+			return true, nil
+		case <-s.resultChan:
+			resetTimer()
+		case <-timer.C:
+			if !s.debugger.Paused() {
+				return false, errExecutionTimedOut
+			}
+			timer.Reset(timeout)
+		case <-cancelChan:
+			return false, errExecutionCancelled
+		case <-closeChan:
+			return false, errPipelineReplaced
+		}
+		return false, nil
+	}
+
 	for _, inputMsg := range msgs {
 		if inputMsg.Len() == 0 {
 			continue
 		}
-
-		for _, c := range s.consumerChans {
-			select {
-			case c <- inputMsg:
-			case <-time.After(time.Second * 30):
-				reportErr("failed to execute: %v\n", errors.New("send timed out"))
-				return
+		for i, c := range chans {
+			msg := inputMsg
+			if i > 0 {
+				// Each input attaches its own result store to the batch.
+				msg = copyBatch(inputMsg)
 			}
+			for sent := false; !sent; {
+				var err error
+				if sent, err = waitFor(c, msg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for s.Pending() > 0 {
+		if _, err := waitFor(nil, nil); err != nil {
+			return err
 		}
 	}
+
+	s.RLock()
+	defer s.RUnlock()
+	if s.panicked {
+		return errProcessorPanicked
+	}
+	return nil
 }
 
-func (s *streamState) Clear() {
+// Pending returns the number of batches dispatched that have not yet yielded
+// results.
+func (s *streamState) Pending() int {
+	s.RLock()
+	defer s.RUnlock()
+	return s.pending
+}
+
+// Cancel the execution currently in flight, returns false if there isn't one.
+func (s *streamState) Cancel() bool {
 	s.Lock()
-	for _, c := range s.consumerChans {
-		close(c)
+	defer s.Unlock()
+	if s.cancelChan == nil {
+		return false
 	}
-	s.consumerChans = nil
-	if s.str != nil {
-		exitTimeout := time.Second * 30
-		timesOut := time.Now().Add(exitTimeout)
-		if err := s.str.Stop(time.Until(timesOut)); err != nil {
-			reportErr("failed to cleanly shut down pipeline: %v\n", err)
-		}
-		s.str = nil
+	close(s.cancelChan)
+	s.cancelChan = nil
+	return true
+}
+
+func (s *streamState) SetTimeouts(execute, shutdown time.Duration) {
+	s.Lock()
+	if execute > 0 {
+		s.executeTimeout = execute
 	}
-	if s.mgr != nil {
-		s.mgr.CloseAsync()
-		s.mgr = nil
+	if shutdown > 0 {
+		s.shutdownTimeout = shutdown
 	}
 	s.Unlock()
 }
 
-func (s *streamState) Set(str *stream.Type, mgr *manager.Type) {
+// SetSandbox changes the components that are swapped for lab connectors, which
+// takes effect the next time a config is compiled.
+func (s *streamState) SetSandbox(opts sandboxConfig) {
+	s.Lock()
+	s.sandbox = opts
+	s.Unlock()
+}
+
+// SetEnv replaces the environment variables of the session, which takes effect
+// the next time a config is compiled.
+func (s *streamState) SetEnv(env map[string]string) {
+	s.Lock()
+	s.env = env
+	s.Unlock()
+}
+
+func (s *streamState) Env() map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.env
+}
+
+func (s *streamState) Sandbox() sandboxConfig {
+	s.RLock()
+	defer s.RUnlock()
+	return s.sandbox
+}
+
+func (s *streamState) SetStatus(status string) {
+	s.Lock()
+	s.status = status
+	s.Unlock()
+}
+
+func (s *streamState) Status() map[string]interface{} {
+	s.RLock()
+	defer s.RUnlock()
+	status := s.status
+	if status == statusExecuting && s.debugger.Paused() {
+		status = statusPaused
+	}
+	return map[string]interface{}{
+		"status":              status,
+		"pending":             s.pending,
+		"execute_timeout_ms":  s.executeTimeout.Milliseconds(),
+		"shutdown_timeout_ms": s.shutdownTimeout.Milliseconds(),
+		"sandbox": map[string]interface{}{
+			"outputs": s.sandbox.Outputs,
+			"inputs":  s.sandbox.Inputs,
+		},
+	}
+}
+
+func (s *streamState) Contents() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.contents
+}
+
+func (s *streamState) Clear() {
+	s.debugger.Reset()
+
+	s.Lock()
+	close(s.closeChan)
+	s.closeChan = make(chan struct{})
+	s.consumers = nil
+	s.generation++
+	s.pending = 0
+	str, mgr, shutdownTimeout := s.str, s.mgr, s.shutdownTimeout
+	s.str, s.mgr = nil, nil
+	s.status = statusIdle
+	s.Unlock()
+
+	if str != nil {
+		if err := str.Stop(shutdownTimeout); err != nil {
+			s.reportErr("failed to cleanly shut down pipeline: %v\n", err)
+		}
+	}
+	if mgr != nil {
+		mgr.CloseAsync()
+	}
+}
+
+func (s *streamState) Set(contents string, str *stream.Type, mgr *manager.Type) {
 	s.Lock()
+	s.contents = contents
 	s.str = str
 	s.mgr = mgr
+	s.status = statusReady
 	s.Unlock()
 }
 
-var state = &streamState{}
+func (s *streamState) writeResults(msgs []types.Message, err error) {
+	if err != nil {
+		// Panics have already been reported along with their stack trace.
+		var perr *probe.PanicError
+		if !errors.As(err, &perr) {
+			s.reportErr("pipeline error: %v\n", err)
+		}
+		return
+	}
+	if len(msgs) == 0 {
+		s.writeOutput("Pipeline execution resulted in zero messages.\n", "infoMessage")
+		return
+	}
+	for _, m := range msgs {
+		if label, ok := connectors.OutputLabel(m.Get(0)); ok {
+			s.writeOutput(fmt.Sprintf("Routed to '%v':\n", label), "infoMessage")
+		}
+		m.Iter(func(i int, p types.Part) error {
+			if fields := connectors.OutputFields(p); len(fields) > 0 {
+				s.writeOutput(formatFields(fields)+"\n", "infoMessage")
+			}
+			s.writeOutput(string(p.Get())+"\n", "")
+			return nil
+		})
+		s.writeOutput("\n", "")
+	}
+}
 
 //------------------------------------------------------------------------------
 
 func registerConnectors() func() {
 	input.RegisterPlugin(
 		"benthos_lab",
-		func() interface{} {
-			s := struct{}{}
-			return &s
-		},
-		func(_ interface{}, _ types.Manager, logger log.Modular, stats metrics.Type) (types.Input, error) {
+		newLabInputConfig,
+		func(conf interface{}, _ types.Manager, logger log.Modular, stats metrics.Type) (types.Input, error) {
+			lConf := conf.(*labInputConfig)
+			s := lConf.sessionOrDefault()
 			batchChan := make(chan types.Message)
-			state.Register(batchChan)
+			closeChan, generation := s.Register(lConf.Name, batchChan)
 			rdr := connectors.NewRoundTripReader(func() (types.Message, error) {
 				select {
-				case m, open := <-batchChan:
-					if open {
-						return m, nil
-					}
+				case m := <-batchChan:
+					return m, nil
+				case <-closeChan:
 				}
 				return nil, types.ErrTypeClosed
 			}, func(msgs []types.Message, err error) {
-				if err != nil {
-					reportErr("pipeline error: %v\n", err)
-					return
-				}
-				if len(msgs) == 0 {
-					writeOutput("Pipeline execution resulted in zero messages.\n", "infoMessage")
-					return
-				}
-				for _, m := range msgs {
-					for _, out := range message.GetAllBytes(m) {
-						writeOutput(string(out)+"\n", "")
-					}
-					writeOutput("\n", "")
-				}
+				s.Results(generation, msgs, err)
 			})
 			return input.NewReader("benthos_lab", rdr, logger, stats)
 		},
 	)
-	input.DocumentPlugin("benthos_lab", "", func(conf interface{}) interface{} { return nil })
+	input.DocumentPlugin("benthos_lab", `
+Reads batches dispatched by the lab. Inputs within a broker can be given a name
+with the field `+"`plugin.name`"+`, allowing datasets to target them.`, func(conf interface{}) interface{} {
+		if lConf, ok := conf.(*labInputConfig); ok && len(lConf.Name) > 0 {
+			return map[string]interface{}{"name": lConf.Name}
+		}
+		return nil
+	})
 	output.RegisterPlugin(
 		"benthos_lab",
-		func() interface{} {
-			s := struct{}{}
-			return &s
-		},
-		func(_ interface{}, _ types.Manager, logger log.Modular, stats metrics.Type) (types.Output, error) {
-			wtr := roundtrip.Writer{}
+		newLabOutputConfig,
+		func(conf interface{}, _ types.Manager, logger log.Modular, stats metrics.Type) (types.Output, error) {
+			lConf := conf.(*labOutputConfig)
+			wtr := connectors.LabelledWriter{
+				Label:  lConf.Label,
+				Fields: resolveFields(lConf.fields),
+			}
 			return output.NewWriter("benthos_lab", wtr, logger, stats)
 		},
 	)
-	output.DocumentPlugin("benthos_lab", "", func(conf interface{}) interface{} { return nil })
+	output.DocumentPlugin("benthos_lab", `
+Captures batches as the results of the lab. Outputs within a broker or switch
+can be given a label with the field `+"`plugin.label`"+`, or with the label of
+the output, in order to attribute each result to the output it reached.`, func(conf interface{}) interface{} {
+		if lConf, ok := conf.(*labOutputConfig); ok && len(lConf.Label) > 0 {
+			return map[string]interface{}{"label": lConf.Label}
+		}
+		return nil
+	})
+	probe.RegisterPlugin()
 
 	return func() {
 		state.Clear()
 	}
 }
 
-func compile(this js.Value, args []js.Value) interface{} {
-	contents := args[0].String()
+// build compiles a config into a new stream that replaces the current one.
+func (s *streamState) build(contents string, conf config.Type) error {
+	s.buildMut.Lock()
+	defer s.buildMut.Unlock()
+
+	s.Clear()
+	s.SetStatus(statusCompiling)
+	s.httpMocks.ClearRequests()
+
+	if err := sandbox(&conf, s.Sandbox()); err != nil {
+		s.SetStatus(statusIdle)
+		return fmt.Errorf("failed to sandbox pipeline: %w", err)
+	}
+
+	labConfig.WalkInputs(&conf, func(_ string, c *input.Config) {
+		if c.Type == "benthos_lab" {
+			lConf := labInputConfig{}
+			if parsed, ok := c.Plugin.(*labInputConfig); ok {
+				lConf = *parsed
+			}
+			lConf.session = s
+			c.Plugin = &lConf
+		}
+	})
+	labConfig.WalkOutputs(&conf, func(_ string, c *output.Config) {
+		if c.Type == "benthos_lab" {
+			lConf := labOutputConfig{}
+			if parsed, ok := c.Plugin.(*labOutputConfig); ok {
+				lConf = *parsed
+			}
+			if len(lConf.Label) == 0 {
+				lConf.Label = c.Label
+			}
+			c.Plugin = &lConf
+		}
+	})
+
+	s.coverage.Compiled(contents)
+	probe.Instrument(&conf, probe.Chain(s.debugger, s.coverage.cov, s.profiler))
+
+	logger := log.WrapAtLevel(logWriter{s}, log.LogInfo)
+	mgr, err := manager.NewV2(conf.ResourceConfig, types.NoopMgr(), logger, metrics.Noop())
+	if err != nil {
+		s.SetStatus(statusIdle)
+		return fmt.Errorf("failed to create pipeline resources: %w", err)
+	}
+
+	str, err := stream.New(conf.Config, stream.OptSetLogger(logger), stream.OptSetManager(mgr))
+	if err != nil {
+		mgr.CloseAsync()
+		s.SetStatus(statusIdle)
+		return fmt.Errorf("failed to create pipeline: %w", err)
+	}
+
+	s.Set(contents, str, mgr)
+	return nil
+}
+
+// resetRuntime tears down the current stream and rebuilds it from the most
+// recently compiled config.
+func (s *streamState) resetRuntime() {
+	defer recoverPanic(s, "reset", false)
+
+	contents := s.Contents()
+	s.Clear()
+	if len(contents) == 0 {
+		return
+	}
+	s.SetStatus(statusResetting)
 	conf, err := labConfig.Unmarshal(contents)
+	if err == nil {
+		err = s.build(contents, conf)
+	}
 	if err != nil {
-		reportErr("failed to create pipeline: %v\n", err)
-		go reportUsage("compile/failed")
-		return nil
+		s.reportErr("failed to reset pipeline: %v\n", err)
+		return
 	}
+	s.writeOutput("Pipeline has been reset.\n", "infoMessage")
+}
 
-	successFunc := args[1]
-	go func() {
-		state.Clear()
+// needsReset returns true if an execution error indicates that the pipeline
+// may have been left holding batches or in a broken state.
+func needsReset(err error) bool {
+	var perr *probe.PanicError
+	switch {
+	case err == errExecutionTimedOut, err == errExecutionCancelled, err == errProcessorPanicked:
+		return true
+	case errors.As(err, &perr):
+		return true
+	}
+	return false
+}
 
-		logger := log.WrapAtLevel(logWriter{}, log.LogInfo)
-		mgr, err := manager.NewV2(conf.ResourceConfig, types.NoopMgr(), logger, metrics.Noop())
-		if err != nil {
-			reportErr("failed to create pipeline resources: %v\n", err)
-			go reportUsage("compile/failed")
-			return
-		}
+// handleExecutionErr reports a failed execution and resets the runtime when
+// necessary.
+func (s *streamState) handleExecutionErr(err error) {
+	if err == nil || err == errPipelineReplaced {
+		return
+	}
+	s.reportErr("failed to execute: %v\n", err)
+	if needsReset(err) {
+		s.resetRuntime()
+	}
+}
+
+// reportRunErr reports a command that failed to run in the background and
+// resets the runtime when necessary.
+func (s *streamState) reportRunErr(command string, err error) {
+	s.reportErr("failed to run "+command+": %v\n", err)
+	if needsReset(err) {
+		s.resetRuntime()
+	}
+}
 
-		str, err := stream.New(conf.Config, stream.OptSetLogger(logger), stream.OptSetManager(mgr))
+// resultsCollector gathers the output batches of a session along with the
+// first error reported since they were last taken.
+type resultsCollector struct {
+	msgs []types.Message
+	err  error
+	sync.Mutex
+}
+
+// collectResults replaces the results func of a session with a collector until
+// the returned func is called.
+func (s *streamState) collectResults() (*resultsCollector, func()) {
+	c := &resultsCollector{}
+	prevResults := s.SetResultsFunc(func(msgs []types.Message, err error) {
+		c.Lock()
+		defer c.Unlock()
 		if err != nil {
-			mgr.CloseAsync()
-			reportErr("failed to create pipeline: %v\n", err)
-			go reportUsage("compile/failed")
+			if c.err == nil {
+				c.err = err
+			}
 			return
 		}
+		c.msgs = append(c.msgs, msgs...)
+	})
+	return c, func() {
+		s.SetResultsFunc(prevResults)
+	}
+}
 
-		state.Set(str, mgr)
+// take returns the results gathered so far and clears them.
+func (c *resultsCollector) take() ([]types.Message, error) {
+	c.Lock()
+	defer c.Unlock()
+	msgs, err := c.msgs, c.err
+	c.msgs, c.err = nil, nil
+	return msgs, err
+}
+
+// compileConfig interpolates a config with the environment variables of the
+// session, then parses and compiles it into a stream that replaces the current
+// one, returning any lint messages, which are also returned when the config
+// fails to build.
+func (s *streamState) compileConfig(contents string) ([]string, error) {
+	contents = labConfig.ReplaceEnvVars(contents, s.Env())
+	conf, err := labConfig.Unmarshal(contents)
+	if err != nil {
+		go reportUsage("compile/failed")
+		return nil, fmt.Errorf("failed to create pipeline: %w", err)
+	}
+
+	lints, err := config.Lint([]byte(contents), conf)
+	if err != nil {
+		s.reportErr("failed to parse config for linter: %v\n", err)
+		go reportUsage("compile/failed")
+	}
+	lints = append(lints, referenceLints(contents)...)
 
-		if lints, err := config.Lint([]byte(contents), conf); err != nil {
-			reportErr("failed to parse config for linter: %v\n", err)
-			go reportUsage("compile/failed")
-		} else if len(lints) > 0 {
-			reportLints(lints)
+	if err = s.build(contents, conf); err != nil {
+		go reportUsage("compile/failed")
+		return lints, err
+	}
+
+	go reportUsage("compile/success")
+	return lints, nil
+}
+
+// referenceLints returns a lint message for each problem with the resource
+// references of a config.
+func referenceLints(contents string) []string {
+	issues, err := labConfig.CheckReferences(contents)
+	if err != nil || len(issues) == 0 {
+		return nil
+	}
+	paths := make([]string, len(issues))
+	for i, issue := range issues {
+		paths[i] = issue.Path
+	}
+	lines, _ := labConfig.PathLines(contents, paths)
+	sort.SliceStable(issues, func(i, j int) bool {
+		return lines[issues[i].Path] < lines[issues[j].Path]
+	})
+	lints := make([]string, len(issues))
+	for i, issue := range issues {
+		lints[i] = fmt.Sprintf("line %v: %v", lines[issue.Path], issue)
+	}
+	return lints
+}
+
+func compile(s *streamState, args []js.Value) interface{} {
+	contents, successFunc := args[0].String(), args[1]
+	go func() {
+		defer recoverPanic(s, "compile", true)
+		lints, err := s.compileConfig(contents)
+		if len(lints) > 0 {
+			s.reportLints(lints)
+		}
+		if err != nil {
+			s.reportErr("%v\n", err)
+			return
 		}
 
-		go reportUsage("compile/success")
-		writeOutput("Compiled successfully.\n", "infoMessage")
+		s.writeOutput("Compiled successfully.\n", "infoMessage")
 		if successFunc.Type() == js.TypeFunction {
 			successFunc.Invoke()
 		}
@@ -222,10 +764,7 @@ func compile(this js.Value, args []js.Value) interface{} {
 	return nil
 }
 
-func execute(this js.Value, args []js.Value) interface{} {
-	inputMethod := args[0].String()
-	inputContent := args[1].String()
-
+func parseInput(inputMethod, inputContent string) ([]types.Message, error) {
 	inputMsgs := []types.Message{}
 
 	switch inputMethod {
@@ -250,164 +789,260 @@ func execute(this js.Value, args []js.Value) interface{} {
 	case "message":
 		inputMsgs = append(inputMsgs, message.New([][]byte{[]byte(inputContent)}))
 	default:
-		reportErr("failed to dispatch message: %v\n", fmt.Errorf("unrecognised input method: %v", inputMethod))
+		return nil, fmt.Errorf("unrecognised input method: %v", inputMethod)
+	}
+
+	for i, msg := range inputMsgs {
+		inputMsgs[i] = probe.TagInput(msg, i)
+	}
+	return inputMsgs, nil
+}
+
+// executeArgs parses the input method and content arguments of an execution
+// into messages, and reports the usage.
+func executeArgs(args []js.Value) ([]types.Message, error) {
+	method, err := argString(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	content, err := argString(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	inputMsgs, err := parseInput(method, content)
+	if err != nil {
 		go reportUsage("execute/failed")
+		return nil, fmt.Errorf("failed to dispatch message: %w", err)
+	}
+	go reportUsage("execute/success")
+	return inputMsgs, nil
+}
+
+func execute(s *streamState, args []js.Value) interface{} {
+	inputMsgs, err := executeArgs(args)
+	if err != nil {
+		s.reportErr("%v\n", err)
 		return nil
 	}
 
-	go reportUsage("execute/success")
-	go state.SendAll(inputMsgs)
+	var doneFunc js.Value
+	if len(args) > 2 {
+		doneFunc = args[2]
+	}
+
+	go func() {
+		defer recoverPanic(s, "execute", true)
+		s.handleExecutionErr(s.SendAll(inputMsgs))
+		if doneFunc.Type() == js.TypeFunction {
+			doneFunc.Invoke()
+		}
+	}()
+	return nil
+}
+
+func cancel(s *streamState, args []js.Value) interface{} {
+	if !s.Cancel() {
+		s.writeOutput("There is no execution to cancel.\n", "infoMessage")
+	}
 	return nil
 }
 
+func setTimeouts(s *streamState, args []js.Value) interface{} {
+	if len(args) == 0 || args[0].Type() != js.TypeObject {
+		s.reportErr("failed to set timeouts: %v\n", errors.New("expected an object"))
+		return nil
+	}
+	var execute, shutdown time.Duration
+	if v := args[0].Get("execute"); v.Type() == js.TypeNumber {
+		execute = time.Duration(v.Int()) * time.Millisecond
+	}
+	if v := args[0].Get("shutdown"); v.Type() == js.TypeNumber {
+		shutdown = time.Duration(v.Int()) * time.Millisecond
+	}
+	s.SetTimeouts(execute, shutdown)
+	return nil
+}
+
+func status(s *streamState, args []js.Value) interface{} {
+	return s.Status()
+}
+
 //------------------------------------------------------------------------------
 
-type logWriter struct{}
+type logWriter struct {
+	s *streamState
+}
 
 func (l logWriter) Printf(format string, v ...interface{}) {
-	writeOutput("Log: "+fmt.Sprintf(format, v...), "logMessage")
+	l.s.writeOutput("Log: "+fmt.Sprintf(format, v...), "logMessage")
 }
 
 func (l logWriter) Println(v ...interface{}) {
 	if str, ok := v[0].(string); ok {
-		writeOutput("Log: "+fmt.Sprintf(str, v[1:]...)+"\n", "logMessage")
+		l.s.writeOutput("Log: "+fmt.Sprintf(str, v[1:]...)+"\n", "logMessage")
 	} else {
-		writeOutput("Log: "+fmt.Sprintf("%v\n", v), "logMessage")
+		l.s.writeOutput("Log: "+fmt.Sprintf("%v\n", v), "logMessage")
 	}
 }
 
 //------------------------------------------------------------------------------
 
-func normalise(this js.Value, args []js.Value) interface{} {
-	contents := args[0].String()
+// normaliseConfig parses a config and marshals it back into its normalised
+// form.
+func normaliseConfig(contents string, nConf labConfig.NormaliseConfig) (string, error) {
 	conf, err := labConfig.Unmarshal(contents)
 	if err != nil {
-		reportErr("failed to create pipeline: %v\n", err)
 		go reportUsage("normalise/failed")
-		return nil
+		return "", fmt.Errorf("failed to create pipeline: %w", err)
 	}
 
-	sanitBytes, err := labConfig.Marshal(conf)
+	sanitBytes, err := labConfig.MarshalWithConfig(conf, nConf)
 	if err != nil {
-		reportErr("failed to normalise config: %v\n", err)
 		go reportUsage("normalise/failed")
-		return nil
+		return "", fmt.Errorf("failed to normalise config: %w", err)
 	}
 
 	go reportUsage("normalise/success")
-	if args[1].Type() == js.TypeFunction {
-		args[1].Invoke(string(sanitBytes))
-	}
-	return nil
+	return string(sanitBytes), nil
 }
 
-//------------------------------------------------------------------------------
-
-func addInput(this js.Value, args []js.Value) interface{} {
-	inputType, contents := args[0].String(), args[1].String()
-	conf, err := labConfig.Unmarshal(contents)
-	if err != nil {
-		reportErr("Failed to unmarshal current config: %v\n", err)
-		return nil
+// normaliseOptions parses an optional object of the form {mode, deprecated,
+// format}, where mode is standard, minimal or full, deprecated is keep or strip
+// and format is yaml or json.
+func normaliseOptions(v js.Value) (labConfig.NormaliseConfig, error) {
+	var mode, deprecated, format string
+	if v.Type() == js.TypeObject {
+		if m := v.Get("mode"); m.Type() == js.TypeString {
+			mode = m.String()
+		}
+		if d := v.Get("deprecated"); d.Type() == js.TypeString {
+			deprecated = d.String()
+		}
+		if f := v.Get("format"); f.Type() == js.TypeString {
+			format = f.String()
+		}
 	}
+	return labConfig.ParseNormaliseConfig(mode, deprecated, format)
+}
 
-	if err := labConfig.AddInput(inputType, &conf); err != nil {
-		reportErr("Failed to add input: %v\n", err)
-		return nil
+func normalise(this js.Value, args []js.Value) interface{} {
+	var opts js.Value
+	if len(args) > 2 {
+		opts = args[2]
 	}
-
-	resultBytes, err := labConfig.Marshal(conf)
+	nConf, err := normaliseOptions(opts)
 	if err != nil {
-		reportErr("failed to normalise config: %v\n", err)
+		reportErr("%v\n", err)
 		return nil
 	}
-	return string(resultBytes)
-}
-
-func addProcessor(this js.Value, args []js.Value) interface{} {
-	procType, contents := args[0].String(), args[1].String()
-	conf, err := labConfig.Unmarshal(contents)
+	sanit, err := normaliseConfig(args[0].String(), nConf)
 	if err != nil {
-		reportErr("Failed to unmarshal current config: %v\n", err)
+		reportErr("%v\n", err)
 		return nil
 	}
-
-	if err := labConfig.AddProcessor(procType, &conf); err != nil {
-		reportErr("Failed to add processor: %v\n", err)
-		return nil
-	}
-
-	resultBytes, err := labConfig.Marshal(conf)
-	if err != nil {
-		reportErr("failed to normalise config: %v\n", err)
-		return nil
+	if args[1].Type() == js.TypeFunction {
+		args[1].Invoke(sanit)
 	}
-	return string(resultBytes)
+	return nil
 }
 
-func addOutput(this js.Value, args []js.Value) interface{} {
-	outputType, contents := args[0].String(), args[1].String()
-	conf, err := labConfig.Unmarshal(contents)
+// graphConfig parses a config and exports its topology in the named format,
+// which is json, dot or mermaid.
+func graphConfig(contents, format string) (string, error) {
+	gFormat, err := labConfig.ParseGraphFormat(format)
 	if err != nil {
-		reportErr("Failed to unmarshal current config: %v\n", err)
-		return nil
+		return "", err
 	}
-
-	if err := labConfig.AddOutput(outputType, &conf); err != nil {
-		reportErr("Failed to add output: %v\n", err)
-		return nil
+	g, err := labConfig.ConfigGraph(contents)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse config: %w", err)
 	}
-
-	resultBytes, err := labConfig.Marshal(conf)
+	graphBytes, err := labConfig.MarshalGraph(g, gFormat)
 	if err != nil {
-		reportErr("failed to normalise config: %v\n", err)
-		return nil
+		return "", fmt.Errorf("failed to export graph: %w", err)
 	}
-	return string(resultBytes)
+	return string(graphBytes), nil
 }
 
-func addCache(this js.Value, args []js.Value) interface{} {
-	procType, contents := args[0].String(), args[1].String()
-	conf, err := labConfig.Unmarshal(contents)
+func graph(this js.Value, args []js.Value) interface{} {
+	var format string
+	if len(args) > 2 && args[2].Type() == js.TypeString {
+		format = args[2].String()
+	}
+	res, err := graphConfig(args[0].String(), format)
 	if err != nil {
-		reportErr("Failed to unmarshal current config: %v\n", err)
+		reportErr("%v\n", err)
 		return nil
 	}
-
-	if err := labConfig.AddCache(procType, &conf); err != nil {
-		reportErr("Failed to add cache: %v\n", err)
-		return nil
+	if args[1].Type() == js.TypeFunction {
+		args[1].Invoke(res)
 	}
+	return nil
+}
 
-	resultBytes, err := labConfig.Marshal(conf)
-	if err != nil {
-		reportErr("failed to normalise config: %v\n", err)
-		return nil
-	}
+//------------------------------------------------------------------------------
 
-	return string(resultBytes)
+// componentAdders maps the kinds of component that can be added to a config
+// to the functions that add them.
+var componentAdders = map[string]func(doc *labConfig.Document, cType, path string, index int) error{
+	"input":     (*labConfig.Document).AddInput,
+	"processor": (*labConfig.Document).AddProcessor,
+	"output":    (*labConfig.Document).AddOutput,
+	"cache":     (*labConfig.Document).AddCache,
+	"ratelimit": (*labConfig.Document).AddRatelimit,
 }
 
-func addRatelimit(this js.Value, args []js.Value) interface{} {
-	procType, contents := args[0].String(), args[1].String()
-	conf, err := labConfig.Unmarshal(contents)
-	if err != nil {
-		reportErr("Failed to unmarshal current config: %v\n", err)
-		return nil
+// addComponent adds a component of a kind and type to a config at an index of
+// the list at a path, keeping the comments and formatting of everything else.
+// An empty path adds the component to its default place and a negative index
+// appends it.
+func addComponent(kind, cType, path string, index int, contents string) (string, error) {
+	add, exists := componentAdders[kind]
+	if !exists {
+		return "", fmt.Errorf("unrecognised component kind: %v", kind)
 	}
 
-	if err := labConfig.AddRatelimit(procType, &conf); err != nil {
-		reportErr("Failed to add cache: %v\n", err)
+	return editConfig(contents, func(doc *labConfig.Document) error {
+		if err := add(doc, cType, path, index); err != nil {
+			return fmt.Errorf("Failed to add %v: %w", kind, err)
+		}
 		return nil
-	}
+	})
+}
 
-	resultBytes, err := labConfig.Marshal(conf)
-	if err != nil {
-		reportErr("failed to normalise config: %v\n", err)
-		return nil
+// targetArgs parses the optional path and index arguments that follow a
+// number of required ones.
+func targetArgs(args []js.Value, i int) (path string, index int, err error) {
+	index = -1
+	if len(args) > i && args[i].Type() != js.TypeUndefined && args[i].Type() != js.TypeNull {
+		if path, err = componentPath(args[i]); err != nil {
+			return
+		}
 	}
+	if len(args) > i+1 && args[i+1].Type() != js.TypeUndefined && args[i+1].Type() != js.TypeNull {
+		if args[i+1].Type() != js.TypeNumber {
+			err = fmt.Errorf("expected a number for argument %v", i+1)
+			return
+		}
+		index = args[i+1].Int()
+	}
+	return
+}
 
-	return string(resultBytes)
+func makeAddComponent(kind string) func(this js.Value, args []js.Value) interface{} {
+	return func(this js.Value, args []js.Value) interface{} {
+		path, index, err := targetArgs(args, 2)
+		if err != nil {
+			reportErr("%v\n", err)
+			return nil
+		}
+		result, err := addComponent(kind, args[0].String(), path, index, args[1].String())
+		if err != nil {
+			reportErr("%v\n", err)
+			return nil
+		}
+		return result
+	}
 }
 
 //------------------------------------------------------------------------------
@@ -529,20 +1164,37 @@ func registerFunctions() func() {
 		fields = append(fields, name)
 		benthosLab.Set(name, fn)
 	}
+	addGlobalFunction := func(name string, fn func(js.Value, []js.Value) interface{}) {
+		addLabFunction(name, js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			defer recoverPanic(state, name, false)
+			return fn(this, args)
+		}))
+	}
 
-	addLabFunction("getInputs", js.FuncOf(getInputs))
-	addLabFunction("getProcessors", js.FuncOf(getProcessors))
-	addLabFunction("getOutputs", js.FuncOf(getOutputs))
-	addLabFunction("getCaches", js.FuncOf(getCaches))
-	addLabFunction("getRatelimits", js.FuncOf(getRatelimits))
-	addLabFunction("addInput", js.FuncOf(addInput))
-	addLabFunction("addProcessor", js.FuncOf(addProcessor))
-	addLabFunction("addOutput", js.FuncOf(addOutput))
-	addLabFunction("addCache", js.FuncOf(addCache))
-	addLabFunction("addRatelimit", js.FuncOf(addRatelimit))
-	addLabFunction("normalise", js.FuncOf(normalise))
-	addLabFunction("compile", js.FuncOf(compile))
-	addLabFunction("execute", js.FuncOf(execute))
+	addGlobalFunction("getInputs", getInputs)
+	addGlobalFunction("getProcessors", getProcessors)
+	addGlobalFunction("getOutputs", getOutputs)
+	addGlobalFunction("getCaches", getCaches)
+	addGlobalFunction("getRatelimits", getRatelimits)
+	addGlobalFunction("addInput", makeAddComponent("input"))
+	addGlobalFunction("addProcessor", makeAddComponent("processor"))
+	addGlobalFunction("addOutput", makeAddComponent("output"))
+	addGlobalFunction("addCache", makeAddComponent("cache"))
+	addGlobalFunction("addRatelimit", makeAddComponent("ratelimit"))
+	addGlobalFunction("normalise", normalise)
+	addGlobalFunction("graph", graph)
+	addGlobalFunction("createSession", createSession)
+	addGlobalFunction("compare", compare)
+	addGlobalFunction("setFiles", setFiles)
+	addGlobalFunction("getFiles", getFiles)
+	for name := range refactorHandlers {
+		addGlobalFunction(name, makeRefactorFunction(name))
+	}
+
+	// The session functions of the default session are registered globally.
+	for name, fn := range sessionFuncs {
+		addLabFunction(name, bindSession(state, name, fn))
+	}
 
 	return func() {
 		for _, field := range fields {
@@ -559,14 +1211,19 @@ func main() {
 
 	defer registerConnectors()()
 	defer registerFunctions()()
+	defer installHTTPMocks()()
 
 	println("WASM Benthos Initialized")
 	onLoad()
 
-	js.Global().Call("addEventListener", "beforeunload", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-		c <- struct{}{}
-		return nil
-	}))
+	if isWorker() || isHeadless() {
+		startWorker()
+	} else if addListener := js.Global().Get("addEventListener"); addListener.Type() == js.TypeFunction {
+		addListener.Invoke("beforeunload", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			c <- struct{}{}
+			return nil
+		}))
+	}
 
 	<-c
 }
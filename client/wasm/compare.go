@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall/js"
+
+	"github.com/Jeffail/benthos/v3/lib/types"
+	"github.com/benthosdev/benthos-lab/lib/diff"
+)
+
+//------------------------------------------------------------------------------
+
+type batchComparison struct {
+	Input  int
+	ErrorA string
+	ErrorB string
+	Parts  []diff.PartDiff
+}
+
+func (b batchComparison) Equal() bool {
+	if b.ErrorA != b.ErrorB {
+		return false
+	}
+	for _, p := range b.Parts {
+		if !p.Equal() {
+			return false
+		}
+	}
+	return true
+}
+
+type comparison struct {
+	Batches []batchComparison
+}
+
+func (c comparison) Equal() bool {
+	for _, b := range c.Batches {
+		if !b.Equal() {
+			return false
+		}
+	}
+	return true
+}
+
+func differencesToJS(diffs []diff.Difference) []interface{} {
+	generic := make([]interface{}, len(diffs))
+	for i, d := range diffs {
+		generic[i] = map[string]interface{}{
+			"path": d.Path,
+			"kind": d.Kind,
+			"a":    d.A,
+			"b":    d.B,
+		}
+	}
+	return generic
+}
+
+func partToJS(p *diff.Part) interface{} {
+	if p == nil {
+		return nil
+	}
+	meta := map[string]interface{}{}
+	for k, v := range p.Metadata {
+		meta[k] = v
+	}
+	return map[string]interface{}{
+		"content":  string(p.Content),
+		"metadata": meta,
+	}
+}
+
+func (c comparison) toJS() map[string]interface{} {
+	batches := make([]interface{}, len(c.Batches))
+	for i, b := range c.Batches {
+		parts := make([]interface{}, len(b.Parts))
+		for j, p := range b.Parts {
+			parts[j] = map[string]interface{}{
+				"index":         p.Index,
+				"equal":         p.Equal(),
+				"json":          p.JSON,
+				"a":             partToJS(p.A),
+				"b":             partToJS(p.B),
+				"content_diff":  differencesToJS(p.Content),
+				"metadata_diff": differencesToJS(p.Metadata),
+			}
+		}
+		batches[i] = map[string]interface{}{
+			"input":    b.Input,
+			"equal":    b.Equal(),
+			"error_a":  b.ErrorA,
+			"error_b":  b.ErrorB,
+			"messages": parts,
+		}
+	}
+	return map[string]interface{}{
+		"equal":   c.Equal(),
+		"batches": batches,
+	}
+}
+
+func (c comparison) print() {
+	var total, differ int
+	for _, b := range c.Batches {
+		if b.ErrorA != b.ErrorB {
+			writeOutput(fmt.Sprintf("Input %v: errors differ: %q != %q\n", b.Input, b.ErrorA, b.ErrorB), "lintMessage")
+		}
+		for _, p := range b.Parts {
+			total++
+			if p.Equal() {
+				continue
+			}
+			differ++
+			switch {
+			case p.A == nil:
+				writeOutput(fmt.Sprintf("Input %v, message %v: only produced by B\n", b.Input, p.Index), "lintMessage")
+			case p.B == nil:
+				writeOutput(fmt.Sprintf("Input %v, message %v: only produced by A\n", b.Input, p.Index), "lintMessage")
+			}
+			for _, d := range p.Content {
+				writeOutput(fmt.Sprintf("Input %v, message %v: %v\n", b.Input, p.Index, d), "lintMessage")
+			}
+			for _, d := range p.Metadata {
+				writeOutput(fmt.Sprintf("Input %v, message %v: metadata %v\n", b.Input, p.Index, d), "lintMessage")
+			}
+		}
+	}
+	if c.Equal() {
+		writeOutput(fmt.Sprintf("Comparison: both configs produced the same %v messages.\n", total), "infoMessage")
+	} else {
+		writeOutput(fmt.Sprintf("Comparison: %v of %v messages differ.\n", differ, total), "infoMessage")
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// executeBatch sends a batch through a session and collects the results.
+func (s *streamState) executeBatch(msg types.Message) ([]types.Message, string, error) {
+	results, restore := s.collectResults()
+	defer restore()
+
+	if err := s.SendAll([]types.Message{msg.DeepCopy()}); err != nil {
+		return nil, "", err
+	}
+
+	msgs, err := results.take()
+	if err != nil {
+		return msgs, err.Error(), nil
+	}
+	return msgs, "", nil
+}
+
+// runComparison compiles two configs into their own sessions and executes the
+// same input batches through both, one batch at a time so that the results of
+// each can be aligned.
+func runComparison(configA, configB string, inputMsgs []types.Message) (comparison, error) {
+	var c comparison
+
+	sessions := []*streamState{newStreamState(js.Undefined()), newStreamState(js.Undefined())}
+	for i, contents := range []string{configA, configB} {
+		defer sessions[i].Clear()
+		name := string(rune('A' + i))
+		if _, err := sessions[i].compileConfig(contents); err != nil {
+			return c, fmt.Errorf("config %v: %w", name, err)
+		}
+		if sessions[i].Consumers() == 0 {
+			return c, fmt.Errorf("config %v: %w", name, errors.New("the pipeline has no benthos_lab inputs"))
+		}
+	}
+
+	for i, msg := range inputMsgs {
+		if msg.Len() == 0 {
+			continue
+		}
+		resA, errA, err := sessions[0].executeBatch(msg)
+		if err != nil {
+			return c, fmt.Errorf("config A: %w", err)
+		}
+		resB, errB, err := sessions[1].executeBatch(msg)
+		if err != nil {
+			return c, fmt.Errorf("config B: %w", err)
+		}
+		c.Batches = append(c.Batches, batchComparison{
+			Input:  i,
+			ErrorA: errA,
+			ErrorB: errB,
+			Parts:  diff.Parts(diff.PartsOf(resA), diff.PartsOf(resB)),
+		})
+	}
+	return c, nil
+}
+
+//------------------------------------------------------------------------------
+
+func compare(this js.Value, args []js.Value) interface{} {
+	configA, configB := args[0].String(), args[1].String()
+	inputMsgs, err := parseInput(args[2].String(), args[3].String())
+	if err != nil {
+		reportErr("failed to compare configs: %v\n", err)
+		return nil
+	}
+	var resultFunc js.Value
+	if len(args) > 4 {
+		resultFunc = args[4]
+	}
+
+	go func() {
+		defer recoverPanic(state, "compare", false)
+		c, err := runComparison(configA, configB, inputMsgs)
+		if err != nil {
+			reportErr("failed to compare configs: %v\n", err)
+			return
+		}
+		c.print()
+		if resultFunc.Type() == js.TypeFunction {
+			resultFunc.Invoke(c.toJS())
+		}
+	}()
+	return nil
+}
+
+//------------------------------------------------------------------------------
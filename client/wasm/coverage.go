@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"syscall/js"
+
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+	"github.com/benthosdev/benthos-lab/lib/probe"
+)
+
+//------------------------------------------------------------------------------
+
+// coverageState tracks the coverage of the currently compiled config.
+type coverageState struct {
+	cov     *probe.Coverage
+	confStr string
+
+	sync.Mutex
+}
+
+// reset clears the coverage by parsing the compiled config again, as the
+// config given to the stream is instrumented in place.
+func (c *coverageState) reset() {
+	conf, err := labConfig.Unmarshal(c.confStr)
+	if err != nil {
+		conf = labConfig.New()
+	}
+	c.cov.Reset(conf)
+}
+
+func (c *coverageState) Compiled(confStr string) {
+	c.Lock()
+	c.confStr = confStr
+	c.reset()
+	c.Unlock()
+}
+
+func (c *coverageState) Enable(enabled bool) {
+	c.Lock()
+	if enabled && !c.cov.Enabled() {
+		c.reset()
+	}
+	c.cov.Enable(enabled)
+	c.Unlock()
+}
+
+func (c *coverageState) Report() ([]interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	hits := c.cov.Hits()
+	paths := make([]string, len(hits))
+	for i, h := range hits {
+		paths[i] = h.Path
+	}
+	lines, err := labConfig.PathLines(c.confStr, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]interface{}, len(hits))
+	for i, h := range hits {
+		inputs := make([]interface{}, len(h.Inputs))
+		for j, index := range h.Inputs {
+			inputs[j] = index
+		}
+		entry := map[string]interface{}{
+			"path":     h.Path,
+			"type":     h.Type,
+			"label":    h.Label,
+			"batches":  h.Batches,
+			"messages": h.Messages,
+			"passed":   h.Passed,
+			"failed":   h.Failed,
+			"inputs":   inputs,
+		}
+		if line, exists := lines[h.Path]; exists {
+			entry["line"] = line
+		}
+		report[i] = entry
+	}
+	return report, nil
+}
+
+//------------------------------------------------------------------------------
+
+func setCoverage(s *streamState, args []js.Value) interface{} {
+	s.coverage.Enable(len(args) > 0 && args[0].Truthy())
+	return nil
+}
+
+func getCoverage(s *streamState, args []js.Value) interface{} {
+	report, err := s.coverage.Report()
+	if err != nil {
+		s.reportErr("failed to create coverage report: %v\n", err)
+		return nil
+	}
+	return report
+}
+
+//------------------------------------------------------------------------------
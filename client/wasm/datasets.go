@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall/js"
+
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+//------------------------------------------------------------------------------
+
+// dataset is a named input along with the method used to read it, and the name
+// of the benthos_lab input it is sent to when set.
+type dataset struct {
+	Name   string
+	Method string
+	Input  string
+	Target string
+}
+
+// datasetsFromJS parses an array of objects of the form {name, method, input,
+// target}.
+func datasetsFromJS(v js.Value) ([]dataset, error) {
+	if v.Type() != js.TypeObject || v.Get("length").Type() != js.TypeNumber {
+		return nil, errors.New("expected an array of datasets")
+	}
+	datasets := make([]dataset, v.Length())
+	for i := range datasets {
+		dV := v.Index(i)
+		if dV.Type() != js.TypeObject {
+			return nil, fmt.Errorf("dataset %v: expected an object", i)
+		}
+		d := dataset{Name: fmt.Sprintf("dataset %v", i), Method: "batches"}
+		if nV := dV.Get("name"); nV.Type() == js.TypeString && len(nV.String()) > 0 {
+			d.Name = nV.String()
+		}
+		if mV := dV.Get("method"); mV.Type() == js.TypeString && len(mV.String()) > 0 {
+			d.Method = mV.String()
+		}
+		if iV := dV.Get("input"); iV.Type() == js.TypeString {
+			d.Input = iV.String()
+		}
+		if tV := dV.Get("target"); tV.Type() == js.TypeString {
+			d.Target = tV.String()
+		}
+		datasets[i] = d
+	}
+	return datasets, nil
+}
+
+// datasetResult contains the outputs of executing a single dataset.
+type datasetResult struct {
+	Name    string
+	Outputs []types.Message
+	Errors  []string
+	Err     error
+}
+
+func (d datasetResult) toJS() map[string]interface{} {
+	outputs := make([]interface{}, len(d.Outputs))
+	for i, m := range d.Outputs {
+		outputs[i] = batchToJS(m)
+	}
+	errs := make([]interface{}, len(d.Errors))
+	for i, e := range d.Errors {
+		errs[i] = e
+	}
+	res := map[string]interface{}{
+		"name":    d.Name,
+		"outputs": outputs,
+		"errors":  errs,
+	}
+	if d.Err != nil {
+		res["error"] = d.Err.Error()
+	}
+	return res
+}
+
+func datasetResultsToJS(results []datasetResult) []interface{} {
+	generic := make([]interface{}, len(results))
+	for i, r := range results {
+		generic[i] = r.toJS()
+	}
+	return generic
+}
+
+//------------------------------------------------------------------------------
+
+// runDatasets executes each dataset in turn through the compiled pipeline,
+// printing the outputs of each under its name. Execution stops early only when
+// cancelled or when the pipeline is replaced.
+func (s *streamState) runDatasets(datasets []dataset) ([]datasetResult, error) {
+	var resMut sync.Mutex
+	var current *datasetResult
+	var prevResults func([]types.Message, error)
+
+	resMut.Lock()
+	prevResults = s.SetResultsFunc(func(msgs []types.Message, err error) {
+		resMut.Lock()
+		prev := prevResults
+		resMut.Unlock()
+		prev(msgs, err)
+
+		resMut.Lock()
+		defer resMut.Unlock()
+		if current == nil {
+			return
+		}
+		if err != nil {
+			current.Errors = append(current.Errors, err.Error())
+			return
+		}
+		current.Outputs = append(current.Outputs, msgs...)
+	})
+	resMut.Unlock()
+	defer s.SetResultsFunc(prevResults)
+
+	results := make([]datasetResult, 0, len(datasets))
+	for _, d := range datasets {
+		s.writeOutput(fmt.Sprintf("Dataset '%v':\n", d.Name), "infoMessage")
+
+		res := &datasetResult{Name: d.Name}
+		resMut.Lock()
+		current = res
+		resMut.Unlock()
+
+		inputMsgs, err := parseInput(d.Method, d.Input)
+		if err != nil {
+			res.Err = err
+			s.reportErr("failed to dispatch message: %v\n", err)
+		} else if countParts(inputMsgs) == 0 {
+			s.writeOutput("Dataset contains no messages.\n", "infoMessage")
+		} else if err = s.SendTo(d.Target, inputMsgs); err != nil {
+			res.Err = err
+			s.handleExecutionErr(err)
+		}
+
+		resMut.Lock()
+		current = nil
+		resMut.Unlock()
+
+		results = append(results, *res)
+		if err == errExecutionCancelled || err == errPipelineReplaced {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func countParts(msgs []types.Message) int {
+	total := 0
+	for _, m := range msgs {
+		total += m.Len()
+	}
+	return total
+}
+
+//------------------------------------------------------------------------------
+
+// datasetArgs parses the datasets argument of runAll.
+func datasetArgs(args []js.Value) ([]dataset, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected an array of datasets")
+	}
+	return datasetsFromJS(args[0])
+}
+
+func runAll(s *streamState, args []js.Value) interface{} {
+	datasets, err := datasetArgs(args)
+	if err != nil {
+		s.reportRunErr("datasets", err)
+		return nil
+	}
+	var resultFunc js.Value
+	if len(args) > 1 {
+		resultFunc = args[1]
+	}
+
+	go reportUsage("execute/success")
+	go func() {
+		defer recoverPanic(s, "runAll", true)
+		results, _ := s.runDatasets(datasets)
+		if resultFunc.Type() == js.TypeFunction {
+			resultFunc.Invoke(datasetResultsToJS(results))
+		}
+	}()
+	return nil
+}
+
+//------------------------------------------------------------------------------
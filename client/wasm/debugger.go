@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/types"
+	"github.com/benthosdev/benthos-lab/lib/connectors"
+	"github.com/benthosdev/benthos-lab/lib/probe"
+)
+
+//------------------------------------------------------------------------------
+
+var errDebugAborted = errors.New("execution aborted by debugger")
+
+type debugCommand int
+
+const (
+	debugStep debugCommand = iota
+	debugContinue
+	debugAbort
+)
+
+type debugPause struct {
+	info   probe.Info
+	msg    types.Message
+	resume chan debugCommand
+}
+
+// debugger implements probe.Hooks in order to pause execution at breakpoints
+// and expose the in-flight batch to the user.
+type debugger struct {
+	sess        *streamState
+	breakpoints map[string]struct{}
+	stepping    bool
+	suspended   bool
+	paused      *debugPause
+
+	// Only one batch may be paused at a time.
+	pauseMut sync.Mutex
+
+	sync.Mutex
+}
+
+func newDebugger(sess *streamState) *debugger {
+	return &debugger{
+		sess:        sess,
+		breakpoints: map[string]struct{}{},
+	}
+}
+
+func (d *debugger) shouldBreak(info probe.Info) bool {
+	d.Lock()
+	defer d.Unlock()
+	if d.suspended {
+		return false
+	}
+	if d.stepping {
+		return true
+	}
+	if _, exists := d.breakpoints[info.Path]; exists {
+		return true
+	}
+	if len(info.Label) > 0 {
+		if _, exists := d.breakpoints[info.Label]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *debugger) Before(info probe.Info, msg types.Message) (types.Message, error) {
+	if !d.shouldBreak(info) {
+		return msg, nil
+	}
+
+	d.pauseMut.Lock()
+	defer d.pauseMut.Unlock()
+
+	pause := &debugPause{
+		info:   info,
+		msg:    msg,
+		resume: make(chan debugCommand, 1),
+	}
+	d.Lock()
+	d.paused = pause
+	d.Unlock()
+
+	d.sess.writeOutput(fmt.Sprintf("Paused before processor '%v' (%v).\n", info.Path, info.Type), "infoMessage")
+	if onBreak := d.sess.callback("onBreak"); onBreak.Type() == js.TypeFunction {
+		onBreak.Invoke(d.state())
+	}
+
+	cmd := <-pause.resume
+
+	d.Lock()
+	defer d.Unlock()
+	d.paused = nil
+	switch cmd {
+	case debugStep:
+		d.stepping = true
+	case debugContinue:
+		d.stepping = false
+	case debugAbort:
+		d.stepping = false
+		return nil, errDebugAborted
+	}
+	return pause.msg, nil
+}
+
+func (d *debugger) After(probe.Info, []types.Message, types.Response, time.Duration) {}
+
+// Paused returns true if a batch is currently held at a breakpoint.
+func (d *debugger) Paused() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.paused != nil
+}
+
+// Resume releases a paused batch with a command, returning an error if there
+// isn't one.
+func (d *debugger) Resume(cmd debugCommand) error {
+	d.Lock()
+	defer d.Unlock()
+	if d.paused == nil {
+		return errors.New("execution is not paused")
+	}
+	select {
+	case d.paused.resume <- cmd:
+	default:
+	}
+	return nil
+}
+
+// Reset aborts any paused batch and stops stepping, breakpoints are kept.
+func (d *debugger) Reset() {
+	d.Lock()
+	d.stepping = false
+	if d.paused != nil {
+		select {
+		case d.paused.resume <- debugAbort:
+		default:
+		}
+	}
+	d.Unlock()
+}
+
+// Suspend prevents breakpoints from pausing execution until resumed.
+func (d *debugger) Suspend(suspended bool) {
+	d.Lock()
+	d.suspended = suspended
+	d.Unlock()
+}
+
+func (d *debugger) SetBreakpoints(points []string) {
+	d.Lock()
+	d.breakpoints = map[string]struct{}{}
+	for _, p := range points {
+		d.breakpoints[p] = struct{}{}
+	}
+	d.Unlock()
+}
+
+func (d *debugger) SetBatch(msg types.Message) error {
+	d.Lock()
+	defer d.Unlock()
+	if d.paused == nil {
+		return errors.New("execution is not paused")
+	}
+	if d.paused.msg.Len() == 0 {
+		d.paused.msg = msg
+		return nil
+	}
+
+	// The context of the original batch carries the result store of the lab
+	// input and must therefore survive edits.
+	ctx := message.GetContext(d.paused.msg.Get(0))
+	edited := message.New(nil)
+	msg.Iter(func(i int, p types.Part) error {
+		edited.Append(message.WithContext(ctx, p))
+		return nil
+	})
+	d.paused.msg = edited
+	return nil
+}
+
+func (d *debugger) state() interface{} {
+	d.Lock()
+	defer d.Unlock()
+	if d.paused == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"path":  d.paused.info.Path,
+		"label": d.paused.info.Label,
+		"type":  d.paused.info.Type,
+		"batch": batchToJS(d.paused.msg),
+	}
+}
+
+//------------------------------------------------------------------------------
+
+func batchToJS(msg types.Message) []interface{} {
+	parts := make([]interface{}, msg.Len())
+	msg.Iter(func(i int, p types.Part) error {
+		meta := map[string]interface{}{}
+		p.Metadata().Iter(func(k, v string) error {
+			meta[k] = v
+			return nil
+		})
+		part := map[string]interface{}{
+			"content":  string(p.Get()),
+			"metadata": meta,
+		}
+		if label, ok := connectors.OutputLabel(p); ok {
+			part["output"] = label
+		}
+		if fields := connectors.OutputFields(p); len(fields) > 0 {
+			generic := make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				generic[k] = v
+			}
+			part["fields"] = generic
+		}
+		parts[i] = part
+		return nil
+	})
+	return parts
+}
+
+// batchFromJS parses an array of parts, where each part is either a string or
+// an object of the form {content: "", metadata: {}}.
+func batchFromJS(v js.Value) (types.Message, error) {
+	if v.Type() != js.TypeObject || v.Get("length").Type() != js.TypeNumber {
+		return nil, errors.New("expected an array of message parts")
+	}
+	msg := message.New(nil)
+	for i := 0; i < v.Length(); i++ {
+		pV := v.Index(i)
+		if pV.Type() == js.TypeString {
+			msg.Append(message.NewPart([]byte(pV.String())))
+			continue
+		}
+		if pV.Type() != js.TypeObject {
+			return nil, fmt.Errorf("message part %v: expected a string or object", i)
+		}
+		part := message.NewPart([]byte(pV.Get("content").String()))
+		if metaV := pV.Get("metadata"); metaV.Type() == js.TypeObject {
+			keys := js.Global().Get("Object").Call("keys", metaV)
+			for j := 0; j < keys.Length(); j++ {
+				k := keys.Index(j).String()
+				part.Metadata().Set(k, metaV.Get(k).String())
+			}
+		}
+		msg.Append(part)
+	}
+	return msg, nil
+}
+
+//------------------------------------------------------------------------------
+
+func setBreakpoints(s *streamState, args []js.Value) interface{} {
+	var points []string
+	if len(args) > 0 && args[0].Type() == js.TypeObject {
+		for i := 0; i < args[0].Length(); i++ {
+			v := args[0].Index(i)
+			if v.Type() == js.TypeNumber {
+				// A plain number refers to the index of a pipeline processor.
+				points = append(points, "pipeline.processors."+strconv.Itoa(v.Int()))
+			} else {
+				points = append(points, v.String())
+			}
+		}
+	}
+	s.debugger.SetBreakpoints(points)
+	return nil
+}
+
+func debugState(s *streamState, args []js.Value) interface{} {
+	return s.debugger.state()
+}
+
+func debugSetBatch(s *streamState, args []js.Value) interface{} {
+	if len(args) == 0 {
+		s.reportErr("failed to edit batch: %v\n", errors.New("expected an array of message parts"))
+		return nil
+	}
+	msg, err := batchFromJS(args[0])
+	if err != nil {
+		s.reportErr("failed to edit batch: %v\n", err)
+		return nil
+	}
+	if err = s.debugger.SetBatch(msg); err != nil {
+		s.reportErr("failed to edit batch: %v\n", err)
+	}
+	return nil
+}
+
+func makeDebugResume(cmd debugCommand) sessionFunc {
+	return func(s *streamState, args []js.Value) interface{} {
+		if err := s.debugger.Resume(cmd); err != nil {
+			s.reportErr("failed to resume: %v\n", err)
+		}
+		return nil
+	}
+}
+
+//------------------------------------------------------------------------------
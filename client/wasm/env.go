@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"syscall/js"
+
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+)
+
+//------------------------------------------------------------------------------
+
+// envFromJS parses an object of variable names mapped to their values.
+func envFromJS(v js.Value) (map[string]string, error) {
+	if v.Type() != js.TypeObject {
+		return nil, errors.New("expected an object of environment variables")
+	}
+	env := map[string]string{}
+	keys := js.Global().Get("Object").Call("keys", v)
+	for i := 0; i < keys.Length(); i++ {
+		k := keys.Index(i).String()
+		env[k] = v.Get(k).String()
+	}
+	return env, nil
+}
+
+func envVarsToJS(vars []labConfig.EnvVar) []interface{} {
+	generic := make([]interface{}, len(vars))
+	for i, v := range vars {
+		lines := make([]interface{}, len(v.Lines))
+		for j, l := range v.Lines {
+			lines[j] = l
+		}
+		envVar := map[string]interface{}{
+			"name":  v.Name,
+			"value": v.Value,
+			"set":   v.Set,
+			"lines": lines,
+		}
+		if v.HasDefault {
+			envVar["default"] = v.Default
+		}
+		generic[i] = envVar
+	}
+	return generic
+}
+
+// envPreview returns the environment variables referenced by a config,
+// resolved against the environment of a session, along with the interpolated
+// config that would be compiled.
+func envPreview(s *streamState, contents string) map[string]interface{} {
+	env := s.Env()
+	return map[string]interface{}{
+		"variables": envVarsToJS(labConfig.EnvVars(contents, env)),
+		"config":    labConfig.ReplaceEnvVars(contents, env),
+	}
+}
+
+//------------------------------------------------------------------------------
+
+func setEnv(s *streamState, args []js.Value) interface{} {
+	var env map[string]string
+	if len(args) > 0 && args[0].Type() != js.TypeUndefined && args[0].Type() != js.TypeNull {
+		var err error
+		if env, err = envFromJS(args[0]); err != nil {
+			s.reportErr("failed to set environment: %v\n", err)
+			return nil
+		}
+	}
+	s.SetEnv(env)
+	return nil
+}
+
+func getEnv(s *streamState, args []js.Value) interface{} {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		s.reportErr("failed to preview environment: %v\n", errors.New("expected a config"))
+		return nil
+	}
+	return envPreview(s, args[0].String())
+}
+
+//------------------------------------------------------------------------------
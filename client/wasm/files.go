@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall/js"
+	"unicode/utf8"
+)
+
+//------------------------------------------------------------------------------
+
+// fixture is a file seeded into the filesystem before a pipeline runs.
+type fixture struct {
+	Path    string
+	Content []byte
+}
+
+// The filesystem is shared by all sessions, and so are its fixtures.
+var fixtures = struct {
+	files map[string][]byte
+	sync.Mutex
+}{}
+
+var errNoMemFS = errors.New("the in-memory filesystem is not installed")
+
+// memFSInstalled returns true if the filesystem used by the runtime is the
+// in-memory one of labfs.js, files are never written or removed otherwise.
+func memFSInstalled() bool {
+	labFS := js.Global().Get("labFS")
+	return labFS.Type() == js.TypeObject && labFS.Get("fs").Equal(js.Global().Get("fs"))
+}
+
+// resetFiles removes everything from the filesystem and then writes the
+// fixtures to it.
+func resetFiles(files []fixture) error {
+	if !memFSInstalled() {
+		return errNoMemFS
+	}
+
+	entries, err := ioutil.ReadDir("/")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = os.RemoveAll(path.Join("/", e.Name())); err != nil {
+			return err
+		}
+	}
+
+	seeded := make(map[string][]byte, len(files))
+	for _, f := range files {
+		p := path.Clean("/" + f.Path)
+		if err = os.MkdirAll(path.Dir(p), 0755); err != nil {
+			return fmt.Errorf("file '%v': %w", f.Path, err)
+		}
+		if err = ioutil.WriteFile(p, f.Content, 0644); err != nil {
+			return fmt.Errorf("file '%v': %w", f.Path, err)
+		}
+		seeded[p] = f.Content
+	}
+
+	fixtures.Lock()
+	fixtures.files = seeded
+	fixtures.Unlock()
+	return nil
+}
+
+// labFile is a file of the filesystem, which is written when it isn't an
+// unmodified fixture.
+type labFile struct {
+	Path    string
+	Content []byte
+	Fixture bool
+	Written bool
+}
+
+func listFiles() ([]labFile, error) {
+	if !memFSInstalled() {
+		return nil, errNoMemFS
+	}
+
+	fixtures.Lock()
+	seeded := fixtures.files
+	fixtures.Unlock()
+
+	var files []labFile
+	err := filepath.Walk("/", func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		original, isFixture := seeded[p]
+		files = append(files, labFile{
+			Path:    p,
+			Content: content,
+			Fixture: isFixture,
+			Written: !isFixture || string(original) != string(content),
+		})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, err
+}
+
+//------------------------------------------------------------------------------
+
+// fixturesFromJS parses an array of objects of the form {path, content}, where
+// binary content is given as base64 with the field base64 instead.
+func fixturesFromJS(v js.Value) ([]fixture, error) {
+	if v.Type() != js.TypeObject || v.Get("length").Type() != js.TypeNumber {
+		return nil, errors.New("expected an array of files")
+	}
+	files := make([]fixture, v.Length())
+	for i := range files {
+		fV := v.Index(i)
+		if fV.Type() != js.TypeObject {
+			return nil, fmt.Errorf("file %v: expected an object", i)
+		}
+		pV := fV.Get("path")
+		if pV.Type() != js.TypeString || len(pV.String()) == 0 {
+			return nil, fmt.Errorf("file %v: expected a path", i)
+		}
+		f := fixture{Path: pV.String()}
+		if bV := fV.Get("base64"); bV.Type() == js.TypeString {
+			var err error
+			if f.Content, err = base64.StdEncoding.DecodeString(bV.String()); err != nil {
+				return nil, fmt.Errorf("file '%v': %w", f.Path, err)
+			}
+		} else if cV := fV.Get("content"); cV.Type() == js.TypeString {
+			f.Content = []byte(cV.String())
+		}
+		files[i] = f
+	}
+	return files, nil
+}
+
+func filesToJS(files []labFile) []interface{} {
+	generic := make([]interface{}, len(files))
+	for i, f := range files {
+		file := map[string]interface{}{
+			"path":    f.Path,
+			"size":    len(f.Content),
+			"fixture": f.Fixture,
+			"written": f.Written,
+		}
+		if utf8.Valid(f.Content) {
+			file["content"] = string(f.Content)
+		} else {
+			file["base64"] = base64.StdEncoding.EncodeToString(f.Content)
+		}
+		generic[i] = file
+	}
+	return generic
+}
+
+//------------------------------------------------------------------------------
+
+func setFiles(this js.Value, args []js.Value) interface{} {
+	var files []fixture
+	if len(args) > 0 && args[0].Type() != js.TypeUndefined && args[0].Type() != js.TypeNull {
+		var err error
+		if files, err = fixturesFromJS(args[0]); err != nil {
+			reportErr("failed to set files: %v\n", err)
+			return nil
+		}
+	}
+	if err := resetFiles(files); err != nil {
+		reportErr("failed to set files: %v\n", err)
+	}
+	return nil
+}
+
+func getFiles(this js.Value, args []js.Value) interface{} {
+	files, err := listFiles()
+	if err != nil {
+		reportErr("failed to list files: %v\n", err)
+		return nil
+	}
+	return filesToJS(files)
+}
+
+//------------------------------------------------------------------------------
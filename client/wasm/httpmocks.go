@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"syscall/js"
+
+	"github.com/benthosdev/benthos-lab/lib/httpmock"
+)
+
+//------------------------------------------------------------------------------
+
+// The transport used before mocks were installed, which usage reports are
+// sent with so that they're never mocked or recorded.
+var realTransport = http.DefaultTransport
+
+var usageClient = &http.Client{Transport: realTransport}
+
+// executing is the list of sessions currently executing a pipeline, in the
+// order that they started.
+var executing = struct {
+	sessions []*streamState
+	sync.Mutex
+}{}
+
+func startExecuting(s *streamState) {
+	executing.Lock()
+	executing.sessions = append(executing.sessions, s)
+	executing.Unlock()
+}
+
+func stopExecuting(s *streamState) {
+	executing.Lock()
+	for i, e := range executing.sessions {
+		if e == s {
+			executing.sessions = append(executing.sessions[:i], executing.sessions[i+1:]...)
+			break
+		}
+	}
+	executing.Unlock()
+}
+
+// mockTables returns the mock tables that a request is matched against.
+// Requests made by a pipeline can't be traced back to the session that
+// executed it, and so the tables of all executing sessions are tried followed
+// by the default session, which also receives the requests of internal
+// sessions such as comparisons and benchmarks.
+func mockTables() []*httpmock.Table {
+	executing.Lock()
+	defer executing.Unlock()
+
+	tables := make([]*httpmock.Table, 0, len(executing.sessions)+1)
+	for _, s := range executing.sessions {
+		if s != state {
+			tables = append(tables, s.httpMocks)
+		}
+	}
+	return append(tables, state.httpMocks)
+}
+
+// installHTTPMocks replaces the default transport, which is used by the HTTP
+// components of Benthos unless TLS or a proxy is configured.
+func installHTTPMocks() func() {
+	http.DefaultTransport = &httpmock.Transport{
+		Tables:   mockTables,
+		Fallback: realTransport,
+	}
+	return func() {
+		http.DefaultTransport = realTransport
+	}
+}
+
+// newHTTPMocks creates the mock table of a session, which prints each request
+// as it is recorded.
+func newHTTPMocks(s *streamState) *httpmock.Table {
+	t := httpmock.NewTable()
+	t.SetObserver(func(r httpmock.Request) {
+		outcome := fmt.Sprintf("%v", r.Status)
+		if len(r.Error) > 0 {
+			outcome = r.Error
+		}
+		if r.Mocked {
+			outcome += " (mocked)"
+		}
+		s.writeOutput(fmt.Sprintf("HTTP request: %v %v -> %v\n", r.Method, r.URL, outcome), "infoMessage")
+	})
+	return t
+}
+
+//------------------------------------------------------------------------------
+
+// httpMocksFromJS parses an array of objects of the form {method, url, status,
+// headers, body}.
+func httpMocksFromJS(v js.Value) ([]httpmock.Rule, error) {
+	if v.Type() != js.TypeObject || v.Get("length").Type() != js.TypeNumber {
+		return nil, errors.New("expected an array of mocks")
+	}
+	rules := make([]httpmock.Rule, v.Length())
+	for i := range rules {
+		rV := v.Index(i)
+		if rV.Type() != js.TypeObject {
+			return nil, fmt.Errorf("mock %v: expected an object", i)
+		}
+		r := httpmock.Rule{URL: "*"}
+		if mV := rV.Get("method"); mV.Type() == js.TypeString {
+			r.Method = mV.String()
+		}
+		if uV := rV.Get("url"); uV.Type() == js.TypeString && len(uV.String()) > 0 {
+			r.URL = uV.String()
+		}
+		if sV := rV.Get("status"); sV.Type() == js.TypeNumber {
+			r.Status = sV.Int()
+		}
+		if bV := rV.Get("body"); bV.Type() == js.TypeString {
+			r.Body = bV.String()
+		}
+		if hV := rV.Get("headers"); hV.Type() == js.TypeObject {
+			r.Headers = map[string]string{}
+			keys := js.Global().Get("Object").Call("keys", hV)
+			for j := 0; j < keys.Length(); j++ {
+				k := keys.Index(j).String()
+				r.Headers[k] = hV.Get(k).String()
+			}
+		}
+		rules[i] = r
+	}
+	return rules, nil
+}
+
+func httpRequestsToJS(requests []httpmock.Request) []interface{} {
+	generic := make([]interface{}, len(requests))
+	for i, r := range requests {
+		headers := make(map[string]interface{}, len(r.Headers))
+		for k, v := range r.Headers {
+			headers[k] = v
+		}
+		req := map[string]interface{}{
+			"method":  r.Method,
+			"url":     r.URL,
+			"headers": headers,
+			"body":    r.Body,
+			"mocked":  r.Mocked,
+			"status":  r.Status,
+		}
+		if len(r.Error) > 0 {
+			req["error"] = r.Error
+		}
+		generic[i] = req
+	}
+	return generic
+}
+
+//------------------------------------------------------------------------------
+
+// setHTTPMocks sets the mock rules of a session. Benthos creates the HTTP
+// clients of its components itself and they all send requests with the default
+// transport, so a request can't be tied to the session that made it. Mocks are
+// therefore shared while several sessions execute at once: a request is served
+// by the first executing session with a matching rule, and the default session
+// is tried last.
+func setHTTPMocks(s *streamState, args []js.Value) interface{} {
+	var rules []httpmock.Rule
+	if len(args) > 0 && args[0].Type() != js.TypeUndefined && args[0].Type() != js.TypeNull {
+		var err error
+		if rules, err = httpMocksFromJS(args[0]); err != nil {
+			s.reportErr("failed to set HTTP mocks: %v\n", err)
+			return nil
+		}
+	}
+	if err := s.httpMocks.SetRules(rules); err != nil {
+		s.reportErr("failed to set HTTP mocks: %v\n", err)
+	}
+	return nil
+}
+
+func getHTTPRequests(s *streamState, args []js.Value) interface{} {
+	return httpRequestsToJS(s.httpMocks.Requests())
+}
+
+//------------------------------------------------------------------------------
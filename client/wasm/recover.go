@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"syscall/js"
+
+	"github.com/benthosdev/benthos-lab/lib/probe"
+)
+
+//------------------------------------------------------------------------------
+
+var errProcessorPanicked = errors.New("a processor panicked during execution")
+
+// labPanic describes a recovered panic, either from a lab function or from a
+// processor within the pipeline.
+type labPanic struct {
+	Function string
+	Path     string
+	Label    string
+	Type     string
+	Value    string
+	Stack    string
+}
+
+func (p labPanic) toJS() map[string]interface{} {
+	return map[string]interface{}{
+		"function": p.Function,
+		"path":     p.Path,
+		"label":    p.Label,
+		"type":     p.Type,
+		"error":    p.Value,
+		"stack":    p.Stack,
+	}
+}
+
+// reportPanic writes a recovered panic to the output of a session and invokes
+// its onPanic function with it when defined.
+func (s *streamState) reportPanic(p labPanic) {
+	where := fmt.Sprintf("lab function '%v'", p.Function)
+	if len(p.Path) > 0 {
+		where = fmt.Sprintf("processor '%v' (%v)", p.Path, p.Type)
+	}
+	s.writeOutput(fmt.Sprintf("Panic: %v: %v\n%v\n", where, p.Value, p.Stack), "errorMessage")
+	if onPanic := s.callback("onPanic"); onPanic.Type() == js.TypeFunction {
+		onPanic.Invoke(p.toJS())
+	}
+}
+
+// reportProcessorPanic reports a panic recovered by a probe.
+func (s *streamState) reportProcessorPanic(perr *probe.PanicError) {
+	s.reportPanic(labPanic{
+		Path:  perr.Info.Path,
+		Label: perr.Info.Label,
+		Type:  perr.Info.Type,
+		Value: fmt.Sprint(perr.Value),
+		Stack: string(perr.Stack),
+	})
+}
+
+// resetOnPanic contains the lab functions that drive the stream, a panic
+// within these results in the runtime being rebuilt.
+var resetOnPanic = map[string]bool{
+	"compile":   true,
+	"execute":   true,
+	"runAll":    true,
+	"benchmark": true,
+}
+
+// recoverPanic must be deferred, it recovers a panic from a lab function or
+// goroutine and reports it. When reset is true the runtime is rebuilt as the
+// stream may have been left in a broken state.
+func recoverPanic(s *streamState, function string, reset bool) {
+	if r := recover(); r != nil {
+		handlePanic(s, function, r, reset)
+	}
+}
+
+func handlePanic(s *streamState, function string, r interface{}, reset bool) {
+	s.reportPanic(labPanic{
+		Function: function,
+		Value:    fmt.Sprint(r),
+		Stack:    string(debug.Stack()),
+	})
+	if reset {
+		go s.resetRuntime()
+	}
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"syscall/js"
+
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+	"github.com/benthosdev/benthos-lab/lib/diff"
+)
+
+//------------------------------------------------------------------------------
+
+// editConfig applies an edit to a config, keeping the comments and formatting
+// of everything the edit doesn't touch.
+func editConfig(contents string, edit func(*labConfig.Document) error) (string, error) {
+	doc, err := labConfig.ParseDocument(contents)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal current config: %w", err)
+	}
+	if err = edit(doc); err != nil {
+		return "", err
+	}
+	resultBytes, err := doc.Bytes()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	return string(resultBytes), nil
+}
+
+// componentPath accepts either the YAML path of a component or the index of a
+// pipeline processor.
+func componentPath(v js.Value) (string, error) {
+	switch v.Type() {
+	case js.TypeString:
+		return v.String(), nil
+	case js.TypeNumber:
+		return "pipeline.processors." + strconv.Itoa(v.Int()), nil
+	}
+	return "", errors.New("expected a path to a component")
+}
+
+func removeComponent(path, contents string) (string, error) {
+	return editConfig(contents, func(doc *labConfig.Document) error {
+		if err := doc.Remove(path); err != nil {
+			return fmt.Errorf("Failed to remove component: %w", err)
+		}
+		return nil
+	})
+}
+
+func moveComponent(path string, index int, contents string) (string, error) {
+	return editConfig(contents, func(doc *labConfig.Document) error {
+		if err := doc.Move(path, index); err != nil {
+			return fmt.Errorf("Failed to move component: %w", err)
+		}
+		return nil
+	})
+}
+
+func replaceComponent(path, cType, contents string) (string, error) {
+	return editConfig(contents, func(doc *labConfig.Document) error {
+		if err := doc.Replace(path, cType); err != nil {
+			return fmt.Errorf("Failed to replace component: %w", err)
+		}
+		return nil
+	})
+}
+
+func wrapProcessor(path, wrapper, contents string) (string, error) {
+	return editConfig(contents, func(doc *labConfig.Document) error {
+		if err := doc.Wrap(path, wrapper); err != nil {
+			return fmt.Errorf("Failed to wrap processor: %w", err)
+		}
+		return nil
+	})
+}
+
+// componentAt returns the path and kind of the innermost component spanning a
+// line of a config, or nil if there isn't one.
+func componentAt(line int, contents string) (interface{}, error) {
+	doc, err := labConfig.ParseDocument(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal current config: %w", err)
+	}
+	path, kind, err := doc.ComponentAt(line)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse current config: %w", err)
+	}
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return map[string]interface{}{"path": path, "kind": kind}, nil
+}
+
+// upgradeConfig rewrites the deprecated components of a config, returning the
+// result along with each upgrade and a line diff of the config before and
+// after.
+func upgradeConfig(contents string) (interface{}, error) {
+	result, upgrades, err := labConfig.UpgradeConfig(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to upgrade config: %w", err)
+	}
+	upgradesJS := make([]interface{}, len(upgrades))
+	for i, u := range upgrades {
+		upgradesJS[i] = map[string]interface{}{
+			"path":     u.Path,
+			"from":     u.From,
+			"to":       u.To,
+			"reason":   u.Reason,
+			"warning":  u.Warning,
+			"upgraded": u.Upgraded(),
+		}
+	}
+	var diffJS []interface{}
+	for _, l := range diff.Lines(contents, result) {
+		diffJS = append(diffJS, l.String())
+	}
+	return map[string]interface{}{
+		"config":   result,
+		"upgrades": upgradesJS,
+		"diff":     diffJS,
+	}, nil
+}
+
+// migrateConfig migrates a config to the syntax of Benthos v4, returning the
+// result along with any follow-ups and the lines of a diff against the original.
+func migrateConfig(contents string) (interface{}, error) {
+	result, followUps, err := labConfig.MigrateConfigV4(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to migrate config: %w", err)
+	}
+	followUpsJS := make([]interface{}, len(followUps))
+	for i, f := range followUps {
+		followUpsJS[i] = map[string]interface{}{
+			"path":    f.Path,
+			"message": f.Message,
+		}
+	}
+	var diffJS []interface{}
+	for _, l := range diff.Lines(contents, result) {
+		diffJS = append(diffJS, l.String())
+	}
+	return map[string]interface{}{
+		"config":    result,
+		"followUps": followUpsJS,
+		"diff":      diffJS,
+	}, nil
+}
+
+//------------------------------------------------------------------------------
+
+// refactorArgs parses the arguments of a refactor function, which are a
+// component path, any number of parameters and finally the config.
+func refactorArgs(args []js.Value, params int) (string, []js.Value, string, error) {
+	if len(args) != params+2 {
+		return "", nil, "", fmt.Errorf("expected %v arguments", params+2)
+	}
+	path, err := componentPath(args[0])
+	if err != nil {
+		return "", nil, "", err
+	}
+	contents, err := argString(args, params+1)
+	if err != nil {
+		return "", nil, "", err
+	}
+	return path, args[1 : params+1], contents, nil
+}
+
+var refactorHandlers = map[string]workerHandler{
+	"removeComponent": func(args []js.Value) (interface{}, error) {
+		path, _, contents, err := refactorArgs(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return removeComponent(path, contents)
+	},
+	"moveComponent": func(args []js.Value) (interface{}, error) {
+		path, params, contents, err := refactorArgs(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if params[0].Type() != js.TypeNumber {
+			return nil, errors.New("expected a number for argument 1")
+		}
+		return moveComponent(path, params[0].Int(), contents)
+	},
+	"replaceComponent": func(args []js.Value) (interface{}, error) {
+		path, _, contents, err := refactorArgs(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		cType, err := argString(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return replaceComponent(path, cType, contents)
+	},
+	"wrapProcessor": func(args []js.Value) (interface{}, error) {
+		path, _, contents, err := refactorArgs(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		wrapper, err := argString(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return wrapProcessor(path, wrapper, contents)
+	},
+	"upgradeConfig": func(args []js.Value) (interface{}, error) {
+		contents, err := argString(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return upgradeConfig(contents)
+	},
+	"migrateConfig": func(args []js.Value) (interface{}, error) {
+		contents, err := argString(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return migrateConfig(contents)
+	},
+	"componentAt": func(args []js.Value) (interface{}, error) {
+		if len(args) != 2 || args[0].Type() != js.TypeNumber {
+			return nil, errors.New("expected a line number for argument 0")
+		}
+		contents, err := argString(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return componentAt(args[0].Int(), contents)
+	},
+}
+
+// makeRefactorFunction adapts a refactor handler into a lab function, which
+// reports its own errors.
+func makeRefactorFunction(name string) func(this js.Value, args []js.Value) interface{} {
+	handler := refactorHandlers[name]
+	return func(this js.Value, args []js.Value) interface{} {
+		result, err := handler(args)
+		if err != nil {
+			reportErr("%v\n", err)
+			return nil
+		}
+		return result
+	}
+}
+
+//------------------------------------------------------------------------------
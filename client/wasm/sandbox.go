@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"syscall/js"
+
+	"github.com/Jeffail/benthos/v3/lib/bloblang"
+	"github.com/Jeffail/benthos/v3/lib/config"
+	"github.com/Jeffail/benthos/v3/lib/input"
+	"github.com/Jeffail/benthos/v3/lib/output"
+	"github.com/Jeffail/benthos/v3/lib/types"
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+)
+
+//------------------------------------------------------------------------------
+
+// sandboxConfig determines which components of a config are swapped for lab
+// connectors when it is compiled, the config text itself is left untouched.
+type sandboxConfig struct {
+	Outputs bool
+	Inputs  bool
+}
+
+// Components composed of other components are left in place, as are those that
+// reference resources, which are swapped themselves.
+var (
+	sandboxKeepInputs = map[string]bool{
+		"benthos_lab":       true,
+		input.TypeBroker:    true,
+		input.TypeDynamic:   true,
+		input.TypeReadUntil: true,
+		input.TypeResource:  true,
+		input.TypeSequence:  true,
+	}
+	sandboxKeepOutputs = map[string]bool{
+		"benthos_lab":       true,
+		output.TypeBroker:   true,
+		output.TypeDynamic:  true,
+		output.TypeResource: true,
+		output.TypeRetry:    true,
+		output.TypeSwitch:   true,
+		output.TypeTry:      true,
+	}
+)
+
+// sandbox swaps the outputs of a config, and optionally the inputs, for lab
+// connectors. Outputs are replaced with benthos_lab outputs that record the
+// batches they would have received, labelled with the original output, along
+// with any interpolated fields such as topics, keys, paths and headers. Inputs
+// are replaced with benthos_lab inputs named after the original input.
+func sandbox(conf *config.Type, opts sandboxConfig) error {
+	var err error
+	if opts.Outputs {
+		labConfig.WalkOutputs(conf, func(path string, c *output.Config) {
+			if err != nil || sandboxKeepOutputs[c.Type] {
+				return
+			}
+			var exprs map[string]string
+			if exprs, err = labConfig.InterpolatedFields(*c); err != nil {
+				err = fmt.Errorf("output %v: %w", path, err)
+				return
+			}
+			lConf := labOutputConfig{
+				Label:  fmt.Sprintf("%v (%v)", labelOrPath(c.Label, path), c.Type),
+				fields: map[string]bloblang.Field{},
+			}
+			for k, expr := range exprs {
+				if lConf.fields[k], err = bloblang.NewField(expr); err != nil {
+					err = fmt.Errorf("output %v: field %v: %w", path, k, err)
+					return
+				}
+			}
+			c.Type, c.Plugin = "benthos_lab", &lConf
+		})
+	}
+	if opts.Inputs {
+		labConfig.WalkInputs(conf, func(path string, c *input.Config) {
+			if sandboxKeepInputs[c.Type] {
+				return
+			}
+			c.Type, c.Plugin = "benthos_lab", &labInputConfig{Name: labelOrPath(c.Label, path)}
+		})
+	}
+	return err
+}
+
+func labelOrPath(label, path string) string {
+	if len(label) > 0 {
+		return label
+	}
+	return path
+}
+
+// resolveFields returns a function that resolves interpolated fields for each
+// message of a batch.
+func resolveFields(fields map[string]bloblang.Field) func(int, types.Message) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	return func(index int, msg types.Message) map[string]string {
+		resolved := make(map[string]string, len(fields))
+		for k, f := range fields {
+			resolved[k] = f.String(index, msg)
+		}
+		return resolved
+	}
+}
+
+func formatFields(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + ": " + fields[k]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+//------------------------------------------------------------------------------
+
+func setSandbox(s *streamState, args []js.Value) interface{} {
+	var opts sandboxConfig
+	if len(args) > 0 && args[0].Type() == js.TypeObject {
+		opts.Outputs = args[0].Get("outputs").Truthy()
+		opts.Inputs = args[0].Get("inputs").Truthy()
+	}
+	s.SetSandbox(opts)
+	return nil
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/bloblang"
+	"github.com/benthosdev/benthos-lab/lib/probe"
+)
+
+//------------------------------------------------------------------------------
+
+// newStreamState creates the state of a lab session. The handle is the JS
+// object of the session, where print, onBreak and onPanic functions are looked
+// up, and is undefined for the default session which uses the globals.
+func newStreamState(handle js.Value) *streamState {
+	s := &streamState{
+		handle:          handle,
+		closeChan:       make(chan struct{}),
+		status:          statusIdle,
+		resultChan:      make(chan struct{}, 1),
+		executeTimeout:  time.Second * 30,
+		shutdownTimeout: time.Second * 30,
+		coverage: &coverageState{
+			cov: probe.NewCoverage(),
+		},
+		profiler: probe.NewProfiler(),
+	}
+	s.debugger = newDebugger(s)
+	s.httpMocks = newHTTPMocks(s)
+	s.resultsFunc = s.writeResults
+	return s
+}
+
+// The default session, driven by the global lab functions.
+var state = newStreamState(js.Undefined())
+
+func (s *streamState) writeOutput(msg, style string) {
+	if s.handle.Type() == js.TypeObject {
+		if print := s.handle.Get("print"); print.Type() == js.TypeFunction {
+			print.Invoke(msg, style)
+			return
+		}
+	}
+	writeOutput(msg, style)
+}
+
+func (s *streamState) reportErr(msg string, err error) {
+	s.writeOutput("Error: "+fmt.Sprintf(msg, err), "errorMessage")
+}
+
+func (s *streamState) reportLints(msg []string) {
+	for _, m := range msg {
+		s.writeOutput("Lint: "+m+"\n", "lintMessage")
+	}
+}
+
+// callback returns a function of the session handle, or of the global
+// benthosLab object for the default session, which might be undefined.
+func (s *streamState) callback(name string) js.Value {
+	handle := s.handle
+	if handle.Type() != js.TypeObject {
+		handle = js.Global().Get("benthosLab")
+	}
+	return handle.Get(name)
+}
+
+//------------------------------------------------------------------------------
+
+// labInputConfig is the config of the benthos_lab input. The name allows
+// batches to be routed to specific inputs of a broker, the session it reads
+// from is set programmatically before the stream is built.
+type labInputConfig struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	session *streamState
+}
+
+func newLabInputConfig() interface{} {
+	return &labInputConfig{}
+}
+
+func (c *labInputConfig) sessionOrDefault() *streamState {
+	if c.session == nil {
+		return state
+	}
+	return c.session
+}
+
+// labOutputConfig is the config of the benthos_lab output, the label is
+// attached to each batch it captures so that results can be attributed to the
+// output they reached. Outputs swapped by the sandbox also resolve the
+// interpolated fields of the original output.
+type labOutputConfig struct {
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+
+	fields map[string]bloblang.Field
+}
+
+func newLabOutputConfig() interface{} {
+	return &labOutputConfig{}
+}
+
+//------------------------------------------------------------------------------
+
+type sessionFunc func(s *streamState, args []js.Value) interface{}
+
+// sessionFuncs are the lab functions bound to a session, these are registered
+// globally for the default session and on each handle of created sessions.
+var sessionFuncs = map[string]sessionFunc{
+	"compile":         compile,
+	"execute":         execute,
+	"runAll":          runAll,
+	"setSandbox":      setSandbox,
+	"setHttpMocks":    setHTTPMocks,
+	"getHttpRequests": getHTTPRequests,
+	"setEnv":          setEnv,
+	"getEnv":          getEnv,
+	"cancel":          cancel,
+	"setTimeouts":     setTimeouts,
+	"status":          status,
+	"benchmark":       benchmark,
+	"setCoverage":     setCoverage,
+	"getCoverage":     getCoverage,
+	"setBreakpoints":  setBreakpoints,
+	"debugState":      debugState,
+	"debugSetBatch":   debugSetBatch,
+	"debugStep":       makeDebugResume(debugStep),
+	"debugContinue":   makeDebugResume(debugContinue),
+	"debugAbort":      makeDebugResume(debugAbort),
+}
+
+// bindSession creates a JS function that calls a lab function for a session
+// and recovers from panics.
+func bindSession(s *streamState, name string, fn sessionFunc) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		defer recoverPanic(s, name, resetOnPanic[name])
+		return fn(s, args)
+	})
+}
+
+// createSession returns the handle of a new session with its own stream,
+// which has the session functions along with close. The print, onBreak and
+// onPanic functions of an optional object argument are copied to the handle,
+// and when print isn't set the global output is used.
+func createSession(this js.Value, args []js.Value) interface{} {
+	handle := js.Global().Get("Object").New()
+	if len(args) > 0 && args[0].Type() == js.TypeObject {
+		for _, k := range []string{"print", "onBreak", "onPanic"} {
+			if v := args[0].Get(k); v.Type() == js.TypeFunction {
+				handle.Set(k, v)
+			}
+		}
+	}
+
+	s := newStreamState(handle)
+
+	var fields []string
+	var funcs []js.Func
+	for name, fn := range sessionFuncs {
+		jsFn := bindSession(s, name, fn)
+		funcs = append(funcs, jsFn)
+		fields = append(fields, name)
+		handle.Set(name, jsFn)
+	}
+
+	var closeFn js.Func
+	closeFn = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		go func() {
+			s.Clear()
+			for _, field := range fields {
+				handle.Delete(field)
+			}
+			handle.Delete("close")
+			for _, fn := range funcs {
+				fn.Release()
+			}
+			closeFn.Release()
+		}()
+		return nil
+	})
+	handle.Set("close", closeFn)
+	return handle
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall/js"
+)
+
+//------------------------------------------------------------------------------
+
+// When started within a Web Worker, or headless under Node.js, the lab is
+// driven by messages rather than global functions. Requests are envelopes of
+// the form:
+//
+//   {id: 1, command: "compile", args: ["pipeline: ..."], session: 2}
+//
+// Where the session is optional and addresses a session made with the
+// createSession command. Each request is handled within its own goroutine, and
+// therefore requests may overlap, except for compile, execute and runAll
+// requests which run in the order they were received. Every request is
+// answered with either {type: "response", id, result} or {type: "response",
+// id, error}. Everything else is streamed back without an id as {type:
+// "output", message} for pipeline results, {type: "error", message}, {type:
+// "log", level, message}, {type: "break", state}, {type: "panic", panic} and
+// finally {type: "ready", version} once the runtime is able to accept
+// requests. Requests received before then are read from benthosLab.queue.
+
+// isWorker returns true if the runtime was started within a Web Worker.
+func isWorker() bool {
+	return js.Global().Get("WorkerGlobalScope").Type() == js.TypeFunction
+}
+
+// isHeadless returns true if the runtime was started by the headless runner,
+// which sets benthosLab.headless.
+func isHeadless() bool {
+	return js.Global().Get("benthosLab").Get("headless").Truthy()
+}
+
+func workerPost(msg map[string]interface{}) {
+	js.Global().Call("postMessage", msg)
+}
+
+func workerWrite(this js.Value, args []js.Value) interface{} {
+	message, style := args[0].String(), args[1].String()
+	switch style {
+	case "":
+		workerPost(map[string]interface{}{"type": "output", "message": message})
+	case "errorMessage":
+		workerPost(map[string]interface{}{"type": "error", "message": message})
+	default:
+		workerPost(map[string]interface{}{
+			"type":    "log",
+			"level":   strings.TrimSuffix(style, "Message"),
+			"message": message,
+		})
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+type workerHandler func(args []js.Value) (interface{}, error)
+
+func argString(args []js.Value, i int) (string, error) {
+	if len(args) <= i || args[i].Type() != js.TypeString {
+		return "", fmt.Errorf("expected a string for argument %v", i)
+	}
+	return args[i].String(), nil
+}
+
+// jsHandler adapts a lab function that reports its own errors.
+func jsHandler(fn func(js.Value, []js.Value) interface{}) workerHandler {
+	return func(args []js.Value) (interface{}, error) {
+		return fn(js.Undefined(), args), nil
+	}
+}
+
+func addHandler(kind string) workerHandler {
+	return func(args []js.Value) (interface{}, error) {
+		cType, err := argString(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := argString(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		path, index, err := targetArgs(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return addComponent(kind, cType, path, index, contents)
+	}
+}
+
+// workerCommands are the commands that aren't bound to a session, the refactor
+// handlers are added to these on init. Every function of sessionFuncs is also
+// a command, see sessionCommand.
+var workerCommands = map[string]workerHandler{
+	"createSession": createWorkerSession,
+	"closeSession":  closeWorkerSession,
+	"compare": func(args []js.Value) (interface{}, error) {
+		var strArgs [4]string
+		for i := range strArgs {
+			var err error
+			if strArgs[i], err = argString(args, i); err != nil {
+				return nil, err
+			}
+		}
+		inputMsgs, err := parseInput(strArgs[2], strArgs[3])
+		if err != nil {
+			return nil, err
+		}
+		c, err := runComparison(strArgs[0], strArgs[1], inputMsgs)
+		if err != nil {
+			return nil, err
+		}
+		return c.toJS(), nil
+	},
+	"setFiles": func(args []js.Value) (interface{}, error) {
+		var files []fixture
+		if len(args) > 0 &&
+			args[0].Type() != js.TypeUndefined && args[0].Type() != js.TypeNull {
+			var err error
+			if files, err = fixturesFromJS(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		return nil, resetFiles(files)
+	},
+	"getFiles": func(args []js.Value) (interface{}, error) {
+		files, err := listFiles()
+		if err != nil {
+			return nil, err
+		}
+		return filesToJS(files), nil
+	},
+	"normalise": func(args []js.Value) (interface{}, error) {
+		contents, err := argString(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		var opts js.Value
+		if len(args) > 1 {
+			opts = args[1]
+		}
+		nConf, err := normaliseOptions(opts)
+		if err != nil {
+			return nil, err
+		}
+		return normaliseConfig(contents, nConf)
+	},
+	"graph": func(args []js.Value) (interface{}, error) {
+		contents, err := argString(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		var format string
+		if len(args) > 1 && args[1].Type() == js.TypeString {
+			format = args[1].String()
+		}
+		return graphConfig(contents, format)
+	},
+	"addInput":      addHandler("input"),
+	"addProcessor":  addHandler("processor"),
+	"addOutput":     addHandler("output"),
+	"addCache":      addHandler("cache"),
+	"addRatelimit":  addHandler("ratelimit"),
+	"getInputs":     jsHandler(getInputs),
+	"getProcessors": jsHandler(getProcessors),
+	"getOutputs":    jsHandler(getOutputs),
+	"getCaches":     jsHandler(getCaches),
+	"getRatelimits": jsHandler(getRatelimits),
+}
+
+func init() {
+	for name, handler := range refactorHandlers {
+		workerCommands[name] = handler
+	}
+}
+
+type asyncSessionFunc func(s *streamState, args []js.Value) (interface{}, error)
+
+// asyncSessionCommands replace the session functions that finish in the
+// background, which report their results to a callback, with versions that
+// respond once finished.
+var asyncSessionCommands = map[string]asyncSessionFunc{
+	"compile": func(s *streamState, args []js.Value) (interface{}, error) {
+		contents, err := argString(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		lints, err := s.compileConfig(contents)
+		if err != nil {
+			return nil, err
+		}
+		genericLints := make([]interface{}, len(lints))
+		for i, l := range lints {
+			genericLints[i] = l
+		}
+		return map[string]interface{}{"lints": genericLints}, nil
+	},
+	"execute": func(s *streamState, args []js.Value) (interface{}, error) {
+		inputMsgs, err := executeArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.SendAll(inputMsgs); err != nil && needsReset(err) {
+			s.resetRuntime()
+		}
+		return nil, err
+	},
+	"runAll": func(s *streamState, args []js.Value) (interface{}, error) {
+		datasets, err := datasetArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		go reportUsage("execute/success")
+		results, err := s.runDatasets(datasets)
+		if err != nil {
+			return nil, err
+		}
+		return datasetResultsToJS(results), nil
+	},
+	"benchmark": func(s *streamState, args []js.Value) (interface{}, error) {
+		inputMsgs, iterations, err := benchmarkArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		report, err := s.runBenchmark(inputMsgs, iterations)
+		if err != nil {
+			if needsReset(err) {
+				s.resetRuntime()
+			}
+			return nil, err
+		}
+		return report.toJS(), nil
+	},
+}
+
+// sessionCommand returns the handler of a session function bound to a session.
+func sessionCommand(command string, s *streamState) (workerHandler, bool) {
+	if fn, exists := asyncSessionCommands[command]; exists {
+		return func(args []js.Value) (interface{}, error) {
+			return fn(s, args)
+		}, true
+	}
+	fn, exists := sessionFuncs[command]
+	if !exists {
+		return nil, false
+	}
+	return func(args []js.Value) (interface{}, error) {
+		return fn(s, args), nil
+	}, true
+}
+
+//------------------------------------------------------------------------------
+
+// Sessions created by requests are addressed by the session field of later
+// requests, and requests without one use the default session. Sessions are
+// only created and closed within the message callback, see inlineCommands,
+// and so a request can address a session created by the request before it.
+var (
+	workerSessions  = map[int]*streamState{}
+	workerSessionID int
+)
+
+// inlineCommands are handled within the message callback rather than a
+// goroutine, and therefore must not block.
+var inlineCommands = map[string]bool{
+	"createSession": true,
+	"closeSession":  true,
+}
+
+func createWorkerSession(args []js.Value) (interface{}, error) {
+	workerSessionID++
+	workerSessions[workerSessionID] = newStreamState(js.Undefined())
+	return map[string]interface{}{"session": workerSessionID}, nil
+}
+
+func closeWorkerSession(args []js.Value) (interface{}, error) {
+	if len(args) == 0 || args[0].Type() != js.TypeNumber {
+		return nil, errors.New("expected a session id")
+	}
+	s, exists := workerSessions[args[0].Int()]
+	if !exists {
+		return nil, fmt.Errorf("session %v does not exist", args[0].Int())
+	}
+	delete(workerSessions, args[0].Int())
+	go s.Clear()
+	return nil, nil
+}
+
+// workerSession returns the session addressed by a request.
+func workerSession(data js.Value) (*streamState, error) {
+	id := data.Get("session")
+	if id.Type() == js.TypeUndefined || id.Type() == js.TypeNull {
+		return state, nil
+	}
+	if id.Type() != js.TypeNumber {
+		return nil, errors.New("expected a number for the session")
+	}
+	s, exists := workerSessions[id.Int()]
+	if !exists {
+		return nil, fmt.Errorf("session %v does not exist", id.Int())
+	}
+	return s, nil
+}
+
+//------------------------------------------------------------------------------
+
+// orderedCommands drive the stream, or the filesystem it uses, and must run in
+// the order received, a compile followed by an execute would otherwise race.
+var orderedCommands = map[string]bool{
+	"compile":  true,
+	"execute":  true,
+	"runAll":   true,
+	"setFiles": true,
+	"getFiles": true,
+}
+
+// orderedTail is closed once the most recently received ordered command has
+// finished.
+var orderedTail = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+func runWorkerCommand(
+	s *streamState, id js.Value, command string, handler workerHandler,
+	args []js.Value, after <-chan struct{}, done chan<- struct{},
+) {
+	if after != nil {
+		<-after
+		defer close(done)
+	}
+
+	res := map[string]interface{}{"type": "response", "id": id}
+	defer func() {
+		if r := recover(); r != nil {
+			handlePanic(s, command, r, resetOnPanic[command])
+			res["error"] = fmt.Sprintf("panic: %v", r)
+		}
+		workerPost(res)
+	}()
+
+	result, err := handler(args)
+	if err != nil {
+		res["error"] = err.Error()
+		return
+	}
+	res["result"] = result
+}
+
+func onWorkerMessage(this js.Value, args []js.Value) interface{} {
+	data := args[0].Get("data")
+	if data.Type() != js.TypeObject {
+		reportErr("failed to read request: %v\n", errors.New("expected an object"))
+		return nil
+	}
+
+	id, command := data.Get("id"), data.Get("command").String()
+	respondErr := func(err error) interface{} {
+		workerPost(map[string]interface{}{
+			"type":  "response",
+			"id":    id,
+			"error": err.Error(),
+		})
+		return nil
+	}
+
+	s := state
+	handler, exists := workerCommands[command]
+	if !exists {
+		var err error
+		if s, err = workerSession(data); err != nil {
+			return respondErr(err)
+		}
+		if handler, exists = sessionCommand(command, s); !exists {
+			return respondErr(fmt.Errorf("unrecognised command: %v", command))
+		}
+	}
+
+	var cmdArgs []js.Value
+	if argsV := data.Get("args"); argsV.Type() == js.TypeObject {
+		for i := 0; i < argsV.Length(); i++ {
+			cmdArgs = append(cmdArgs, argsV.Index(i))
+		}
+	}
+
+	if inlineCommands[command] {
+		runWorkerCommand(s, id, command, handler, cmdArgs, nil, nil)
+		return nil
+	}
+
+	// Callbacks are never concurrent and so ordered commands are queued here.
+	var after, done chan struct{}
+	if orderedCommands[command] {
+		after, done = orderedTail, make(chan struct{})
+		orderedTail = done
+	}
+	go runWorkerCommand(s, id, command, handler, cmdArgs, after, done)
+	return nil
+}
+
+// startWorker redirects output to the main thread, or to the headless runner,
+// and begins accepting requests.
+func startWorker() {
+	benthosLab := js.Global().Get("benthosLab")
+
+	writeFunc = js.FuncOf(workerWrite).Value
+	onBreak := func(this js.Value, args []js.Value) interface{} {
+		workerPost(map[string]interface{}{"type": "break", "state": args[0]})
+		return nil
+	}
+	onPanic := func(this js.Value, args []js.Value) interface{} {
+		workerPost(map[string]interface{}{"type": "panic", "panic": args[0]})
+		return nil
+	}
+	benthosLab.Set("onBreak", js.FuncOf(onBreak))
+	benthosLab.Set("onPanic", js.FuncOf(onPanic))
+
+	js.Global().Set("onmessage", js.FuncOf(onWorkerMessage))
+	if queue := benthosLab.Get("queue"); queue.Type() == js.TypeObject {
+		for i := 0; i < queue.Length(); i++ {
+			onWorkerMessage(js.Undefined(), []js.Value{queue.Index(i)})
+		}
+		benthosLab.Delete("queue")
+	}
+
+	workerPost(map[string]interface{}{
+		"type":    "ready",
+		"version": benthosLab.Get("version"),
+	})
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,599 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/benthos/v3/lib/config"
+	"github.com/Jeffail/benthos/v3/lib/input"
+	"github.com/Jeffail/benthos/v3/lib/output"
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+// Document is a parsed config that can be edited without losing the comments,
+// key order or styles of the parts that aren't changed.
+type Document struct {
+	doc yaml.Node
+
+	// The key nodes that were preceded by a blank line when parsed, which the
+	// encoder would otherwise remove. These are nodes rather than paths so that
+	// the blank lines follow their keys when list items are inserted, removed
+	// or moved.
+	spaced map[*yaml.Node]bool
+}
+
+// ParseDocument parses a config, which must be empty or a mapping.
+func ParseDocument(confStr string) (*Document, error) {
+	d := &Document{}
+	if err := yaml.Unmarshal([]byte(confStr), &d.doc); err != nil {
+		return nil, err
+	}
+	if d.doc.Kind == 0 {
+		d.doc.Kind = yaml.DocumentNode
+	}
+	if len(d.doc.Content) == 0 {
+		d.doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if d.doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("config must be a mapping")
+	}
+	d.spaced = map[*yaml.Node]bool{}
+	lines := strings.Split(confStr, "\n")
+	walkKeyLines(d.Root(), 0, func(key *yaml.Node, line int) {
+		if line > 1 && line-2 < len(lines) && len(strings.TrimSpace(lines[line-2])) == 0 {
+			d.spaced[key] = true
+		}
+	})
+	return d, nil
+}
+
+// Root returns the mapping node of the config.
+func (d *Document) Root() *yaml.Node {
+	return d.doc.Content[0]
+}
+
+// Bytes encodes the document.
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&d.doc); err != nil {
+		return nil, err
+	}
+	if len(d.spaced) == 0 {
+		return buf.Bytes(), nil
+	}
+
+	var encoded yaml.Node
+	if err := yaml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		return nil, err
+	}
+	// The encoded document has the same keys in the same order as the document,
+	// which gives the line of each key of the document once encoded.
+	var keys []*yaml.Node
+	walkKeyLines(d.Root(), 0, func(key *yaml.Node, _ int) {
+		keys = append(keys, key)
+	})
+	lines := strings.Split(buf.String(), "\n")
+	blankBefore := map[int]bool{}
+	i := 0
+	walkKeyLines(encoded.Content[0], 0, func(_ *yaml.Node, line int) {
+		if i < len(keys) && d.spaced[keys[i]] && line > 1 {
+			blankBefore[line-1] = true
+		}
+		i++
+	})
+	spacedLines := make([]string, 0, len(lines)+len(blankBefore))
+	for i, l := range lines {
+		if blankBefore[i] {
+			spacedLines = append(spacedLines, "")
+		}
+		spacedLines = append(spacedLines, l)
+	}
+	return []byte(strings.Join(spacedLines, "\n")), nil
+}
+
+func commentLines(comment string) int {
+	if len(comment) == 0 {
+		return 0
+	}
+	return strings.Count(comment, "\n") + 1
+}
+
+// walkKeyLines calls a function with every mapping key of a node in order,
+// along with the line that it begins at including the comments above it, which
+// is zero or less for keys that weren't parsed. Comments above a sequence item
+// are counted as part of its first key.
+func walkKeyLines(node *yaml.Node, leading int, fn func(key *yaml.Node, line int)) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			key := node.Content[i]
+			line := 0
+			if key.Line > 0 {
+				line = key.Line - commentLines(key.HeadComment) - leading
+			}
+			fn(key, line)
+			leading = 0
+			walkKeyLines(node.Content[i+1], 0, fn)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			walkKeyLines(item, commentLines(item.HeadComment), fn)
+		}
+	}
+}
+
+// moveSpacing moves the blank line above a node, which is recorded against its
+// first key, to a node that replaces it.
+func (d *Document) moveSpacing(from, to *yaml.Node) {
+	if from.Kind != yaml.MappingNode || len(from.Content) == 0 || !d.spaced[from.Content[0]] {
+		return
+	}
+	delete(d.spaced, from.Content[0])
+	if to.Kind == yaml.MappingNode && len(to.Content) > 0 {
+		d.spaced[to.Content[0]] = true
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// rootKeys is the order of the root fields of a normalised config, which new
+// root fields are inserted in accordance with.
+var rootKeys = []string{
+	"input",
+	"buffer",
+	"pipeline",
+	"output",
+	"resources",
+	"cache_resources",
+	"input_resources",
+	"output_resources",
+	"processor_resources",
+	"rate_limit_resources",
+}
+
+func rootKeyRank(key string) int {
+	for i, k := range rootKeys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mapValue returns the value of a key within a mapping node, or nil.
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMapValue sets the value of a key within a mapping node, the key is added
+// at the given index when it doesn't already exist, or at the end when the
+// index is negative.
+func setMapValue(node *yaml.Node, key string, value *yaml.Node, index int) {
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	if index < 0 || index*2 >= len(node.Content) {
+		node.Content = append(node.Content, keyNode, value)
+		return
+	}
+	content := make([]*yaml.Node, 0, len(node.Content)+2)
+	content = append(content, node.Content[:index*2]...)
+	content = append(content, keyNode, value)
+	node.Content = append(content, node.Content[index*2:]...)
+}
+
+// rootValue returns the value of a root field, adding it in the position of a
+// normalised config with a given default when it doesn't exist.
+func (d *Document) rootValue(key string, def func() *yaml.Node) *yaml.Node {
+	root := d.Root()
+	if v := mapValue(root, key); v != nil {
+		return v
+	}
+	rank, index, afterIndex := rootKeyRank(key), -1, -1
+	for i := 0; i < len(root.Content)-1; i += 2 {
+		r := rootKeyRank(root.Content[i].Value)
+		if r < 0 {
+			continue
+		}
+		if r > rank {
+			index = i / 2
+			break
+		}
+		afterIndex = i/2 + 1
+	}
+	if index < 0 {
+		index = afterIndex
+	}
+	v := def()
+	setMapValue(root, key, v, index)
+	return v
+}
+
+// childValue returns the value of a key within a mapping node, adding it to
+// the end with a given default when it doesn't exist.
+func childValue(node *yaml.Node, key string, def func() *yaml.Node) *yaml.Node {
+	if v := mapValue(node, key); v != nil {
+		return v
+	}
+	v := def()
+	setMapValue(node, key, v, -1)
+	return v
+}
+
+func newMapping() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func newSequence() *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+}
+
+// appendItem appends a node to a sequence, which is changed to block style as
+// flow style can't hold the components being added. A comment above the first
+// key of a mapping is moved above the item, where it reads the same.
+func appendItem(seq *yaml.Node, item *yaml.Node) {
+	insertItem(seq, item, -1)
+}
+
+// insertItem inserts a node at an index of a sequence in the same way as
+// appendItem, a negative index appends it. The index of the node is returned.
+func insertItem(seq *yaml.Node, item *yaml.Node, index int) (int, error) {
+	if index > len(seq.Content) {
+		return 0, fmt.Errorf("index %v is out of bounds", index)
+	}
+	if item.Kind == yaml.MappingNode && len(item.Content) > 0 && len(item.HeadComment) == 0 {
+		item.HeadComment, item.Content[0].HeadComment = item.Content[0].HeadComment, ""
+	}
+	seq.Style &^= yaml.FlowStyle
+	if index < 0 {
+		seq.Content = append(seq.Content, item)
+		return len(seq.Content) - 1, nil
+	}
+	seq.Content = append(seq.Content[:index], append([]*yaml.Node{item}, seq.Content[index:]...)...)
+	return index, nil
+}
+
+// componentNode marshals a config in its normalised form and returns the node
+// at a path of it.
+func componentNode(conf config.Type, path string) (*yaml.Node, error) {
+	// The lab connectors are only documented once registered by the runtime,
+	// and the parts of the config outside of the path are discarded anyway.
+	if conf.Input.Type == "benthos_lab" {
+		conf.Input.Type = input.TypeSTDIN
+	}
+	if conf.Output.Type == "benthos_lab" {
+		conf.Output.Type = output.TypeSTDOUT
+	}
+	confBytes, err := Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err = yaml.Unmarshal(confBytes, &root); err != nil {
+		return nil, err
+	}
+	return GetNode(&root, path)
+}
+
+// isBroker returns true if a component node is of the type broker.
+func isBroker(node *yaml.Node) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	if t := mapValue(node, "type"); t != nil {
+		return t.Value == "broker"
+	}
+	return mapValue(node, "broker") != nil
+}
+
+//------------------------------------------------------------------------------
+
+// labNode returns the node of a lab connector, which is the input or output of
+// a config that doesn't specify one.
+func labNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "label"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: ""},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "type"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "benthos_lab"},
+	}}
+}
+
+func inputNode(cType string) (*yaml.Node, error) {
+	if cType == "benthos_lab" {
+		return labNode(), nil
+	}
+	conf := New()
+	conf.Input.Type = cType
+	return componentNode(conf, "input")
+}
+
+func outputNode(cType string) (*yaml.Node, error) {
+	if cType == "benthos_lab" {
+		return labNode(), nil
+	}
+	conf := New()
+	conf.Output.Type = cType
+	return componentNode(conf, "output")
+}
+
+// AddInput inserts a default input of a type at an index of the list at a
+// path, such as `input.broker.inputs`. When the path is empty the input is
+// added to the broker of the root input, and the existing input is placed
+// within a broker if it isn't one already.
+func (d *Document) AddInput(cType, path string, index int) error {
+	conf := New()
+	if err := AddInput(cType, &conf); err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return d.addToBroker("input", "inputs", cType, input.TypeBroker, index, inputNode)
+	}
+	node, err := inputNode(cType)
+	if err != nil {
+		return err
+	}
+	return d.insertAt(KindInput, path, index, node)
+}
+
+// AddOutput inserts a default output of a type at an index of the list at a
+// path, such as `output.broker.outputs`. When the path is empty the output is
+// added to the broker of the root output, and the existing output is placed
+// within a broker if it isn't one already.
+func (d *Document) AddOutput(cType, path string, index int) error {
+	conf := New()
+	if err := AddOutput(cType, &conf); err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return d.addToBroker("output", "outputs", cType, output.TypeBroker, index, outputNode)
+	}
+	node, err := outputNode(cType)
+	if err != nil {
+		return err
+	}
+	return d.insertAt(KindOutput, path, index, node)
+}
+
+// addToBroker adds a component to the broker of a root field, where a field
+// that doesn't exist holds the lab connector. When the existing component
+// isn't a broker it is wrapped in one, and adding a broker stops there.
+func (d *Document) addToBroker(key, listKey, cType, brokerType string, index int, newNode func(string) (*yaml.Node, error)) error {
+	current := mapValue(d.Root(), key)
+	implicit := current == nil
+	if implicit {
+		current = labNode()
+	}
+
+	if !isBroker(current) {
+		brokerNode, err := newNode(brokerType)
+		if err != nil {
+			return err
+		}
+		list := childValue(childValue(brokerNode, "broker", newMapping), listKey, newSequence)
+		list.Content = nil
+		appendItem(list, current)
+		if implicit {
+			d.rootValue(key, func() *yaml.Node { return brokerNode })
+		} else {
+			setMapValue(d.Root(), key, brokerNode, -1)
+		}
+		if cType == brokerType {
+			return nil
+		}
+		current = brokerNode
+	}
+
+	node, err := newNode(cType)
+	if err != nil {
+		return err
+	}
+	_, err = insertItem(childValue(childValue(current, "broker", newMapping), listKey, newSequence), node, index)
+	return err
+}
+
+// AddProcessor inserts a default processor of a type at an index of the list
+// at a path, such as `pipeline.processors.2.switch.0.processors` or
+// `input.processors`. When the path is empty the processor is added to the
+// pipeline.
+func (d *Document) AddProcessor(cType, path string, index int) error {
+	conf := New()
+	if err := AddProcessor(cType, &conf); err != nil {
+		return err
+	}
+	return d.insertProcessor(conf, path, index)
+}
+
+// AddCondition inserts a filter_parts processor with a default condition of a
+// type at an index of the list at a path, or the pipeline when the path is
+// empty.
+func (d *Document) AddCondition(cType, path string, index int) error {
+	conf := New()
+	if err := AddCondition(cType, &conf); err != nil {
+		return err
+	}
+	return d.insertProcessor(conf, path, index)
+}
+
+func (d *Document) insertProcessor(conf config.Type, path string, index int) error {
+	node, err := componentNode(conf, "pipeline.processors.0")
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		path = "pipeline.processors"
+	}
+	return d.insertAt(KindProcessor, path, index, node)
+}
+
+// AddCache inserts a default cache resource of a type with a unique label at
+// an index of the list at a path, or of the cache resources when the path is
+// empty.
+func (d *Document) AddCache(cType, path string, index int) error {
+	conf := New()
+	if err := AddCache(cType, &conf); err != nil {
+		return err
+	}
+	return d.insertResource(conf, KindCache, "cache_resources", "caches", path, index)
+}
+
+// AddRatelimit inserts a default rate limit resource of a type with a unique
+// label at an index of the list at a path, or of the rate limit resources when
+// the path is empty.
+func (d *Document) AddRatelimit(cType, path string, index int) error {
+	conf := New()
+	if err := AddRatelimit(cType, &conf); err != nil {
+		return err
+	}
+	return d.insertResource(conf, KindRatelimit, "rate_limit_resources", "rate_limits", path, index)
+}
+
+// insertResource inserts the first resource of a list field of a config,
+// labelled after the number of resources of that kind, including those of the
+// deprecated resources field.
+func (d *Document) insertResource(conf config.Type, kind, listKey, resourcesKey, path string, index int) error {
+	node, err := componentNode(conf, listKey+".0")
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	if resources := mapValue(d.Root(), "resources"); resources != nil {
+		if m := mapValue(resources, resourcesKey); m != nil && m.Kind == yaml.MappingNode {
+			count += len(m.Content) / 2
+		}
+	}
+	if list := mapValue(d.Root(), listKey); list != nil && list.Kind == yaml.SequenceNode {
+		count += len(list.Content)
+	}
+
+	setMapValue(node, "label", &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: fmt.Sprintf("example%v", count),
+	}, 0)
+	if len(path) == 0 {
+		path = listKey
+	}
+	return d.insertAt(kind, path, index, node)
+}
+
+//------------------------------------------------------------------------------
+
+// insertAt inserts a component node of a kind at an index of the list at a
+// path, where a negative index appends it. The path can also end with the
+// index, such as `output.broker.outputs.1`, which takes precedence. Missing
+// fields of the path are created, and the document is left unchanged when the
+// path isn't a list of components of the kind.
+func (d *Document) insertAt(kind, path string, index int, node *yaml.Node) error {
+	if target, _, err := d.lookup(path); err != nil || target.Kind != yaml.SequenceNode {
+		if i := strings.LastIndex(path, "."); i > 0 {
+			if n, err := strconv.Atoi(path[i+1:]); err == nil {
+				path, index = path[:i], n
+			}
+		}
+	}
+
+	snapshot := cloneNode(&d.doc)
+	err := func() error {
+		list, err := d.listAt(path)
+		if err != nil {
+			return err
+		}
+		i, err := insertItem(list, node, index)
+		if err != nil {
+			return err
+		}
+		if kinds, err := d.Components(); err != nil || kinds[IndexPath(path, i)] != kind {
+			return fmt.Errorf("path '%v' is not a list of %vs", path, kind)
+		}
+		return nil
+	}()
+	if err != nil {
+		d.doc = *snapshot
+	}
+	return err
+}
+
+// listAt returns the sequence node at a path, creating the fields of the path
+// that don't exist. Fields of the root are created in the position of a
+// normalised config.
+func (d *Document) listAt(path string) (*yaml.Node, error) {
+	segments := strings.Split(path, ".")
+	node := d.Root()
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		def := newMapping
+		if last {
+			def = newSequence
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			if i == 0 {
+				node = d.rootValue(seg, def)
+			} else {
+				node = childValue(node, seg, def)
+			}
+		case yaml.SequenceNode:
+			n, err := strconv.Atoi(seg)
+			if err != nil || n < 0 || n >= len(node.Content) {
+				return nil, fmt.Errorf("path '%v' not found", strings.Join(segments[:i+1], "."))
+			}
+			node = node.Content[n]
+		default:
+			return nil, fmt.Errorf("path '%v' not found", strings.Join(segments[:i+1], "."))
+		}
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("path '%v' is not a list", path)
+	}
+	return node, nil
+}
+
+// cloneNode returns a deep copy of a node.
+func cloneNode(node *yaml.Node) *yaml.Node {
+	c := *node
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = cloneNode(child)
+	}
+	return &c
+}
+
+//------------------------------------------------------------------------------
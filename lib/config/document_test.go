@@ -0,0 +1,317 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const annotatedConfig = `# Reads documents and enriches them
+http:
+  address: 0.0.0.0:4195 # not the default
+
+input:
+  # Read from stdin
+  stdin: {}
+
+pipeline:
+  processors:
+    # First we parse
+    - bloblang: |
+        root = this # keep all
+output:
+  drop: {}
+`
+
+func TestDocumentAddProcessor(t *testing.T) {
+	d, err := ParseDocument(annotatedConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddProcessor("noop", "", -1); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `# Reads documents and enriches them
+http:
+  address: 0.0.0.0:4195 # not the default
+
+input:
+  # Read from stdin
+  stdin: {}
+
+pipeline:
+  processors:
+    # First we parse
+    - bloblang: |
+        root = this # keep all
+    - label: ""
+      noop: {}
+output:
+  drop: {}
+`
+	if act := string(res); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+}
+
+func TestDocumentAddInputWraps(t *testing.T) {
+	d, err := ParseDocument(annotatedConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddInput("benthos_lab", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs, err := GetNode(&d.doc, "input.broker.inputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 2, len(inputs.Content); exp != act {
+		t.Fatalf("Wrong count of inputs: %v != %v", act, exp)
+	}
+	if exp, act := "# Read from stdin", inputs.Content[0].HeadComment; exp != act {
+		t.Errorf("Wrong comment: %v != %v", act, exp)
+	}
+	if exp, act := "benthos_lab", mapValue(inputs.Content[1], "type").Value; exp != act {
+		t.Errorf("Wrong type: %v != %v", act, exp)
+	}
+
+	// Adding to an existing broker appends without wrapping again.
+	if err = d.AddInput("stdin", "", -1); err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 3, len(inputs.Content); exp != act {
+		t.Errorf("Wrong count of inputs: %v != %v", act, exp)
+	}
+}
+
+func TestDocumentAddOutputImplicit(t *testing.T) {
+	d, err := ParseDocument(`pipeline:
+  processors: []
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddOutput("drop", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, err := GetNode(&d.doc, "output.broker.outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 2, len(outputs.Content); exp != act {
+		t.Fatalf("Wrong count of outputs: %v != %v", act, exp)
+	}
+	if exp, act := "benthos_lab", mapValue(outputs.Content[0], "type").Value; exp != act {
+		t.Errorf("Wrong type: %v != %v", act, exp)
+	}
+	if mapValue(outputs.Content[1], "drop") == nil {
+		t.Error("Expected drop output")
+	}
+}
+
+func TestDocumentAddResources(t *testing.T) {
+	d, err := ParseDocument(`resources:
+  caches:
+    foo:
+      memory: {}
+output:
+  drop: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddCache("memory", "", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddRatelimit("local", "", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{}
+	root := d.Root()
+	for i := 0; i < len(root.Content); i += 2 {
+		keys = append(keys, root.Content[i].Value)
+	}
+	if exp, act := "resources,output,cache_resources,rate_limit_resources", strings.Join(keys, ","); exp != act {
+		t.Errorf("Wrong root keys: %v != %v", act, exp)
+	}
+
+	label, err := GetNode(&d.doc, "cache_resources.0.label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := "example1", label.Value; exp != act {
+		t.Errorf("Wrong label: %v != %v", act, exp)
+	}
+}
+
+func TestDocumentAddErrors(t *testing.T) {
+	d, err := ParseDocument("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddProcessor("nope", "", -1); err == nil {
+		t.Error("Expected error")
+	}
+	if _, err = ParseDocument("- foo"); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+const nestedConfig = `input:
+  stdin: {}
+pipeline:
+  processors:
+    - switch:
+        - check: this.foo
+          processors:
+            - noop: {}
+output:
+  broker:
+    outputs:
+      - drop: {}
+      - stdout: {}
+`
+
+func TestDocumentAddAtPath(t *testing.T) {
+	d, err := ParseDocument(nestedConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddProcessor("sleep", "pipeline.processors.0.switch.0.processors", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddProcessor("bloblang", "input.processors", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddOutput("http_client", "output.broker.outputs.1", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[string]string{
+		"pipeline.processors.0.switch.0.processors.0": "sleep",
+		"pipeline.processors.0.switch.0.processors.1": "noop",
+		"input.processors.0":                          "bloblang",
+		"output.broker.outputs.0":                     "drop",
+		"output.broker.outputs.1":                     "http_client",
+		"output.broker.outputs.2":                     "stdout",
+	}
+	for path, cType := range exp {
+		node, err := GetNode(&d.doc, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if act := componentType(KindProcessor, node) + componentType(KindOutput, node); !strings.Contains(act, cType) {
+			t.Errorf("Wrong type at %v: %v != %v", path, act, cType)
+		}
+	}
+}
+
+const spacedListConfig = `pipeline:
+  processors:
+    # First
+    - bloblang: root = "first"
+
+    # Second
+    - bloblang: root = "second"
+
+    - label: third
+      bloblang: root = "third"
+`
+
+func TestDocumentAddAtIndexSpacing(t *testing.T) {
+	tests := map[int]string{
+		0: `pipeline:
+  processors:
+    - label: ""
+      noop: {}
+    # First
+    - bloblang: root = "first"
+
+    # Second
+    - bloblang: root = "second"
+
+    - label: third
+      bloblang: root = "third"
+`,
+		1: `pipeline:
+  processors:
+    # First
+    - bloblang: root = "first"
+    - label: ""
+      noop: {}
+
+    # Second
+    - bloblang: root = "second"
+
+    - label: third
+      bloblang: root = "third"
+`,
+	}
+	for index, exp := range tests {
+		d, err := ParseDocument(spacedListConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = d.AddProcessor("noop", "", index); err != nil {
+			t.Fatal(err)
+		}
+		if act := docString(t, d); act != exp {
+			t.Errorf("Wrong result for index %v:\n%v\n!=\n%v", index, act, exp)
+		}
+	}
+}
+
+func TestDocumentAddAtPathErrors(t *testing.T) {
+	d, err := ParseDocument(nestedConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddProcessor("noop", "output.broker.outputs", 0); err == nil {
+		t.Error("Expected error from adding a processor to outputs")
+	}
+	if err = d.AddOutput("drop", "pipeline.processors", -1); err == nil {
+		t.Error("Expected error from adding an output to processors")
+	}
+	if err = d.AddProcessor("noop", "pipeline.processors", 5); err == nil {
+		t.Error("Expected error from out of bounds index")
+	}
+	if err = d.AddProcessor("noop", "pipeline.processors.3.switch.0.processors", 0); err == nil {
+		t.Error("Expected error from missing path")
+	}
+
+	res, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act := string(res); act != nestedConfig {
+		t.Errorf("Failed additions changed the config:\n%v", act)
+	}
+}
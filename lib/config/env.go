@@ -0,0 +1,109 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+
+// The same patterns as Benthos uses to find environment variables, where
+// `${FOO:bar}` is replaced with the value of FOO or the default bar, and
+// `${{FOO}}` is an escaped `${FOO}`.
+var (
+	envRegex        = regexp.MustCompile(`\${[0-9A-Za-z_.]+(:((\${[^}]+})|[^}])+)?}`)
+	escapedEnvRegex = regexp.MustCompile(`\${({[0-9A-Za-z_.]+(:((\${[^}]+})|[^}])+)?})}`)
+)
+
+// EnvVar is an environment variable referenced by a config.
+type EnvVar struct {
+	Name       string
+	Default    string
+	HasDefault bool
+
+	// The value that the variable is replaced with, which is the default
+	// when the variable is empty or not set.
+	Value string
+	Set   bool
+
+	// The lines of the config that reference the variable with this default.
+	Lines []int
+}
+
+// parseEnvRef parses a reference of the form `${FOO:bar}`.
+func parseEnvRef(ref string) (name, def string, hasDefault bool) {
+	inner := ref[2 : len(ref)-1]
+	if i := strings.IndexByte(inner, ':'); i >= 0 {
+		return inner[:i], inner[i+1:], true
+	}
+	return inner, "", false
+}
+
+func resolveEnvRef(ref string, env map[string]string) string {
+	name, def, _ := parseEnvRef(ref)
+	if v := env[name]; len(v) > 0 {
+		return v
+	}
+	return def
+}
+
+// EnvVars returns the environment variables referenced by a config in the
+// order that they first appear, resolved against an environment. A variable
+// referenced with different defaults is listed once for each default.
+func EnvVars(confStr string, env map[string]string) []EnvVar {
+	var vars []EnvVar
+	indexes := map[string]int{}
+	for _, loc := range envRegex.FindAllStringIndex(confStr, -1) {
+		ref := confStr[loc[0]:loc[1]]
+		line := strings.Count(confStr[:loc[0]], "\n") + 1
+		if i, exists := indexes[ref]; exists {
+			if lines := vars[i].Lines; lines[len(lines)-1] != line {
+				vars[i].Lines = append(lines, line)
+			}
+			continue
+		}
+		name, def, hasDefault := parseEnvRef(ref)
+		indexes[ref] = len(vars)
+		vars = append(vars, EnvVar{
+			Name:       name,
+			Default:    def,
+			HasDefault: hasDefault,
+			Value:      resolveEnvRef(ref, env),
+			Set:        len(env[name]) > 0,
+			Lines:      []int{line},
+		})
+	}
+	return vars
+}
+
+// ReplaceEnvVars replaces the environment variables referenced by a config
+// with their values within an environment, in the same way that Benthos does
+// with the environment of its process.
+func ReplaceEnvVars(confStr string, env map[string]string) string {
+	replaced := envRegex.ReplaceAllStringFunc(confStr, func(ref string) string {
+		return resolveEnvRef(ref, env)
+	})
+	return escapedEnvRegex.ReplaceAllString(replaced, "$$$1")
+}
+
+//------------------------------------------------------------------------------
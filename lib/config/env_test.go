@@ -0,0 +1,81 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+const envConfig = `input:
+  kafka:
+    addresses: [ "${KAFKA_ADDR:localhost:9092}" ]
+    topics: [ "${KAFKA_TOPIC:foo}", "${KAFKA_TOPIC:foo}" ]
+    client_id: ${CLIENT_ID}
+pipeline:
+  processors:
+    - bloblang: 'root.topic = "${KAFKA_TOPIC:bar}"'
+    - bloblang: 'root.escaped = "${{NOT_A_VAR}}"'
+`
+
+func TestEnvVars(t *testing.T) {
+	vars := EnvVars(envConfig, map[string]string{
+		"KAFKA_TOPIC": "things",
+		"KAFKA_ADDR":  "",
+	})
+	exp := []EnvVar{
+		{Name: "KAFKA_ADDR", Default: "localhost:9092", HasDefault: true, Value: "localhost:9092", Lines: []int{3}},
+		{Name: "KAFKA_TOPIC", Default: "foo", HasDefault: true, Value: "things", Set: true, Lines: []int{4}},
+		{Name: "CLIENT_ID", Lines: []int{5}},
+		{Name: "KAFKA_TOPIC", Default: "bar", HasDefault: true, Value: "things", Set: true, Lines: []int{8}},
+	}
+	if !reflect.DeepEqual(vars, exp) {
+		t.Errorf("Wrong vars: %+v != %+v", vars, exp)
+	}
+}
+
+func TestReplaceEnvVars(t *testing.T) {
+	act := ReplaceEnvVars(envConfig, map[string]string{
+		"KAFKA_TOPIC": "things",
+		"CLIENT_ID":   "lab",
+	})
+	exp := `input:
+  kafka:
+    addresses: [ "localhost:9092" ]
+    topics: [ "things", "things" ]
+    client_id: lab
+pipeline:
+  processors:
+    - bloblang: 'root.topic = "things"'
+    - bloblang: 'root.escaped = "${NOT_A_VAR}"'
+`
+	if act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+
+	conf, err := Unmarshal(act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := "lab", conf.Input.Kafka.ClientID; exp != act {
+		t.Errorf("Wrong client id: %v != %v", act, exp)
+	}
+}
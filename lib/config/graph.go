@@ -0,0 +1,391 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+// GraphFormat is a format that a graph can be exported as.
+type GraphFormat string
+
+// The formats of a graph.
+const (
+	GraphJSON    GraphFormat = "json"
+	GraphDOT     GraphFormat = "dot"
+	GraphMermaid GraphFormat = "mermaid"
+)
+
+// ParseGraphFormat parses the name of a graph format, where an empty name is
+// JSON.
+func ParseGraphFormat(name string) (GraphFormat, error) {
+	switch format := GraphFormat(name); format {
+	case "":
+		return GraphJSON, nil
+	case GraphJSON, GraphDOT, GraphMermaid:
+		return format, nil
+	}
+	return "", fmt.Errorf("graph format '%v' not recognised, expected json, dot or mermaid", name)
+}
+
+// The types of edge within a graph.
+const (
+	EdgeFlow      = "flow"
+	EdgeReference = "reference"
+)
+
+// GraphNode is a component of a config, identified by its YAML path.
+type GraphNode struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Type     string `json:"type"`
+	Label    string `json:"label,omitempty"`
+	Resource bool   `json:"resource,omitempty"`
+}
+
+// GraphEdge is either the flow of messages from one component to another or a
+// reference from a component to a resource. The label of an edge describes the
+// path it takes, such as the case of a switch.
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Type  string `json:"type"`
+	Label string `json:"label,omitempty"`
+}
+
+// Graph is the topology of a config.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+//------------------------------------------------------------------------------
+
+var listItemRegex = regexp.MustCompile(`^(.+)\.([0-9]+)$`)
+
+// Graph returns the topology of the document, where messages flow from the
+// input through the processors of the pipeline to the output, and components
+// such as brokers, switches and branches fan out to the components nested
+// within them.
+func (d *Document) Graph() (*Graph, error) {
+	components, err := d.Components()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	positions := map[string][2]int{}
+	nodes := map[string]*yaml.Node{}
+	defined := map[string]map[string]string{}
+	for p, kind := range components {
+		node, err := GetNode(&d.doc, p)
+		if err != nil {
+			continue
+		}
+		nodes[p], positions[p] = node, [2]int{node.Line, node.Column}
+		n := GraphNode{ID: p, Kind: kind, Type: componentType(kind, node)}
+		if label := mapValue(node, "label"); label != nil {
+			n.Label = label.Value
+		}
+		if name, isResource := resourceName(kind, p, node); isResource {
+			n.Label, n.Resource = name, true
+			if defined[kind] == nil {
+				defined[kind] = map[string]string{}
+			}
+			if _, exists := defined[kind][name]; !exists {
+				defined[kind][name] = p
+			}
+		}
+		g.Nodes = append(g.Nodes, n)
+	}
+	// Nodes are in the order of the config, which for a config written on a
+	// single line is the order of their columns.
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		pi, pj := positions[g.Nodes[i].ID], positions[g.Nodes[j].ID]
+		if pi != pj {
+			return pi[0] < pj[0] || (pi[0] == pj[0] && pi[1] < pj[1])
+		}
+		return lessPath(g.Nodes[i].ID, g.Nodes[j].ID)
+	})
+	rank := map[string]int{}
+	for i, n := range g.Nodes {
+		rank[n.ID] = i
+	}
+
+	flow := func(from, to, label string) {
+		g.Edges = append(g.Edges, GraphEdge{From: from, To: to, Type: EdgeFlow, Label: label})
+	}
+
+	// Group processors by the list they belong to, skipping the processor
+	// resources list as its processors aren't executed in sequence.
+	lists := map[string][]string{}
+	indexes := map[string]int{}
+	var listPaths []string
+	for _, n := range g.Nodes {
+		if n.Kind != KindProcessor || n.Resource {
+			continue
+		}
+		m := listItemRegex.FindStringSubmatch(n.ID)
+		if m == nil {
+			continue
+		}
+		if _, exists := lists[m[1]]; !exists {
+			listPaths = append(listPaths, m[1])
+		}
+		lists[m[1]] = append(lists[m[1]], n.ID)
+		indexes[n.ID], _ = strconv.Atoi(m[2])
+	}
+	sort.Strings(listPaths)
+	for _, l := range listPaths {
+		sort.Slice(lists[l], func(i, j int) bool {
+			return indexes[lists[l][i]] < indexes[lists[l][j]]
+		})
+		for i := 1; i < len(lists[l]); i++ {
+			flow(lists[l][i-1], lists[l][i], "")
+		}
+	}
+
+	// The entry and exit of an input or output include its processors.
+	exit := func(p string) string {
+		if procs := lists[p+".processors"]; len(procs) > 0 {
+			return procs[len(procs)-1]
+		}
+		return p
+	}
+	entry := func(p string) string {
+		if procs := lists[p+".processors"]; len(procs) > 0 {
+			return procs[0]
+		}
+		return p
+	}
+	owner := func(p string) string {
+		for i := strings.LastIndex(p, "."); i > 0; i = strings.LastIndex(p[:i], ".") {
+			if _, exists := components[p[:i]]; exists {
+				return p[:i]
+			}
+		}
+		return ""
+	}
+	relLabel := func(parent, p string) string {
+		rel := strings.TrimPrefix(p, parent+".")
+		for _, suffix := range []string{".processors", ".output"} {
+			rel = strings.TrimSuffix(rel, suffix)
+		}
+		return rel
+	}
+
+	for _, l := range listPaths {
+		procs := lists[l]
+		switch o := owner(l); {
+		case o == "":
+		case components[o] == KindInput:
+			flow(o, procs[0], "")
+		case components[o] == KindOutput:
+			flow(procs[len(procs)-1], o, "")
+		default:
+			flow(o, procs[0], relLabel(o, l))
+		}
+	}
+
+	for _, n := range g.Nodes {
+		o := owner(n.ID)
+		if o == "" || components[o] != n.Kind {
+			continue
+		}
+		switch n.Kind {
+		case KindInput:
+			flow(exit(n.ID), o, relLabel(o, n.ID))
+		case KindOutput:
+			flow(o, entry(n.ID), relLabel(o, n.ID))
+		}
+	}
+
+	// The main stream of the config.
+	var from string
+	if _, exists := components["input"]; exists {
+		from = exit("input")
+	}
+	if procs := lists["pipeline.processors"]; len(procs) > 0 {
+		if len(from) > 0 {
+			flow(from, procs[0], "")
+		}
+		from = procs[len(procs)-1]
+	}
+	if _, exists := components["output"]; exists && len(from) > 0 {
+		flow(from, entry("output"), "")
+	}
+
+	for _, n := range g.Nodes {
+		for _, r := range componentRefs(n.Kind, n.Type, n.ID, nodes[n.ID], components) {
+			to, exists := defined[r.kind][r.name]
+			if !exists {
+				continue
+			}
+			g.Edges = append(g.Edges, GraphEdge{
+				From:  n.ID,
+				To:    to,
+				Type:  EdgeReference,
+				Label: strings.TrimPrefix(r.path, n.ID+"."),
+			})
+		}
+	}
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		ei, ej := g.Edges[i], g.Edges[j]
+		if ei.Type != ej.Type {
+			return ei.Type == EdgeFlow
+		}
+		if rank[ei.From] != rank[ej.From] {
+			return rank[ei.From] < rank[ej.From]
+		}
+		return rank[ei.To] < rank[ej.To]
+	})
+	return g, nil
+}
+
+// lessPath returns true if a path sorts before another, where the indexes of
+// lists are compared as numbers.
+func lessPath(a, b string) bool {
+	segsA, segsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(segsA) && i < len(segsB); i++ {
+		if segsA[i] == segsB[i] {
+			continue
+		}
+		ia, errA := strconv.Atoi(segsA[i])
+		ib, errB := strconv.Atoi(segsB[i])
+		if errA == nil && errB == nil {
+			return ia < ib
+		}
+		return segsA[i] < segsB[i]
+	}
+	return len(segsA) < len(segsB)
+}
+
+// ConfigGraph parses a config and returns its topology, see Document.Graph.
+func ConfigGraph(confStr string) (*Graph, error) {
+	d, err := ParseDocument(confStr)
+	if err != nil {
+		return nil, err
+	}
+	return d.Graph()
+}
+
+//------------------------------------------------------------------------------
+
+// MarshalGraph exports a graph in a format.
+func MarshalGraph(g *Graph, format GraphFormat) ([]byte, error) {
+	switch format {
+	case GraphDOT:
+		return g.dot(), nil
+	case GraphMermaid:
+		return g.mermaid(), nil
+	}
+	return json.MarshalIndent(g, "", "  ")
+}
+
+// nodeText returns the lines describing a node.
+func nodeText(n GraphNode) []string {
+	text := []string{n.Kind + ": " + n.Type}
+	if n.Resource {
+		text[0] = n.Kind + " resource: " + n.Type
+	}
+	if len(n.Label) > 0 {
+		text = append(text, n.Label)
+	}
+	return text
+}
+
+var dotShapes = map[string]string{
+	KindInput:     "invhouse",
+	KindProcessor: "box",
+	KindOutput:    "house",
+	KindCache:     "cylinder",
+	KindRatelimit: "octagon",
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func (g *Graph) dot() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("digraph benthos {\n  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=%v, shape=%v", dotQuote(strings.Join(nodeText(n), "\n")), dotShapes[n.Kind])
+		if n.Resource {
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&buf, "  %v [%v];\n", dotQuote(n.ID), attrs)
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		if len(e.Label) > 0 {
+			attrs = append(attrs, "label="+dotQuote(e.Label))
+		}
+		if e.Type == EdgeReference {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&buf, "  %v -> %v", dotQuote(e.From), dotQuote(e.To))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&buf, " [%v]", strings.Join(attrs, ", "))
+		}
+		buf.WriteString(";\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+func (g *Graph) mermaid() []byte {
+	// Mermaid IDs can't contain the dots of a path, so nodes are numbered.
+	ids := map[string]string{}
+	var buf bytes.Buffer
+	buf.WriteString("flowchart LR\n")
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%v", i)
+		fmt.Fprintf(&buf, "  %v[%v]\n", ids[n.ID], mermaidQuote(strings.Join(nodeText(n), "<br>")))
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Type == EdgeReference {
+			arrow = "-.->"
+		}
+		if len(e.Label) > 0 {
+			arrow += "|" + mermaidQuote(e.Label) + "|"
+		}
+		fmt.Fprintf(&buf, "  %v %v %v\n", ids[e.From], arrow, ids[e.To])
+	}
+	return buf.Bytes()
+}
+
+//------------------------------------------------------------------------------
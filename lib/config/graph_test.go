@@ -0,0 +1,218 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const graphConfig = `input:
+  broker:
+    inputs:
+      - stdin: {}
+        processors:
+          - noop: {}
+      - resource: in
+pipeline:
+  processors:
+    - switch:
+        - check: this.foo
+          processors:
+            - cache:
+                resource: foo
+                operator: set
+                key: ${! content() }
+    - label: tidy
+      bloblang: root = this
+output:
+  switch:
+    cases:
+      - check: this.bar
+        output:
+          drop: {}
+resources:
+  inputs:
+    in:
+      stdin: {}
+  caches:
+    foo:
+      memory: {}
+`
+
+func TestGraph(t *testing.T) {
+	g, err := ConfigGraph(graphConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expNodes := []GraphNode{
+		{ID: "input", Kind: KindInput, Type: "broker"},
+		{ID: "input.broker.inputs.0", Kind: KindInput, Type: "stdin"},
+		{ID: "input.broker.inputs.0.processors.0", Kind: KindProcessor, Type: "noop"},
+		{ID: "input.broker.inputs.1", Kind: KindInput, Type: "resource"},
+		{ID: "pipeline.processors.0", Kind: KindProcessor, Type: "switch"},
+		{ID: "pipeline.processors.0.switch.0.processors.0", Kind: KindProcessor, Type: "cache"},
+		{ID: "pipeline.processors.1", Kind: KindProcessor, Type: "bloblang", Label: "tidy"},
+		{ID: "output", Kind: KindOutput, Type: "switch"},
+		{ID: "output.switch.cases.0.output", Kind: KindOutput, Type: "drop"},
+		{ID: "resources.inputs.in", Kind: KindInput, Type: "stdin", Label: "in", Resource: true},
+		{ID: "resources.caches.foo", Kind: KindCache, Type: "memory", Label: "foo", Resource: true},
+	}
+	if !reflect.DeepEqual(expNodes, g.Nodes) {
+		t.Errorf("Wrong nodes: %+v != %+v", g.Nodes, expNodes)
+	}
+
+	expEdges := []GraphEdge{
+		{From: "input", To: "pipeline.processors.0", Type: EdgeFlow},
+		{From: "input.broker.inputs.0", To: "input.broker.inputs.0.processors.0", Type: EdgeFlow},
+		{From: "input.broker.inputs.0.processors.0", To: "input", Type: EdgeFlow, Label: "broker.inputs.0"},
+		{From: "input.broker.inputs.1", To: "input", Type: EdgeFlow, Label: "broker.inputs.1"},
+		{From: "pipeline.processors.0", To: "pipeline.processors.0.switch.0.processors.0", Type: EdgeFlow, Label: "switch.0"},
+		{From: "pipeline.processors.0", To: "pipeline.processors.1", Type: EdgeFlow},
+		{From: "pipeline.processors.1", To: "output", Type: EdgeFlow},
+		{From: "output", To: "output.switch.cases.0.output", Type: EdgeFlow, Label: "switch.cases.0"},
+		{From: "input.broker.inputs.1", To: "resources.inputs.in", Type: EdgeReference, Label: "resource"},
+		{From: "pipeline.processors.0.switch.0.processors.0", To: "resources.caches.foo", Type: EdgeReference, Label: "cache.resource"},
+	}
+	if !reflect.DeepEqual(expEdges, g.Edges) {
+		t.Errorf("Wrong edges: %+v != %+v", g.Edges, expEdges)
+	}
+}
+
+func TestGraphSingleLine(t *testing.T) {
+	procs := make([]string, 12)
+	for i := range procs {
+		procs[i] = `{"bloblang":"root = this"}`
+	}
+	g, err := ConfigGraph(`{"input":{"stdin":{}},"pipeline":{"processors":[` + strings.Join(procs, ",") + `]},"output":{"stdout":{}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expNodes := []string{"input"}
+	expEdges := []GraphEdge{{From: "input", To: "pipeline.processors.0", Type: EdgeFlow}}
+	for i := range procs {
+		p := IndexPath("pipeline.processors", i)
+		expNodes = append(expNodes, p)
+		if i > 0 {
+			expEdges = append(expEdges, GraphEdge{From: IndexPath("pipeline.processors", i-1), To: p, Type: EdgeFlow})
+		}
+	}
+	expNodes = append(expNodes, "output")
+	expEdges = append(expEdges, GraphEdge{From: "pipeline.processors.11", To: "output", Type: EdgeFlow})
+
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.ID)
+	}
+	if !reflect.DeepEqual(expNodes, nodes) {
+		t.Errorf("Wrong nodes: %v != %v", nodes, expNodes)
+	}
+	if !reflect.DeepEqual(expEdges, g.Edges) {
+		t.Errorf("Wrong edges: %v != %v", g.Edges, expEdges)
+	}
+}
+
+func TestMarshalGraph(t *testing.T) {
+	g, err := ConfigGraph(`pipeline:
+  processors:
+    - label: say_"hi"
+      bloblang: root = "hi"
+    - cache:
+        resource: foo
+        operator: get
+        key: bar
+resources:
+  caches:
+    foo:
+      memory: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dot, err := MarshalGraph(g, GraphDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expDOT := `digraph benthos {
+  rankdir=LR;
+  "pipeline.processors.0" [label="processor: bloblang\nsay_\"hi\"", shape=box];
+  "pipeline.processors.1" [label="processor: cache", shape=box];
+  "resources.caches.foo" [label="cache resource: memory\nfoo", shape=cylinder, style=dashed];
+  "pipeline.processors.0" -> "pipeline.processors.1";
+  "pipeline.processors.1" -> "resources.caches.foo" [label="cache.resource", style=dashed];
+}
+`
+	if act := string(dot); act != expDOT {
+		t.Errorf("Wrong DOT: %v != %v", act, expDOT)
+	}
+
+	mermaid, err := MarshalGraph(g, GraphMermaid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expMermaid := `flowchart LR
+  n0["processor: bloblang<br>say_#quot;hi#quot;"]
+  n1["processor: cache"]
+  n2["cache resource: memory<br>foo"]
+  n0 --> n1
+  n1 -.->|"cache.resource"| n2
+`
+	if act := string(mermaid); act != expMermaid {
+		t.Errorf("Wrong Mermaid: %v != %v", act, expMermaid)
+	}
+
+	jBytes, err := MarshalGraph(g, GraphJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Graph
+	if err = json.Unmarshal(jBytes, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*g, parsed) {
+		t.Errorf("Wrong JSON graph: %+v != %+v", parsed, *g)
+	}
+}
+
+func TestParseGraphFormat(t *testing.T) {
+	for name, exp := range map[string]GraphFormat{
+		"":        GraphJSON,
+		"json":    GraphJSON,
+		"dot":     GraphDOT,
+		"mermaid": GraphMermaid,
+	} {
+		format, err := ParseGraphFormat(name)
+		if err != nil {
+			t.Error(err)
+		}
+		if format != exp {
+			t.Errorf("Wrong format for '%v': %v != %v", name, format, exp)
+		}
+	}
+	if _, err := ParseGraphFormat("svg"); err == nil {
+		t.Error("Expected error")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"strings"
+
+	"github.com/Jeffail/benthos/v3/lib/output"
+	uconf "github.com/Jeffail/benthos/v3/lib/util/config"
+)
+
+//------------------------------------------------------------------------------
+
+// InterpolatedFields returns the fields of an output that contain interpolation
+// functions, such as a topic or a header that changes with each message, keyed
+// by their dot path relative to the output type, e.g. `headers.X-Foo`.
+func InterpolatedFields(conf output.Config) (map[string]string, error) {
+	fields := map[string]string{}
+	spec, exists := output.Constructors[conf.Type]
+	if !exists {
+		return fields, nil
+	}
+
+	sanit, err := conf.Sanitised(false)
+	if err != nil {
+		return nil, err
+	}
+	typeConf := asMap(asMap(sanit)[conf.Type])
+
+	for _, f := range spec.FieldSpecs {
+		if f.Interpolated {
+			collectInterpolated(f.Name, typeConf[f.Name], fields)
+		}
+		for _, c := range f.Children {
+			if c.Interpolated {
+				collectInterpolated(f.Name+"."+c.Name, asMap(typeConf[f.Name])[c.Name], fields)
+			}
+		}
+	}
+	return fields, nil
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	switch t := v.(type) {
+	case uconf.Sanitised:
+		return t
+	case map[string]interface{}:
+		return t
+	}
+	return nil
+}
+
+func collectInterpolated(path string, v interface{}, fields map[string]string) {
+	if str, ok := v.(string); ok {
+		if strings.Contains(str, "${!") {
+			fields[path] = str
+		}
+		return
+	}
+	for k, child := range asMap(v) {
+		collectInterpolated(path+"."+k, child, fields)
+	}
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,79 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterpolatedFields(t *testing.T) {
+	conf, err := Unmarshal(`
+output:
+  broker:
+    outputs:
+    - kafka:
+        addresses: [ localhost:9092 ]
+        topic: 'events_${! meta("kind") }'
+        key: '${! json("id") }'
+    - http_client:
+        url: http://example.com/post
+        headers:
+          X-Id: '${! json("id") }'
+    - stdout: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		index int
+		exp   map[string]string
+	}{
+		{
+			index: 0,
+			exp: map[string]string{
+				"topic": `events_${! meta("kind") }`,
+				"key":   `${! json("id") }`,
+			},
+		},
+		{
+			index: 1,
+			exp: map[string]string{
+				"headers.X-Id": `${! json("id") }`,
+			},
+		},
+		{
+			index: 2,
+			exp:   map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		act, err := InterpolatedFields(conf.Output.Broker.Outputs[test.index])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.exp, act) {
+			t.Errorf("Wrong fields for output %v: %v != %v", test.index, act, test.exp)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+// Format is the format of a config, which Benthos accepts as either YAML or
+// JSON.
+type Format string
+
+// The formats of a config.
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses the name of a format, where an empty name is YAML.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case "":
+		return FormatYAML, nil
+	case FormatYAML, FormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("format '%v' not recognised, expected yaml or json", name)
+}
+
+// DetectFormat returns the format of a config, which is JSON when it's an
+// object and YAML otherwise. A YAML flow mapping is also detected as JSON, and
+// so this only decides the format that a config is written back in.
+func DetectFormat(confStr string) Format {
+	if strings.HasPrefix(strings.TrimSpace(confStr), "{") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+//------------------------------------------------------------------------------
+
+// parseJSON parses a JSON document into a YAML node, keeping the order of
+// object keys.
+func parseJSON(confStr string) (*yaml.Node, error) {
+	dec := json.NewDecoder(strings.NewReader(confStr))
+	dec.UseNumber()
+	node, err := jsonNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = dec.Token(); err == nil {
+		return nil, fmt.Errorf("unexpected content after JSON object at offset %v", dec.InputOffset())
+	}
+	return node, nil
+}
+
+func jsonNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		node := newSequence()
+		if t == '{' {
+			node = newMapping()
+		}
+		for dec.More() {
+			if t == '{' {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{
+					Kind: yaml.ScalarNode, Tag: "!!str", Value: keyTok.(string),
+				})
+			}
+			child, err := jsonNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case json.Number:
+		tag := "!!float"
+		if _, err := t.Int64(); err == nil {
+			tag = "!!int"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
+
+//------------------------------------------------------------------------------
+
+// marshalJSON writes a YAML node as indented JSON, keeping the order of
+// mapping keys.
+func marshalJSON(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, node); err != nil {
+		return nil, err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSON(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONValue(buf, node.Content[i].Value); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, c := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, c); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return err
+	}
+	if err := writeJSONValue(buf, v); err != nil {
+		return fmt.Errorf("line %v: %w", node.Line, err)
+	}
+	return nil
+}
+
+// writeJSONValue writes a value as JSON without escaping HTML characters, which
+// are common within Bloblang mappings.
+func writeJSONValue(buf *bytes.Buffer, v interface{}) error {
+	var valueBuf bytes.Buffer
+	enc := json.NewEncoder(&valueBuf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimRight(valueBuf.Bytes(), "\n"))
+	return nil
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,166 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := map[string]Format{
+		"":                        FormatYAML,
+		"input:\n  stdin: {}\n":   FormatYAML,
+		`{"input":{"stdin":{}}}`:  FormatJSON,
+		"\n\t{\n\t\"input\": {}}": FormatJSON,
+	}
+	for conf, exp := range tests {
+		if act := DetectFormat(conf); act != exp {
+			t.Errorf("Wrong format for %q: %v != %v", conf, act, exp)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	conf, err := Unmarshal(`{
+	"input": {"type": "kafka", "kafka": {"addresses": ["foo:9092"], "max_batch_count": 5}},
+	"pipeline": {"threads": 2, "processors": [{"bloblang": "root = this.a > 10"}]}
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := "kafka", conf.Input.Type; exp != act {
+		t.Errorf("Wrong input type: %v != %v", act, exp)
+	}
+	if exp, act := 5, conf.Input.Kafka.MaxBatchCount; exp != act {
+		t.Errorf("Wrong batch count: %v != %v", act, exp)
+	}
+	if exp, act := 2, conf.Pipeline.Threads; exp != act {
+		t.Errorf("Wrong threads: %v != %v", act, exp)
+	}
+	if exp, act := "benthos_lab", conf.Output.Type; exp != act {
+		t.Errorf("Wrong output type: %v != %v", act, exp)
+	}
+
+	if conf, err = Unmarshal("{\n\t\"pipeline\": {\n\t\t\"threads\": 3\n\t}\n}"); err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 3, conf.Pipeline.Threads; exp != act {
+		t.Errorf("Wrong threads from tab indented JSON: %v != %v", act, exp)
+	}
+
+	if _, err = Unmarshal(`{"input": `); err == nil {
+		t.Error("Expected error from truncated JSON")
+	}
+}
+
+func TestUnmarshalFlowMapping(t *testing.T) {
+	confStr := `{pipeline: {threads: 2, processors: [{bloblang: 'root = this'}]}}`
+	conf, err := Unmarshal(confStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 2, conf.Pipeline.Threads; exp != act {
+		t.Errorf("Wrong threads: %v != %v", act, exp)
+	}
+	if exp, act := 1, len(conf.Pipeline.Processors); exp != act {
+		t.Fatalf("Wrong count of processors: %v != %v", act, exp)
+	}
+	if exp, act := "root = this", conf.Pipeline.Processors[0].Bloblang; exp != string(act) {
+		t.Errorf("Wrong mapping: %v != %v", act, exp)
+	}
+	if _, err = ParseDocument(confStr); err != nil {
+		t.Errorf("Expected document to parse: %v", err)
+	}
+}
+
+func TestMarshalJSONRoundTrip(t *testing.T) {
+	for _, mode := range []NormaliseMode{NormaliseStandard, NormaliseMinimal, NormaliseFull} {
+		conf, err := Unmarshal(normaliseConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		yamlBytes, err := MarshalWithConfig(conf, NormaliseConfig{Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jsonBytes, err := MarshalWithConfig(conf, NormaliseConfig{Mode: mode, Format: FormatJSON})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if DetectFormat(string(jsonBytes)) != FormatJSON {
+			t.Fatalf("Expected JSON output for %v: %s", mode, jsonBytes)
+		}
+
+		jsonConf, err := Unmarshal(string(jsonBytes))
+		if err != nil {
+			t.Fatalf("%v: %v", mode, err)
+		}
+		roundTripBytes, err := MarshalWithConfig(jsonConf, NormaliseConfig{Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp, act := string(yamlBytes), string(roundTripBytes); exp != act {
+			t.Errorf("Round trip of %v changed config:\n%v\n!=\n%v", mode, act, exp)
+		}
+	}
+}
+
+func TestMarshalJSONOrder(t *testing.T) {
+	conf, err := Unmarshal("pipeline:\n  processors:\n    - bloblang: 'root = this.a > 10 && this.b < 5'\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lab connectors are only documented within the runtime.
+	conf.Input.Type, conf.Output.Type = "stdin", "stdout"
+	res, err := MarshalWithConfig(conf, NormaliseConfig{Mode: NormaliseMinimal, Format: FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{
+  "input": {
+    "stdin": {}
+  },
+  "pipeline": {
+    "processors": [
+      {
+        "bloblang": "root = this.a > 10 && this.b < 5"
+      }
+    ]
+  },
+  "output": {
+    "stdout": {}
+  }
+}
+`
+	if act := string(res); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+
+	res, err = MarshalWithConfig(conf, NormaliseConfig{Format: FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, j := strings.Index(string(res), `"threads"`), strings.Index(string(res), `"processors"`); i < 0 || j < i {
+		t.Errorf("Expected threads before processors:\n%s", res)
+	}
+}
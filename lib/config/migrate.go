@@ -0,0 +1,511 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/benthos/v3/lib/cache"
+	"github.com/Jeffail/benthos/v3/lib/condition"
+	"github.com/Jeffail/benthos/v3/lib/input"
+	"github.com/Jeffail/benthos/v3/lib/output"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+// FollowUp is something that a migration couldn't do automatically and needs
+// doing by hand, at a path of the migrated config.
+type FollowUp struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (f FollowUp) String() string {
+	if len(f.Path) == 0 {
+		return f.Message
+	}
+	return f.Path + ": " + f.Message
+}
+
+const renamedFieldsNote = "was renamed to %v in v4, whose fields differ, check them against its docs"
+
+// v4Rename is a component type that was replaced in v4, along with any change
+// needed to its config and the path of the old config within the new one.
+type v4Rename struct {
+	to     string
+	note   string
+	body   func(body *yaml.Node) *yaml.Node
+	within string
+}
+
+func withNetwork(network string) func(*yaml.Node) *yaml.Node {
+	return func(body *yaml.Node) *yaml.Node {
+		if body.Kind == yaml.MappingNode && mapValue(body, "network") == nil {
+			setMapValue(body, "network", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: network}, 0)
+		}
+		return body
+	}
+}
+
+var v4Renames = map[string]map[string]v4Rename{
+	KindInput: {
+		"amqp":             {to: "amqp_0_9"},
+		"bloblang":         {to: "generate"},
+		"files":            {to: "file", note: renamedFieldsNote},
+		"kafka_balanced":   {to: "kafka", note: renamedFieldsNote},
+		"kinesis":          {to: "aws_kinesis", note: renamedFieldsNote},
+		"kinesis_balanced": {to: "aws_kinesis", note: renamedFieldsNote},
+		"s3":               {to: "aws_s3", note: renamedFieldsNote},
+		"sqs":              {to: "aws_sqs", note: renamedFieldsNote},
+		"tcp":              {to: "socket", note: renamedFieldsNote, body: withNetwork("tcp")},
+		"tcp_server":       {to: "socket_server", note: renamedFieldsNote, body: withNetwork("tcp")},
+		"udp_server":       {to: "socket_server", note: renamedFieldsNote, body: withNetwork("udp")},
+	},
+	KindOutput: {
+		"amqp":             {to: "amqp_0_9"},
+		"blob_storage":     {to: "azure_blob_storage", note: renamedFieldsNote},
+		"dynamodb":         {to: "aws_dynamodb", note: renamedFieldsNote},
+		"files":            {to: "file", note: renamedFieldsNote},
+		"kinesis":          {to: "aws_kinesis", note: renamedFieldsNote},
+		"kinesis_firehose": {to: "aws_kinesis_firehose", note: renamedFieldsNote},
+		"s3":               {to: "aws_s3", note: renamedFieldsNote},
+		"sns":              {to: "aws_sns", note: renamedFieldsNote},
+		"sqs":              {to: "aws_sqs", note: renamedFieldsNote},
+		"table_storage":    {to: "azure_table_storage", note: renamedFieldsNote},
+		"tcp":              {to: "socket", note: renamedFieldsNote, body: withNetwork("tcp")},
+		"udp":              {to: "socket", note: renamedFieldsNote, body: withNetwork("udp")},
+		"drop_on_error": {to: "drop_on", within: ".output", body: func(body *yaml.Node) *yaml.Node {
+			dropOn := newMapping()
+			setMapValue(dropOn, "error", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"}, -1)
+			setMapValue(dropOn, "output", body, -1)
+			return dropOn
+		}},
+	},
+	KindProcessor: {
+		"lambda": {to: "aws_lambda"},
+	},
+	KindCache: {
+		"dynamodb": {to: "aws_dynamodb", note: renamedFieldsNote},
+		"s3":       {to: "aws_s3", note: renamedFieldsNote},
+	},
+}
+
+func isDeprecated(kind, cType string) bool {
+	var status string
+	switch kind {
+	case KindInput:
+		status = string(input.Constructors[cType].Status)
+	case KindProcessor:
+		status = string(processor.Constructors[cType].Status)
+	case KindOutput:
+		status = string(output.Constructors[cType].Status)
+	case KindCache:
+		status = string(cache.Constructors[cType].Status)
+	}
+	return status == statusDeprecated
+}
+
+//------------------------------------------------------------------------------
+
+type followUps struct {
+	list  []FollowUp
+	seen  map[string]bool
+	moves [][2]string
+}
+
+// move records that the fields under a path were moved, the paths of follow-ups
+// are updated once the migration is done.
+func (f *followUps) move(from, to string) {
+	f.moves = append(f.moves, [2]string{from, to})
+}
+
+// done returns the follow-ups at their migrated paths. Moves are recorded
+// parents first, with paths from before their parents moved, and so they're
+// applied in reverse.
+func (f *followUps) done() []FollowUp {
+	for i, fu := range f.list {
+		for j := len(f.moves) - 1; j >= 0; j-- {
+			from, to := f.moves[j][0], f.moves[j][1]
+			if fu.Path == from || strings.HasPrefix(fu.Path, from+".") {
+				fu.Path = to + strings.TrimPrefix(fu.Path, from)
+			}
+		}
+		f.list[i] = fu
+	}
+	sort.SliceStable(f.list, func(i, j int) bool {
+		return f.list[i].Path < f.list[j].Path
+	})
+	return f.list
+}
+
+func (f *followUps) add(path, format string, args ...interface{}) {
+	if f.seen == nil {
+		f.seen = map[string]bool{}
+	}
+	message := fmt.Sprintf(format, args...)
+	if f.seen[path+"\n"+message] {
+		return
+	}
+	f.seen[path+"\n"+message] = true
+	f.list = append(f.list, FollowUp{Path: path, Message: message})
+}
+
+// MigrateV4 rewrites the document in the syntax of Benthos v4:
+//
+//   - Resources are moved from the resources field into lists such as
+//     cache_resources, labelled with their names.
+//   - Processors and conditions that were removed are upgraded as Bloblang, see
+//     Document.Upgrade, and any remaining condition fields become checks.
+//   - Components that were replaced are renamed, and renamed fields are moved.
+//   - Legacy interpolation functions such as ${!json_field:foo} are rewritten as
+//     Bloblang interpolations.
+//
+// Anything that can't be migrated is left as it is and returned as a follow-up.
+func (d *Document) MigrateV4() ([]FollowUp, error) {
+	var f followUps
+	d.migrateResources(&f)
+
+	upgrades, err := d.Upgrade()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range upgrades {
+		if _, renamed := v4Renames[KindProcessor][u.From]; !u.Upgraded() && !renamed {
+			f.add(u.Path, "%v was removed in v4 and could not be upgraded: %v", u.From, u.Reason)
+		}
+		if u.Upgraded() && (u.To == processor.TypeSwitch || u.To == "check") {
+			f.add(strings.TrimSuffix(u.Path, ".condition")+"."+u.To, batchFollowUp(u.Warning))
+		}
+	}
+
+	components, err := d.Components()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(components))
+	nodes := map[string]*yaml.Node{}
+	for p := range components {
+		if node, err := GetNode(&d.doc, p); err == nil && node.Kind == yaml.MappingNode {
+			paths = append(paths, p)
+			nodes[p] = node
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		migrateComponent(components[p], p, nodes[p], &f)
+	}
+
+	migrateConditions(d.Root(), "", &f)
+	migrateInterpolations(d.Root(), "", &f)
+
+	for _, k := range []string{"http", "logger", "metrics", "tracer"} {
+		if mapValue(d.Root(), k) != nil {
+			f.add(k, "the fields of %v changed in v4, check them against the docs", k)
+		}
+	}
+
+	return f.done(), nil
+}
+
+// MigrateConfigV4 migrates a config to the syntax of Benthos v4, returning the
+// result along with any follow-ups, see Document.MigrateV4.
+func MigrateConfigV4(confStr string) (string, []FollowUp, error) {
+	d, err := ParseDocument(confStr)
+	if err != nil {
+		return "", nil, err
+	}
+	follow, err := d.MigrateV4()
+	if err != nil {
+		return "", nil, err
+	}
+	resBytes, err := d.Bytes()
+	if err != nil {
+		return "", nil, err
+	}
+	return string(resBytes), follow, nil
+}
+
+//------------------------------------------------------------------------------
+
+// migrateResources moves the resources of the resources field into the lists
+// of each kind of resource.
+func (d *Document) migrateResources(f *followUps) {
+	resources := mapValue(d.Root(), "resources")
+	if resources == nil || resources.Kind != yaml.MappingNode {
+		return
+	}
+
+	var remaining []*yaml.Node
+	for i := 0; i < len(resources.Content)-1; i += 2 {
+		key, value := resources.Content[i], resources.Content[i+1]
+		listKey := ""
+		for _, fields := range resourceFields {
+			if fields[0] == key.Value {
+				listKey = fields[1]
+			}
+		}
+		if len(listKey) == 0 || value.Kind != yaml.MappingNode {
+			f.add("resources."+key.Value, "resources.%v was removed in v4", key.Value)
+			remaining = append(remaining, key, value)
+			continue
+		}
+
+		list := d.rootValue(listKey, newSequence)
+		for j := 0; j < len(value.Content)-1; j += 2 {
+			name, res := value.Content[j], value.Content[j+1]
+			item := newMapping()
+			item.HeadComment, item.LineComment = name.HeadComment, name.LineComment
+			setMapValue(item, "label", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name.Value}, -1)
+			for k := 0; k < len(res.Content)-1; k += 2 {
+				if res.Content[k].Value != "label" {
+					item.Content = append(item.Content, res.Content[k], res.Content[k+1])
+				}
+			}
+			appendItem(list, item)
+		}
+	}
+
+	if len(remaining) > 0 {
+		resources.Content = remaining
+		return
+	}
+	root := d.Root()
+	for i := 0; i < len(root.Content)-1; i += 2 {
+		if root.Content[i].Value == "resources" {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// migrateComponent renames the type of a component that was replaced in v4 and
+// moves its renamed fields. The type field is dropped in favour of the key of
+// its config.
+func migrateComponent(kind, path string, node *yaml.Node, f *followUps) {
+	cType := componentType(kind, node)
+	if len(cType) == 0 {
+		return
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		switch node.Content[i].Value {
+		case "type":
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			i -= 2
+		case "plugin":
+			if mapValue(node, cType) == nil {
+				node.Content[i].Value = cType
+			}
+		}
+	}
+	if mapValue(node, cType) == nil {
+		setMapValue(node, cType, newMapping(), -1)
+	}
+
+	if r, exists := v4Renames[kind][cType]; exists {
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			if node.Content[i].Value == cType {
+				node.Content[i].Value = r.to
+				f.move(path+"."+cType, path+"."+r.to+r.within)
+				if r.body != nil {
+					node.Content[i+1] = r.body(node.Content[i+1])
+				}
+			}
+		}
+		if len(r.note) > 0 {
+			f.add(path, "%v "+r.note, cType, r.to)
+		}
+		cType = r.to
+	} else if kind != KindProcessor && isDeprecated(kind, cType) {
+		f.add(path, "%v %v was removed in v4", kind, cType)
+	}
+
+	body := mapValue(node, cType)
+	if body == nil || body.Kind != yaml.MappingNode {
+		return
+	}
+	if mapKey(body, "max_batch_count") != nil {
+		removeMapKey(body, "max_batch_count")
+		f.add(path+"."+cType, "max_batch_count was removed in v4, use a batching policy instead")
+	}
+
+	switch {
+	case kind == KindInput && cType == "kafka":
+		topic := mapValue(body, "topic")
+		if topic == nil {
+			break
+		}
+		if topics := mapValue(body, "topics"); topics != nil && len(topics.Content) > 0 {
+			f.add(path+".kafka.topic", "topic was removed in v4, add it to topics")
+			break
+		}
+		partition := "0"
+		if p := mapValue(body, "partition"); p != nil {
+			partition = p.Value
+		}
+		topics := newSequence()
+		topics.Content = append(topics.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: topic.Value + ":" + partition})
+		setMapValue(body, "topics", topics, -1)
+		removeMapKey(body, "topic")
+		removeMapKey(body, "partition")
+	case kind == KindOutput && cType == "switch":
+		outputs := mapValue(body, "outputs")
+		if outputs == nil {
+			break
+		}
+		if cases := mapValue(body, "cases"); cases != nil && len(cases.Content) > 0 {
+			f.add(path+".switch.outputs", "outputs was removed in v4, merge them into cases")
+			break
+		}
+		removeMapKey(body, "cases")
+		mapKey(body, "outputs").Value = "cases"
+		f.move(path+".switch.outputs", path+".switch.cases")
+		for _, c := range outputs.Content {
+			if k := mapKey(c, "fallthrough"); k != nil {
+				k.Value = "continue"
+			}
+		}
+	case kind == KindProcessor && cType == "cache":
+		if k := mapKey(body, "cache"); k != nil && mapValue(body, "resource") == nil {
+			k.Value = "resource"
+			f.move(path+".cache.cache", path+".cache.resource")
+		}
+	case kind == KindProcessor && cType == "workflow":
+		if mapValue(body, "stages") != nil {
+			f.add(path+".workflow.stages", "stages was removed in v4, use branch_resources or branches with an order instead")
+		}
+	}
+}
+
+// batchFollowUp returns the follow-up for a condition that was rewritten as a
+// check, which runs against each message of a batch.
+func batchFollowUp(warning string) string {
+	if len(warning) > 0 {
+		return "the condition was rewritten as a check, " + warning
+	}
+	return "the condition was rewritten as a check, which runs against each message of a batch and reads the first with from(0), make sure it behaves the same"
+}
+
+func removeMapKey(node *yaml.Node, key string) {
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// migrateConditions replaces every condition field with a check, which is a
+// Bloblang query.
+func migrateConditions(node *yaml.Node, path string, f *followUps) {
+	join := func(key string) string {
+		if len(path) == 0 {
+			return key
+		}
+		return path + "." + key
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "condition" && value.Kind == yaml.MappingNode && mapValue(node, "check") == nil {
+				var cond condition.Config
+				query, err := decodeCondition(value, &cond)
+				if err != nil {
+					f.add(join(key.Value), "conditions were removed in v4 and this one could not be converted to a check: %v", err)
+					continue
+				}
+				f.add(join("check"), batchFollowUp(batchWarning(cond)))
+				key.Value = "check"
+				node.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: query}
+				continue
+			}
+			migrateConditions(value, join(key.Value), f)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			migrateConditions(item, IndexPath(path, i), f)
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+var legacyInterpRegex = regexp.MustCompile(`\$\{!([a-z_0-9]+)(?::([^}]*))?\}`)
+
+// legacyFunctions maps the legacy interpolation functions to their Bloblang
+// equivalents, those that take an argument are formatted with it quoted.
+var legacyFunctions = map[string]string{
+	"batch_size":          "batch_size()",
+	"content":             "content()",
+	"count":               "count(%v)",
+	"error":               "error()",
+	"hostname":            "hostname()",
+	"json_field":          "json(%v)",
+	"metadata":            "meta(%v)",
+	"timestamp_unix":      "timestamp_unix()",
+	"timestamp_unix_nano": "timestamp_unix_nano()",
+	"uuid_v4":             "uuid_v4()",
+}
+
+// migrateInterpolations rewrites the legacy interpolation functions of every
+// string as Bloblang interpolations.
+func migrateInterpolations(node *yaml.Node, path string, f *followUps) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			p := node.Content[i].Value
+			if len(path) > 0 {
+				p = path + "." + p
+			}
+			migrateInterpolations(node.Content[i+1], p, f)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			migrateInterpolations(item, IndexPath(path, i), f)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${!") {
+			return
+		}
+		node.Value = legacyInterpRegex.ReplaceAllStringFunc(node.Value, func(match string) string {
+			m := legacyInterpRegex.FindStringSubmatch(match)
+			name, arg, hasArg := m[1], m[2], strings.Contains(match, ":")
+			format, exists := legacyFunctions[name]
+			takesArg := strings.Contains(format, "%v")
+			if !exists || hasArg != takesArg || strings.Contains(arg, ",") {
+				f.add(path, "the legacy interpolation function %v has no automatic replacement in v4", match)
+				return match
+			}
+			if takesArg {
+				format = fmt.Sprintf(format, strconv.Quote(arg))
+			}
+			return "${! " + format + " }"
+		})
+	}
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,195 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrateConfigV4(t *testing.T) {
+	conf := `input:
+  type: kafka
+  kafka:
+    addresses: [ localhost:9092 ]
+    topic: foo
+    partition: 2
+  processors:
+    - text:
+        operator: to_upper
+    - type: cache
+      cache:
+        cache: foocache
+        operator: set
+        key: ${!json_field:id}
+        value: ${!content}
+    - lambda:
+        function: foo
+    - bloblang: 'root = "${!timestamp:2006}"'
+pipeline:
+  processors:
+    - switch:
+        - condition:
+            static: true
+          processors: []
+output:
+  type: switch
+  switch:
+    outputs:
+      - condition:
+          jmespath:
+            query: foo
+        fallthrough: true
+        output:
+          tcp:
+            address: localhost:1234
+      - output:
+          drop_on_error:
+            stdout: {}
+resources:
+  caches:
+    # The cache
+    foocache:
+      memory: {}
+  conditions:
+    bar:
+      static: true
+logger:
+  level: INFO
+`
+
+	res, follow, err := MigrateConfigV4(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `input:
+  kafka:
+    addresses: ['localhost:9092']
+    topics:
+      - foo:2
+  processors:
+    - bloblang: root = content().uppercase()
+    - cache:
+        resource: foocache
+        operator: set
+        key: ${! json("id") }
+        value: ${! content() }
+    - aws_lambda:
+        function: foo
+    - bloblang: 'root = "${!timestamp:2006}"'
+pipeline:
+  processors:
+    - switch:
+        - check: "true"
+          processors: []
+output:
+  switch:
+    cases:
+      - condition:
+          jmespath:
+            query: foo
+        continue: true
+        output:
+          socket:
+            network: tcp
+            address: localhost:1234
+      - output:
+          drop_on:
+            error: true
+            output:
+              stdout: {}
+resources:
+  conditions:
+    bar:
+      static: true
+cache_resources:
+  # The cache
+  - label: foocache
+    memory: {}
+logger:
+  level: INFO
+`
+	if res != exp {
+		t.Errorf("Wrong result: %v != %v", res, exp)
+	}
+
+	expFollow := []string{
+		"input.processors.3.bloblang",
+		"logger",
+		"output.switch.cases.0.condition",
+		"output.switch.cases.0.output",
+		"pipeline.processors.0.switch.0.check",
+		"resources.conditions",
+	}
+	var paths []string
+	for _, f := range follow {
+		paths = append(paths, f.Path)
+	}
+	if !reflect.DeepEqual(paths, expFollow) {
+		t.Errorf("Wrong follow-ups: %v != %v", follow, expFollow)
+	}
+}
+
+func TestMigrateConfigV4FollowUps(t *testing.T) {
+	conf := `pipeline:
+  processors:
+    - conditional:
+        condition:
+          bloblang: this.foo == "bar"
+        processors: []
+output:
+  http_client:
+    url: http://x/${!foo_bar}/${!timestamp}
+`
+
+	_, follow, err := MigrateConfigV4(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []FollowUp{
+		{Path: "output.http_client.url", Message: "the legacy interpolation function ${!foo_bar} has no automatic replacement in v4"},
+		{Path: "output.http_client.url", Message: "the legacy interpolation function ${!timestamp} has no automatic replacement in v4"},
+		{Path: "pipeline.processors.0.switch", Message: batchFollowUp(thisWarning)},
+	}
+	if !reflect.DeepEqual(exp, follow) {
+		t.Errorf("Wrong follow-ups: %v != %v", follow, exp)
+	}
+}
+
+func TestMigrateConfigV4Interpolations(t *testing.T) {
+	tests := map[string]string{
+		`${!count:foo}`:                      `${! count("foo") }`,
+		`${!metadata:kafka_key}-${!uuid_v4}`: `${! meta("kafka_key") }-${! uuid_v4() }`,
+		`${!json_field:foo,2}`:               `${!json_field:foo,2}`,
+		`${!hostname:foo}`:                   `${!hostname:foo}`,
+		`${! json("foo") }`:                  `${! json("foo") }`,
+	}
+	for in, exp := range tests {
+		res, _, err := MigrateConfigV4("output:\n  stdout:\n    delimiter: '" + in + "'\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := "output:\n  stdout:\n    delimiter: '" + exp + "'\n"; res != exp {
+			t.Errorf("Wrong result for %v: %v != %v", in, res, exp)
+		}
+	}
+}
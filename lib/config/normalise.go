@@ -21,7 +21,11 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/Jeffail/benthos/v3/lib/config"
+	"github.com/Jeffail/benthos/v3/lib/input"
+	"github.com/Jeffail/benthos/v3/lib/output"
 	uconf "github.com/Jeffail/benthos/v3/lib/util/config"
 	"gopkg.in/yaml.v3"
 )
@@ -37,14 +41,22 @@ func New() config.Type {
 	return conf
 }
 
-// Unmarshal a config string into a config struct with defaults that suit the
-// lab environment.
+// Unmarshal a config string, which is either YAML or JSON, into a config
+// struct with defaults that suit the lab environment.
 func Unmarshal(confStr string) (config.Type, error) {
 	conf := New()
-	if err := yaml.Unmarshal([]byte(confStr), &conf); err != nil {
+	err := yaml.Unmarshal([]byte(confStr), &conf)
+	if err == nil || DetectFormat(confStr) != FormatJSON {
 		return conf, err
 	}
-	return conf, nil
+
+	// YAML is a superset of most JSON, but not of JSON indented with tabs.
+	node, jErr := parseJSON(confStr)
+	if jErr != nil {
+		return conf, jErr
+	}
+	conf = New()
+	return conf, node.Decode(&conf)
 }
 
 type normalisedLabConfig struct {
@@ -60,30 +72,225 @@ type normalisedLabConfig struct {
 	RateLimitResources yaml.Node `yaml:"rate_limit_resources,omitempty"`
 }
 
+// NormaliseMode determines which fields are written when a config is
+// normalised.
+type NormaliseMode string
+
+// The modes of normalising a config.
+const (
+	// NormaliseStandard writes every field of each component, which is keyed
+	// by its type.
+	NormaliseStandard NormaliseMode = "standard"
+
+	// NormaliseMinimal leaves out the fields that are equal to their defaults.
+	NormaliseMinimal NormaliseMode = "minimal"
+
+	// NormaliseFull writes every field, including the type of each component
+	// and the buffer and lab connectors that are otherwise implied.
+	NormaliseFull NormaliseMode = "full"
+)
+
+// ParseNormaliseMode parses the name of a normalise mode, where an empty name
+// is the standard mode.
+func ParseNormaliseMode(name string) (NormaliseMode, error) {
+	switch mode := NormaliseMode(name); mode {
+	case "":
+		return NormaliseStandard, nil
+	case NormaliseStandard, NormaliseMinimal, NormaliseFull:
+		return mode, nil
+	}
+	return "", fmt.Errorf("normalise mode '%v' not recognised", name)
+}
+
+// NormaliseConfig determines how a config is normalised.
+type NormaliseConfig struct {
+	Mode             NormaliseMode
+	RemoveDeprecated bool
+	Format           Format
+}
+
+// ParseNormaliseConfig parses the name of a normalise mode, whether
+// deprecated fields should be kept or stripped and the name of a format, where
+// empty values are the standard mode, keeping deprecated fields and YAML.
+func ParseNormaliseConfig(mode, deprecated, format string) (NormaliseConfig, error) {
+	var nConf NormaliseConfig
+	var err error
+	if nConf.Mode, err = ParseNormaliseMode(mode); err != nil {
+		return nConf, err
+	}
+	if nConf.Format, err = ParseFormat(format); err != nil {
+		return nConf, err
+	}
+	switch deprecated {
+	case "", "keep":
+	case "strip":
+		nConf.RemoveDeprecated = true
+	default:
+		return nConf, fmt.Errorf("deprecated fields option '%v' not recognised, expected keep or strip", deprecated)
+	}
+	return nConf, nil
+}
+
 // Marshal a config struct into a subset of fields relevant to the lab
 // environment.
 func Marshal(conf config.Type) ([]byte, error) {
+	return MarshalWithConfig(conf, NormaliseConfig{})
+}
+
+// MarshalWithConfig marshals a config struct into a subset of fields relevant
+// to the lab environment in a normalise mode and format.
+func MarshalWithConfig(conf config.Type, nConf NormaliseConfig) ([]byte, error) {
+	format, err := ParseFormat(string(nConf.Format))
+	if err != nil {
+		return nil, err
+	}
+	node, err := normalisedNode(conf, nConf)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatJSON {
+		return marshalJSON(node)
+	}
+	return uconf.MarshalYAML(node)
+}
+
+func normalisedNode(conf config.Type, nConf NormaliseConfig) (*yaml.Node, error) {
+	mode, err := ParseNormaliseMode(string(nConf.Mode))
+	if err != nil {
+		return nil, err
+	}
 	node, err := conf.SanitisedV2(config.SanitisedV2Config{
-		RemoveTypeField:        true,
-		RemoveDeprecatedFields: false,
+		RemoveTypeField:        mode != NormaliseFull,
+		RemoveDeprecatedFields: nConf.RemoveDeprecated,
 	})
 	if err != nil {
 		return nil, err
 	}
-	nConf := normalisedLabConfig{}
-	if err := node.Decode(&nConf); err != nil {
+	lConf := normalisedLabConfig{}
+	if err := node.Decode(&lConf); err != nil {
+		return nil, err
+	}
+	if mode != NormaliseFull {
+		if conf.Input.Type == "benthos_lab" {
+			lConf.Input = yaml.Node{}
+		}
+		if conf.Output.Type == "benthos_lab" {
+			lConf.Output = yaml.Node{}
+		}
+		if conf.Buffer.Type == "none" {
+			lConf.Buffer = yaml.Node{}
+		}
+	}
+
+	var res yaml.Node
+	if err = res.Encode(lConf); err != nil {
 		return nil, err
 	}
-	if conf.Input.Type == "benthos_lab" {
-		nConf.Input = yaml.Node{}
+	if mode == NormaliseMinimal {
+		if err = minimise(&conf, &res); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+//------------------------------------------------------------------------------
+
+// minimise removes the fields of a normalised config that are equal to their
+// defaults. Each component is compared with a default component of its type,
+// and everything else with a default config.
+func minimise(conf *config.Type, root *yaml.Node) error {
+	kinds := componentKinds(conf)
+	defaults := map[string]*yaml.Node{}
+	for path, kind := range kinds {
+		node, err := GetNode(root, path)
+		if err != nil {
+			continue
+		}
+		cType := componentType(kind, node)
+		if len(cType) == 0 {
+			continue
+		}
+		def, exists := defaults[kind+"."+cType]
+		if !exists {
+			if def, err = defaultNode(kind, cType); err != nil {
+				return err
+			}
+			defaults[kind+"."+cType] = def
+		}
+		pruneDefaults(node, def, path, kinds, cType, "type")
+	}
+
+	// The lab connectors are only documented once registered by the runtime,
+	// and the root input and output are components anyway.
+	defConf := New()
+	defConf.Input.Type = input.TypeSTDIN
+	defConf.Output.Type = output.TypeSTDOUT
+	def, err := normalisedNode(defConf, NormaliseConfig{})
+	if err != nil {
+		return err
+	}
+	pruneDefaults(root, def, "", kinds)
+	return nil
+}
+
+// pruneDefaults removes the fields of a mapping node that are equal to those of
+// a default node, recursing into mappings that differ. Nested components are
+// left for their own defaults, and the keep fields are never removed.
+func pruneDefaults(node, def *yaml.Node, path string, components map[string]string, keep ...string) {
+	if node.Kind != yaml.MappingNode || def.Kind != yaml.MappingNode {
+		return
+	}
+	content := make([]*yaml.Node, 0, len(node.Content))
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		p := k.Value
+		if len(path) > 0 {
+			p = path + "." + k.Value
+		}
+		if _, isComponent := components[p]; !isComponent {
+			if dv := mapValue(def, k.Value); dv != nil {
+				kept := containsStr(keep, k.Value)
+				if !kept && nodesEqual(v, dv) {
+					continue
+				}
+				wasEmpty := len(v.Content) == 0
+				pruneDefaults(v, dv, p, components)
+
+				// Mappings left empty only held defaults.
+				if !kept && !wasEmpty && len(v.Content) == 0 {
+					continue
+				}
+			}
+		}
+		content = append(content, k, v)
+	}
+	node.Content = content
+}
+
+func containsStr(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// nodesEqual returns true if two nodes hold the same values.
+func nodesEqual(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
 	}
-	if conf.Output.Type == "benthos_lab" {
-		nConf.Output = yaml.Node{}
+	if a.Kind == yaml.ScalarNode && (a.Value != b.Value || a.ShortTag() != b.ShortTag()) {
+		return false
 	}
-	if conf.Buffer.Type == "none" {
-		nConf.Buffer = yaml.Node{}
+	for i := range a.Content {
+		if !nodesEqual(a.Content[i], b.Content[i]) {
+			return false
+		}
 	}
-	return uconf.MarshalYAML(nConf)
+	return true
 }
 
 //------------------------------------------------------------------------------
@@ -0,0 +1,167 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const normaliseConfig = `input:
+  kafka:
+    addresses: [ foo:9092 ]
+    topics: [ bar ]
+    max_batch_count: 1
+  processors:
+    - noop: {}
+pipeline:
+  threads: 1
+  processors:
+    - sleep:
+        duration: 1s
+output:
+  retry:
+    output:
+      http_client:
+        url: http://foo
+        verb: POST
+cache_resources:
+  - label: foo
+    memory:
+      ttl: 300
+`
+
+func TestMarshalMinimal(t *testing.T) {
+	conf, err := Unmarshal(normaliseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := MarshalWithConfig(conf, NormaliseConfig{Mode: NormaliseMinimal})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `input:
+  kafka:
+    addresses:
+      - foo:9092
+    topics:
+      - bar
+  processors:
+    - noop: {}
+pipeline:
+  processors:
+    - sleep:
+        duration: 1s
+output:
+  retry:
+    output:
+      http_client:
+        url: http://foo
+cache_resources:
+  - label: foo
+    memory: {}
+`
+	if act := string(res); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+}
+
+func TestMarshalDeprecated(t *testing.T) {
+	conf, err := Unmarshal(normaliseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := MarshalWithConfig(conf, NormaliseConfig{Mode: NormaliseStandard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(res), "max_batch_count: 1") {
+		t.Errorf("Expected deprecated field to be kept:\n%s", res)
+	}
+
+	res, err = MarshalWithConfig(conf, NormaliseConfig{Mode: NormaliseStandard, RemoveDeprecated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(res), "max_batch_count") {
+		t.Errorf("Expected deprecated field to be removed:\n%s", res)
+	}
+}
+
+func TestMarshalFull(t *testing.T) {
+	conf, err := Unmarshal(normaliseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := MarshalWithConfig(conf, NormaliseConfig{Mode: NormaliseFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{
+		"  type: kafka\n",
+		"    consumer_group: benthos_consumer_group\n",
+		"buffer:\n  type: none\n",
+		"      type: http_client\n",
+	} {
+		if !strings.Contains(string(res), exp) {
+			t.Errorf("Expected %q within result:\n%s", exp, res)
+		}
+	}
+}
+
+func TestParseNormaliseMode(t *testing.T) {
+	tests := map[string]NormaliseMode{
+		"":         NormaliseStandard,
+		"standard": NormaliseStandard,
+		"minimal":  NormaliseMinimal,
+		"full":     NormaliseFull,
+	}
+	for name, exp := range tests {
+		act, err := ParseNormaliseMode(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if act != exp {
+			t.Errorf("Wrong mode for '%v': %v != %v", name, act, exp)
+		}
+	}
+	if _, err := ParseNormaliseMode("nope"); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestParseNormaliseConfig(t *testing.T) {
+	nConf, err := ParseNormaliseConfig("minimal", "strip", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := (NormaliseConfig{Mode: NormaliseMinimal, RemoveDeprecated: true, Format: FormatJSON}); nConf != exp {
+		t.Errorf("Wrong config: %v != %v", nConf, exp)
+	}
+	if _, err = ParseNormaliseConfig("", "nope", ""); err == nil {
+		t.Error("Expected error")
+	}
+	if _, err = ParseNormaliseConfig("", "", "toml"); err == nil {
+		t.Error("Expected error")
+	}
+}
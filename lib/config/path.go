@@ -0,0 +1,94 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+// GetNode walks a parsed YAML document following a dot separated path, where
+// each segment is either a mapping key or a sequence index, and returns the
+// node found at the end of it.
+func GetNode(root *yaml.Node, path string) (*yaml.Node, error) {
+	node := root
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil, fmt.Errorf("path '%v' not found: document is empty", path)
+		}
+		node = node.Content[0]
+	}
+	if len(path) == 0 {
+		return node, nil
+	}
+
+	for _, seg := range strings.Split(path, ".") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i < len(node.Content)-1; i += 2 {
+				if node.Content[i].Value == seg {
+					next = node.Content[i+1]
+					break
+				}
+			}
+			if next == nil {
+				return nil, fmt.Errorf("path '%v' not found: key '%v' does not exist", path, seg)
+			}
+			node = next
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(seg)
+			if err != nil {
+				return nil, fmt.Errorf("path '%v' not found: expected index, got '%v'", path, seg)
+			}
+			if i < 0 || i >= len(node.Content) {
+				return nil, fmt.Errorf("path '%v' not found: index %v out of bounds", path, i)
+			}
+			node = node.Content[i]
+		default:
+			return nil, fmt.Errorf("path '%v' not found: segment '%v' reached a scalar", path, seg)
+		}
+	}
+	return node, nil
+}
+
+// PathLines parses a config and returns the line number that each of a list
+// of paths begins at. Paths that cannot be found are omitted.
+func PathLines(confStr string, paths []string) (map[string]int, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(confStr), &root); err != nil {
+		return nil, err
+	}
+	lines := map[string]int{}
+	for _, p := range paths {
+		if node, err := GetNode(&root, p); err == nil {
+			lines[p] = node.Line
+		}
+	}
+	return lines, nil
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,69 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathLines(t *testing.T) {
+	conf := `pipeline:
+  processors:
+  - bloblang: 'root = this'
+  - switch:
+    - check: 'this.foo == "bar"'
+      processors:
+      - noop: {}
+    - processors:
+      - type: bloblang
+        bloblang: 'root = "baz"'
+`
+
+	lines, err := PathLines(conf, []string{
+		"pipeline.processors",
+		"pipeline.processors.0",
+		"pipeline.processors.1.switch.0",
+		"pipeline.processors.1.switch.1.processors.0",
+		"pipeline.processors.2",
+		"pipeline.processors.0.bloblang.foo",
+		"pipeline.nope",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[string]int{
+		"pipeline.processors":                         3,
+		"pipeline.processors.0":                       3,
+		"pipeline.processors.1.switch.0":              5,
+		"pipeline.processors.1.switch.1.processors.0": 9,
+	}
+	if !reflect.DeepEqual(exp, lines) {
+		t.Errorf("Wrong lines: %v != %v", lines, exp)
+	}
+}
+
+func TestPathLinesBadConfig(t *testing.T) {
+	if _, err := PathLines("foo: [", nil); err == nil {
+		t.Error("Expected error")
+	}
+}
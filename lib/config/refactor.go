@@ -0,0 +1,487 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/benthos/v3/lib/cache"
+	"github.com/Jeffail/benthos/v3/lib/config"
+	"github.com/Jeffail/benthos/v3/lib/input"
+	"github.com/Jeffail/benthos/v3/lib/output"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"github.com/Jeffail/benthos/v3/lib/ratelimit"
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+// The kinds of component that can be found within a config.
+const (
+	KindInput     = "input"
+	KindProcessor = "processor"
+	KindOutput    = "output"
+	KindCache     = "cache"
+	KindRatelimit = "ratelimit"
+)
+
+// Components returns the YAML path of every component within the document
+// mapped to its kind.
+func (d *Document) Components() (map[string]string, error) {
+	conf := New()
+	if err := d.Root().Decode(&conf); err != nil {
+		return nil, err
+	}
+
+	kinds := componentKinds(&conf)
+
+	// The lab connectors are implied when the input or output is missing.
+	for _, k := range []string{"input", "output"} {
+		if mapValue(d.Root(), k) == nil {
+			delete(kinds, k)
+		}
+	}
+	return kinds, nil
+}
+
+// componentKinds returns the YAML path of every component within a config
+// mapped to its kind.
+func componentKinds(conf *config.Type) map[string]string {
+	kinds := map[string]string{}
+	WalkInputs(conf, func(path string, _ *input.Config) {
+		kinds[path] = KindInput
+	})
+	WalkOutputs(conf, func(path string, _ *output.Config) {
+		kinds[path] = KindOutput
+	})
+	WalkProcessors(conf, func(path string, procs *[]processor.Config) {
+		for i := range *procs {
+			kinds[IndexPath(path, i)] = KindProcessor
+		}
+	})
+	for k := range conf.Manager.Processors {
+		kinds["resources.processors."+k] = KindProcessor
+	}
+	for k := range conf.Manager.Caches {
+		kinds["resources.caches."+k] = KindCache
+	}
+	for i := range conf.ResourceCaches {
+		kinds[IndexPath("cache_resources", i)] = KindCache
+	}
+	for k := range conf.Manager.RateLimits {
+		kinds["resources.rate_limits."+k] = KindRatelimit
+	}
+	for i := range conf.ResourceRateLimits {
+		kinds[IndexPath("rate_limit_resources", i)] = KindRatelimit
+	}
+	return kinds
+}
+
+// kindOf returns the kind of the component at a path.
+func (d *Document) kindOf(path string) (string, error) {
+	kinds, err := d.Components()
+	if err != nil {
+		return "", err
+	}
+	kind, exists := kinds[path]
+	if !exists {
+		return "", fmt.Errorf("no component found at path '%v'", path)
+	}
+	return kind, nil
+}
+
+// ComponentAt returns the path and kind of the innermost component that spans
+// a line of the document, or an empty path if there isn't one.
+func (d *Document) ComponentAt(line int) (path, kind string, err error) {
+	kinds, err := d.Components()
+	if err != nil {
+		return "", "", err
+	}
+	bestStart := 0
+	for p, k := range kinds {
+		node, keyNode, err := d.lookup(p)
+		if err != nil {
+			continue
+		}
+		start, end := nodeLines(node)
+		if keyNode != nil {
+			start = keyNode.Line
+		}
+		if start > line || end < line {
+			continue
+		}
+		if len(path) == 0 || start > bestStart || (start == bestStart && len(p) > len(path)) {
+			path, kind, bestStart = p, k, start
+		}
+	}
+	return path, kind, nil
+}
+
+// nodeLines returns the first and last lines of a node and its children.
+func nodeLines(node *yaml.Node) (start, end int) {
+	start, end = node.Line, node.Line
+	for _, c := range node.Content {
+		if _, cEnd := nodeLines(c); cEnd > end {
+			end = cEnd
+		}
+	}
+	return
+}
+
+//------------------------------------------------------------------------------
+
+// lookup returns the node at a path along with its key node when its parent is
+// a mapping.
+func (d *Document) lookup(path string) (node, keyNode *yaml.Node, err error) {
+	parent, last, err := d.parentOf(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch parent.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(parent.Content)-1; i += 2 {
+			if parent.Content[i].Value == last {
+				return parent.Content[i+1], parent.Content[i], nil
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(last); err == nil && i >= 0 && i < len(parent.Content) {
+			return parent.Content[i], nil, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("path '%v' not found", path)
+}
+
+// parentOf returns the node containing a path along with the last segment of
+// the path.
+func (d *Document) parentOf(path string) (*yaml.Node, string, error) {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return d.Root(), path, nil
+	}
+	parent, err := GetNode(&d.doc, path[:i])
+	if err != nil {
+		return nil, "", err
+	}
+	return parent, path[i+1:], nil
+}
+
+// setNode replaces the node at a path.
+func (d *Document) setNode(path string, node *yaml.Node) error {
+	parent, last, err := d.parentOf(path)
+	if err != nil {
+		return err
+	}
+	if parent.Kind == yaml.SequenceNode {
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i >= len(parent.Content) {
+			return fmt.Errorf("path '%v' not found", path)
+		}
+		d.moveSpacing(parent.Content[i], node)
+		parent.Content[i] = node
+		return nil
+	}
+	if old := mapValue(parent, last); old != nil {
+		d.moveSpacing(old, node)
+	}
+	setMapValue(parent, last, node, -1)
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// Remove deletes the component at a path. Removing the output of a switch case
+// removes the case, and removing the input or output of the config leaves the
+// lab connector in its place.
+func (d *Document) Remove(path string) error {
+	if _, err := d.kindOf(path); err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(path, ".output") {
+		casePath := strings.TrimSuffix(path, ".output")
+		if cases, last, err := d.parentOf(casePath); err == nil && cases.Kind == yaml.SequenceNode {
+			return removeItem(cases, last)
+		}
+	}
+
+	parent, last, err := d.parentOf(path)
+	if err != nil {
+		return err
+	}
+	if parent.Kind == yaml.SequenceNode {
+		return removeItem(parent, last)
+	}
+	for i := 0; i < len(parent.Content)-1; i += 2 {
+		if parent.Content[i].Value == last {
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("path '%v' not found", path)
+}
+
+func removeItem(seq *yaml.Node, index string) error {
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(seq.Content) {
+		return fmt.Errorf("index '%v' not found", index)
+	}
+	seq.Content = append(seq.Content[:i], seq.Content[i+1:]...)
+	return nil
+}
+
+// Move changes the position of the component at a path within the list that
+// contains it, such as the processors of a pipeline.
+func (d *Document) Move(path string, to int) error {
+	if _, err := d.kindOf(path); err != nil {
+		return err
+	}
+	parent, last, err := d.parentOf(path)
+	if err != nil {
+		return err
+	}
+	if parent.Kind != yaml.SequenceNode {
+		return fmt.Errorf("component at path '%v' is not within a list", path)
+	}
+	from, _ := strconv.Atoi(last)
+	if to < 0 || to >= len(parent.Content) {
+		return fmt.Errorf("index %v is out of bounds", to)
+	}
+	node := parent.Content[from]
+	parent.Content = append(parent.Content[:from], parent.Content[from+1:]...)
+	parent.Content = append(parent.Content[:to], append([]*yaml.Node{node}, parent.Content[to:]...)...)
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+func isComponentType(kind, cType string) bool {
+	if cType == "benthos_lab" {
+		return kind == KindInput || kind == KindOutput
+	}
+	var exists bool
+	switch kind {
+	case KindInput:
+		_, exists = input.Constructors[cType]
+	case KindProcessor:
+		_, exists = processor.Constructors[cType]
+	case KindOutput:
+		_, exists = output.Constructors[cType]
+	case KindCache:
+		_, exists = cache.Constructors[cType]
+	case KindRatelimit:
+		_, exists = ratelimit.Constructors[cType]
+	}
+	return exists
+}
+
+// componentType returns the type of a component node, which is either set
+// explicitly or implied by the key of its config.
+func componentType(kind string, node *yaml.Node) string {
+	if t := mapValue(node, "type"); t != nil {
+		return t.Value
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if k := node.Content[i].Value; isComponentType(kind, k) {
+			return k
+		}
+	}
+	return ""
+}
+
+// defaultNode returns the normalised node of a default component.
+func defaultNode(kind, cType string) (*yaml.Node, error) {
+	conf := New()
+	switch kind {
+	case KindInput:
+		if err := AddInput(cType, &conf); err != nil {
+			return nil, err
+		}
+		return inputNode(cType)
+	case KindOutput:
+		if err := AddOutput(cType, &conf); err != nil {
+			return nil, err
+		}
+		return outputNode(cType)
+	case KindProcessor:
+		if err := AddProcessor(cType, &conf); err != nil {
+			return nil, err
+		}
+		return componentNode(conf, "pipeline.processors.0")
+	case KindCache:
+		if err := AddCache(cType, &conf); err != nil {
+			return nil, err
+		}
+		return componentNode(conf, "cache_resources.0")
+	case KindRatelimit:
+		if err := AddRatelimit(cType, &conf); err != nil {
+			return nil, err
+		}
+		return componentNode(conf, "rate_limit_resources.0")
+	}
+	return nil, fmt.Errorf("unrecognised component kind: %v", kind)
+}
+
+// compatible returns true if the value of a field can be kept when a component
+// changes type.
+func compatible(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind {
+		return false
+	}
+	return a.Kind != yaml.ScalarNode || a.ShortTag() == b.ShortTag()
+}
+
+// Replace changes the type of the component at a path. Fields common to all
+// components, such as labels and processors, are kept, as are the fields of
+// the old type that the new type shares the name and kind of.
+func (d *Document) Replace(path, cType string) error {
+	kind, err := d.kindOf(path)
+	if err != nil {
+		return err
+	}
+	old, _, err := d.lookup(path)
+	if err != nil {
+		return err
+	}
+	if old.Kind != yaml.MappingNode {
+		return fmt.Errorf("component at path '%v' is not a mapping", path)
+	}
+	oldType := componentType(kind, old)
+	if oldType == cType {
+		return nil
+	}
+
+	node, err := defaultNode(kind, cType)
+	if err != nil {
+		return err
+	}
+	node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+
+	oldConf := mapValue(old, oldType)
+	for i := 0; i < len(old.Content)-1; i += 2 {
+		key, value := old.Content[i], old.Content[i+1]
+		switch key.Value {
+		case "type", "plugin":
+		case oldType:
+			if typeKey := mapKey(node, cType); typeKey != nil {
+				typeKey.HeadComment, typeKey.LineComment = key.HeadComment, key.LineComment
+			}
+		default:
+			setMapPair(node, key, value)
+		}
+	}
+
+	newConf := mapValue(node, cType)
+	if oldConf != nil && newConf != nil && oldConf.Kind == yaml.MappingNode && newConf.Kind == yaml.MappingNode {
+		for i := 0; i < len(newConf.Content)-1; i += 2 {
+			oldKey := mapKey(oldConf, newConf.Content[i].Value)
+			if oldKey == nil {
+				continue
+			}
+			if oldValue := mapValue(oldConf, oldKey.Value); compatible(oldValue, newConf.Content[i+1]) {
+				newConf.Content[i], newConf.Content[i+1] = oldKey, oldValue
+			}
+		}
+	}
+	return d.setNode(path, node)
+}
+
+// mapKey returns the key node of a key within a mapping node, or nil.
+func mapKey(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// setMapPair sets a key and value within a mapping node, keeping the key node
+// and therefore its comments.
+func setMapPair(node, key, value *yaml.Node) {
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key.Value {
+			node.Content[i], node.Content[i+1] = key, value
+			return
+		}
+	}
+	node.Content = append(node.Content, key, value)
+}
+
+//------------------------------------------------------------------------------
+
+// Wrappers are the processors that another processor can be wrapped in.
+var Wrappers = []string{"try", "catch", "branch"}
+
+// Wrap places the processor at a path within a new processor of a type, which
+// must be one of Wrappers.
+func (d *Document) Wrap(path, wrapper string) error {
+	kind, err := d.kindOf(path)
+	if err != nil {
+		return err
+	}
+	if kind != KindProcessor {
+		return fmt.Errorf("component at path '%v' is not a processor", path)
+	}
+
+	wrapperNode, err := defaultNode(KindProcessor, wrapper)
+	if err != nil {
+		return err
+	}
+	var list *yaml.Node
+	switch wrapper {
+	case "try", "catch":
+		list = mapValue(wrapperNode, wrapper)
+	case "branch":
+		if branch := mapValue(wrapperNode, "branch"); branch != nil {
+			list = mapValue(branch, "processors")
+
+			// Without mappings a branch discards the results of its processors,
+			// so carry the whole message through in both directions.
+			for _, key := range []string{"request_map", "result_map"} {
+				setMapValue(branch, key, &yaml.Node{
+					Kind:  yaml.ScalarNode,
+					Tag:   "!!str",
+					Value: "root = this",
+				}, -1)
+			}
+		}
+	default:
+		return fmt.Errorf("processors cannot be wrapped with '%v'", wrapper)
+	}
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return errors.New("wrapper processor has no list of processors")
+	}
+
+	node, _, err := d.lookup(path)
+	if err != nil {
+		return err
+	}
+	list.Content = nil
+	appendItem(list, node)
+	wrapperNode.HeadComment, node.HeadComment = node.HeadComment, ""
+	return d.setNode(path, wrapperNode)
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,350 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const refactorConfig = `input:
+  stdin: {}
+
+pipeline:
+  processors:
+    # Parse first
+    - bloblang: root = this
+    - label: second
+      jmespath:
+        query: foo
+    - noop: {}
+output:
+  drop: {}
+`
+
+func refactorDoc(t *testing.T) *Document {
+	t.Helper()
+	d, err := ParseDocument(refactorConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func docString(t *testing.T, d *Document) string {
+	t.Helper()
+	res, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(res)
+}
+
+func TestDocumentComponents(t *testing.T) {
+	kinds, err := refactorDoc(t).Components()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]string{
+		"input":                 KindInput,
+		"pipeline.processors.0": KindProcessor,
+		"pipeline.processors.1": KindProcessor,
+		"pipeline.processors.2": KindProcessor,
+		"output":                KindOutput,
+	}
+	if len(kinds) != len(exp) {
+		t.Errorf("Wrong components: %v", kinds)
+	}
+	for k, v := range exp {
+		if kinds[k] != v {
+			t.Errorf("Wrong kind for %v: %v != %v", k, kinds[k], v)
+		}
+	}
+}
+
+func TestDocumentComponentAt(t *testing.T) {
+	d := refactorDoc(t)
+	tests := map[int]string{
+		1:  "input",
+		2:  "input",
+		7:  "pipeline.processors.0",
+		9:  "pipeline.processors.1",
+		10: "pipeline.processors.1",
+		11: "pipeline.processors.2",
+		13: "output",
+	}
+	for line, exp := range tests {
+		path, _, err := d.ComponentAt(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != exp {
+			t.Errorf("Wrong component at line %v: %v != %v", line, path, exp)
+		}
+	}
+	if path, _, _ := d.ComponentAt(4); path != "" {
+		t.Errorf("Unexpected component at line 4: %v", path)
+	}
+}
+
+func TestDocumentRemove(t *testing.T) {
+	d := refactorDoc(t)
+	if err := d.Remove("pipeline.processors.1"); err != nil {
+		t.Fatal(err)
+	}
+	exp := `input:
+  stdin: {}
+
+pipeline:
+  processors:
+    # Parse first
+    - bloblang: root = this
+    - noop: {}
+output:
+  drop: {}
+`
+	if act := docString(t, d); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+	if err := d.Remove("pipeline.processors.5"); err == nil {
+		t.Error("Expected error from missing component")
+	}
+	if err := d.Remove("pipeline"); err == nil {
+		t.Error("Expected error from non-component")
+	}
+}
+
+func TestDocumentRemoveSwitchCase(t *testing.T) {
+	d, err := ParseDocument(`output:
+  switch:
+    cases:
+      - check: this.foo
+        output:
+          drop: {}
+      - output:
+          stdout: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Remove("output.switch.cases.0.output"); err != nil {
+		t.Fatal(err)
+	}
+	exp := `output:
+  switch:
+    cases:
+      - output:
+          stdout: {}
+`
+	if act := docString(t, d); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+}
+
+func TestDocumentMove(t *testing.T) {
+	d := refactorDoc(t)
+	if err := d.Move("pipeline.processors.0", 2); err != nil {
+		t.Fatal(err)
+	}
+	exp := `input:
+  stdin: {}
+
+pipeline:
+  processors:
+    - label: second
+      jmespath:
+        query: foo
+    - noop: {}
+    # Parse first
+    - bloblang: root = this
+output:
+  drop: {}
+`
+	if act := docString(t, d); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+	if err := d.Move("pipeline.processors.0", 3); err == nil {
+		t.Error("Expected error from out of bounds index")
+	}
+	if err := d.Move("input", 0); err == nil {
+		t.Error("Expected error from component outside of a list")
+	}
+}
+
+func TestDocumentRemoveSpacing(t *testing.T) {
+	d, err := ParseDocument(spacedListConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Remove("pipeline.processors.1"); err != nil {
+		t.Fatal(err)
+	}
+	exp := `pipeline:
+  processors:
+    # First
+    - bloblang: root = "first"
+
+    - label: third
+      bloblang: root = "third"
+`
+	if act := docString(t, d); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+
+	if d, err = ParseDocument(spacedListConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Remove("pipeline.processors.0"); err != nil {
+		t.Fatal(err)
+	}
+	exp = `pipeline:
+  processors:
+
+    # Second
+    - bloblang: root = "second"
+
+    - label: third
+      bloblang: root = "third"
+`
+	if act := docString(t, d); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+}
+
+func TestDocumentMoveSpacing(t *testing.T) {
+	d, err := ParseDocument(spacedListConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Move("pipeline.processors.2", 1); err != nil {
+		t.Fatal(err)
+	}
+	exp := `pipeline:
+  processors:
+    # First
+    - bloblang: root = "first"
+
+    - label: third
+      bloblang: root = "third"
+
+    # Second
+    - bloblang: root = "second"
+`
+	if act := docString(t, d); act != exp {
+		t.Errorf("Wrong result:\n%v\n!=\n%v", act, exp)
+	}
+}
+
+func TestDocumentReplace(t *testing.T) {
+	d, err := ParseDocument(`input:
+  # Consume
+  nats:
+    urls: [ nats://foo:4222 ]
+    subject: foo
+    prefetch_count: 5
+  processors:
+    - noop: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Replace("input", "nats_stream"); err != nil {
+		t.Fatal(err)
+	}
+	act := docString(t, d)
+	for _, exp := range []string{
+		"  # Consume\n  nats_stream:\n",
+		"    urls: ['nats://foo:4222']\n",
+		"    cluster_id: test-cluster\n",
+		"    subject: foo\n",
+		"  processors:\n    - noop: {}\n",
+	} {
+		if !strings.Contains(act, exp) {
+			t.Errorf("Expected %q within result:\n%v", exp, act)
+		}
+	}
+	if strings.Contains(act, "  nats:\n") || strings.Contains(act, "prefetch_count") {
+		t.Errorf("Old fields remain within result:\n%v", act)
+	}
+
+	if err = d.Replace("input", "not_a_real_input"); err == nil {
+		t.Error("Expected error from unrecognised type")
+	}
+}
+
+func TestDocumentWrap(t *testing.T) {
+	d := refactorDoc(t)
+	if err := d.Wrap("pipeline.processors.0", "try"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Wrap("pipeline.processors.1", "branch"); err != nil {
+		t.Fatal(err)
+	}
+	act := docString(t, d)
+	for _, exp := range []string{
+		"    # Parse first\n    - label: \"\"\n      try:\n        - bloblang: root = this\n",
+		"      branch:\n",
+		"        request_map: root = this\n",
+		"        result_map: root = this\n",
+		"        processors:\n          - label: second\n            jmespath:\n              query: foo\n",
+	} {
+		if !strings.Contains(act, exp) {
+			t.Errorf("Expected %q within result:\n%v", exp, act)
+		}
+	}
+
+	if err := d.Wrap("input", "try"); err == nil {
+		t.Error("Expected error from wrapping an input")
+	}
+	if err := d.Wrap("pipeline.processors.2", "noop"); err == nil {
+		t.Error("Expected error from non-wrapper")
+	}
+}
+
+func TestDocumentWrapBranchOutput(t *testing.T) {
+	procConf := `bloblang: 'root.doc = this'
+`
+	d, err := ParseDocument("pipeline:\n  processors:\n    - " + procConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Wrap("pipeline.processors.0", "branch"); err != nil {
+		t.Fatal(err)
+	}
+	node, _, err := d.lookup("pipeline.processors.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := yaml.Marshal(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []string{`{"id":"foo"}`, `{"id":"bar"}`}
+	exp := runProcessor(t, procConf, batch, nil)
+	act := runProcessor(t, string(wrapped), batch, nil)
+	if !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong result from branch: %v != %v", act, exp)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+// The problems that can be found with resources.
+const (
+	IssueUndefined = "undefined"
+	IssueUnused    = "unused"
+	IssueDuplicate = "duplicate"
+)
+
+// ReferenceIssue is a problem with a resource of a config, which is either a
+// reference to a resource that isn't defined, a resource that nothing refers
+// to or a label that is used more than once.
+type ReferenceIssue struct {
+	Issue string
+	Kind  string
+	Name  string
+	Path  string
+}
+
+func (r ReferenceIssue) String() string {
+	switch r.Issue {
+	case IssueUndefined:
+		return fmt.Sprintf("%v resource '%v' is referenced but not defined", r.Kind, r.Name)
+	case IssueUnused:
+		return fmt.Sprintf("%v resource '%v' is defined but never referenced", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%v label '%v' is used more than once", r.Kind, r.Name)
+}
+
+// resourceFields are the field of the resources mapping and the root list
+// that resources of each kind are defined within.
+var resourceFields = map[string][2]string{
+	KindInput:     {"inputs", "input_resources"},
+	KindProcessor: {"processors", "processor_resources"},
+	KindOutput:    {"outputs", "output_resources"},
+	KindCache:     {"caches", "cache_resources"},
+	KindRatelimit: {"rate_limits", "rate_limit_resources"},
+}
+
+var resourceListRegex = regexp.MustCompile(`^[a-z_]+_resources\.[0-9]+$`)
+
+// resourceName returns the name of the resource defined at a path, or false
+// if the component at the path isn't a resource.
+func resourceName(kind, path string, node *yaml.Node) (string, bool) {
+	fields := resourceFields[kind]
+	if prefix := "resources." + fields[0] + "."; strings.HasPrefix(path, prefix) {
+		name := strings.TrimPrefix(path, prefix)
+		return name, !strings.Contains(name, ".")
+	}
+	if strings.HasPrefix(path, fields[1]+".") && resourceListRegex.MatchString(path) {
+		if label := mapValue(node, "label"); label != nil {
+			return label.Value, true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+type resourceRef struct {
+	kind string
+	name string
+	path string
+}
+
+// componentRefs returns the resources referenced by the config of a
+// component.
+func componentRefs(kind, cType, path string, node *yaml.Node, components map[string]string) []resourceRef {
+	body := mapValue(node, cType)
+	if body == nil {
+		return nil
+	}
+	bodyPath := path + "." + cType
+
+	var refs []resourceRef
+	addRef := func(refKind, field string, value *yaml.Node) {
+		if value != nil && value.Kind == yaml.ScalarNode && len(value.Value) > 0 {
+			refs = append(refs, resourceRef{kind: refKind, name: value.Value, path: field})
+		}
+	}
+
+	switch {
+	case cType == "resource":
+		addRef(kind, bodyPath, body)
+		return refs
+	case kind == KindProcessor && cType == "cache":
+		addRef(KindCache, bodyPath+".resource", mapValue(body, "resource"))
+	case kind == KindProcessor && cType == "rate_limit":
+		addRef(KindRatelimit, bodyPath+".resource", mapValue(body, "resource"))
+		return refs
+	case kind == KindOutput && cType == "cache":
+		addRef(KindCache, bodyPath+".target", mapValue(body, "target"))
+	case kind == KindProcessor && cType == "workflow":
+		if branches := mapValue(body, "branch_resources"); branches != nil {
+			for i, b := range branches.Content {
+				addRef(KindProcessor, IndexPath(bodyPath+".branch_resources", i), b)
+			}
+		}
+	case kind == KindCache && cType == "multilevel":
+		for i, c := range body.Content {
+			addRef(KindCache, IndexPath(bodyPath, i), c)
+		}
+		return refs
+	}
+
+	// Any other cache or rate_limit field of a component, such as those of
+	// HTTP clients, is a reference. Nested components are left to be checked
+	// on their own.
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			k, v := node.Content[i].Value, node.Content[i+1]
+			p := path + "." + k
+			if _, isComponent := components[p]; isComponent {
+				continue
+			}
+			switch k {
+			case "cache":
+				addRef(KindCache, p, v)
+			case "rate_limit":
+				addRef(KindRatelimit, p, v)
+			default:
+				walk(v, p)
+			}
+		}
+	}
+	walk(body, bodyPath)
+	return refs
+}
+
+//------------------------------------------------------------------------------
+
+// CheckReferences finds every resource referenced by the document and reports
+// references to resources that aren't defined, resources that are never
+// referenced and labels that are used more than once, ordered by path.
+func (d *Document) CheckReferences() ([]ReferenceIssue, error) {
+	components, err := d.Components()
+	if err != nil {
+		return nil, err
+	}
+
+	type labelled struct {
+		name string
+		path string
+	}
+	defined := map[string]map[string]string{}
+	labels := map[string][]labelled{}
+	var refs []resourceRef
+
+	paths := make([]string, 0, len(components))
+	for p := range components {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		kind := components[p]
+		node, err := GetNode(&d.doc, p)
+		if err != nil || node.Kind != yaml.MappingNode {
+			continue
+		}
+		if name, isResource := resourceName(kind, p, node); isResource {
+			if defined[kind] == nil {
+				defined[kind] = map[string]string{}
+			}
+			if _, exists := defined[kind][name]; !exists {
+				defined[kind][name] = p
+			}
+			labels[kind] = append(labels[kind], labelled{name, p})
+		} else if label := mapValue(node, "label"); label != nil && len(label.Value) > 0 {
+			labels[kind] = append(labels[kind], labelled{label.Value, p})
+		}
+		refs = append(refs, componentRefs(kind, componentType(kind, node), p, node, components)...)
+	}
+
+	var issues []ReferenceIssue
+	used := map[string]map[string]bool{}
+	for _, r := range refs {
+		if _, exists := defined[r.kind][r.name]; !exists {
+			issues = append(issues, ReferenceIssue{Issue: IssueUndefined, Kind: r.kind, Name: r.name, Path: r.path})
+			continue
+		}
+		if used[r.kind] == nil {
+			used[r.kind] = map[string]bool{}
+		}
+		used[r.kind][r.name] = true
+	}
+	for kind, names := range defined {
+		for name, p := range names {
+			if !used[kind][name] {
+				issues = append(issues, ReferenceIssue{Issue: IssueUnused, Kind: kind, Name: name, Path: p})
+			}
+		}
+	}
+	for kind, ls := range labels {
+		seen := map[string]bool{}
+		for _, l := range ls {
+			if seen[l.name] {
+				issues = append(issues, ReferenceIssue{Issue: IssueDuplicate, Kind: kind, Name: l.name, Path: l.path})
+			}
+			seen[l.name] = true
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Path == issues[j].Path {
+			return issues[i].Issue < issues[j].Issue
+		}
+		return issues[i].Path < issues[j].Path
+	})
+	return issues, nil
+}
+
+// CheckReferences parses a config and checks its resource references, see
+// Document.CheckReferences.
+func CheckReferences(confStr string) ([]ReferenceIssue, error) {
+	d, err := ParseDocument(confStr)
+	if err != nil {
+		return nil, err
+	}
+	return d.CheckReferences()
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,133 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckReferences(t *testing.T) {
+	conf := `input:
+  http_client:
+    url: http://localhost:4195
+    rate_limit: limiter
+pipeline:
+  processors:
+    - cache:
+        resource: foo
+        operator: set
+        key: ${! content() }
+    - resource: missing
+    - workflow:
+        branch_resources: [ enrich ]
+output:
+  cache:
+    target: bar
+resources:
+  caches:
+    foo:
+      memory: {}
+    unused:
+      memory: {}
+  rate_limits:
+    limiter:
+      local: {}
+  processors:
+    enrich:
+      branch:
+        processors:
+          - noop: {}
+cache_resources:
+  - label: example0
+    memory: {}
+  - label: foo
+    memory: {}
+`
+
+	issues, err := CheckReferences(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []ReferenceIssue{
+		{Issue: IssueUnused, Kind: KindCache, Name: "example0", Path: "cache_resources.0"},
+		{Issue: IssueUndefined, Kind: KindCache, Name: "bar", Path: "output.cache.target"},
+		{Issue: IssueUndefined, Kind: KindProcessor, Name: "missing", Path: "pipeline.processors.1.resource"},
+		{Issue: IssueDuplicate, Kind: KindCache, Name: "foo", Path: "resources.caches.foo"},
+		{Issue: IssueUnused, Kind: KindCache, Name: "unused", Path: "resources.caches.unused"},
+	}
+	if !reflect.DeepEqual(exp, issues) {
+		t.Errorf("Wrong issues: %+v != %+v", issues, exp)
+	}
+}
+
+func TestCheckReferencesNested(t *testing.T) {
+	conf := `input:
+  broker:
+    inputs:
+      - resource: in
+      - http_server:
+          rate_limit: nope
+output:
+  switch:
+    cases:
+      - output:
+          resource: out
+resources:
+  inputs:
+    in:
+      stdin: {}
+  outputs:
+    out:
+      stdout: {}
+  caches:
+    a:
+      memory: {}
+    b:
+      multilevel: [ a, c ]
+  processors:
+    dedupe:
+      dedupe:
+        cache: b
+        key: ${! content() }
+`
+
+	issues, err := CheckReferences(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []ReferenceIssue{
+		{Issue: IssueUndefined, Kind: KindRatelimit, Name: "nope", Path: "input.broker.inputs.1.http_server.rate_limit"},
+		{Issue: IssueUndefined, Kind: KindCache, Name: "c", Path: "resources.caches.b.multilevel.1"},
+		{Issue: IssueUnused, Kind: KindProcessor, Name: "dedupe", Path: "resources.processors.dedupe"},
+	}
+	if !reflect.DeepEqual(exp, issues) {
+		t.Errorf("Wrong issues: %+v != %+v", issues, exp)
+	}
+
+	issues, err = CheckReferences(refactorConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) > 0 {
+		t.Errorf("Unexpected issues: %+v", issues)
+	}
+}
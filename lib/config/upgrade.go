@@ -0,0 +1,624 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/benthos/v3/lib/condition"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"gopkg.in/yaml.v3"
+)
+
+//------------------------------------------------------------------------------
+
+const statusDeprecated = "deprecated"
+
+// Upgrade describes a deprecated component found within a config, which was
+// either rewritten as a different type or left alone for the reason given. A
+// rewrite that might not behave the same in all cases has a warning.
+type Upgrade struct {
+	Path    string `json:"path"`
+	From    string `json:"from"`
+	To      string `json:"to,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Warning string `json:"warning,omitempty"`
+}
+
+// Upgraded returns true if the component was rewritten.
+func (u Upgrade) Upgraded() bool {
+	return len(u.Reason) == 0
+}
+
+func (u Upgrade) String() string {
+	if u.Upgraded() {
+		if len(u.Warning) > 0 {
+			return fmt.Sprintf("%v: upgraded %v to %v: %v", u.Path, u.From, u.To, u.Warning)
+		}
+		return fmt.Sprintf("%v: upgraded %v to %v", u.Path, u.From, u.To)
+	}
+	return fmt.Sprintf("%v: could not upgrade %v: %v", u.Path, u.From, u.Reason)
+}
+
+// Upgrade rewrites the deprecated processors and conditions of the document as
+// equivalent bloblang processors, or switch processors in the case of the
+// conditional processor and switch cases with a condition. The deprecated
+// components that can't be translated are left as they are and reported along
+// with the reason.
+func (d *Document) Upgrade() ([]Upgrade, error) {
+	components, err := d.Components()
+	if err != nil {
+		return nil, err
+	}
+
+	// Nested processors are upgraded before the processors that contain them,
+	// which keeps the paths of those still to be upgraded valid.
+	var paths []string
+	for p, kind := range components {
+		if kind == KindProcessor {
+			paths = append(paths, p)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if di, dj := strings.Count(paths[i], "."), strings.Count(paths[j], "."); di != dj {
+			return di > dj
+		}
+		return paths[i] < paths[j]
+	})
+
+	var upgrades []Upgrade
+	for _, p := range paths {
+		node, err := GetNode(&d.doc, p)
+		if err != nil || node.Kind != yaml.MappingNode {
+			continue
+		}
+		cType := componentType(KindProcessor, node)
+		if cType == processor.TypeSwitch {
+			upgrades = append(upgrades, upgradeSwitchCases(p, mapValue(node, cType))...)
+			continue
+		}
+		if spec, exists := processor.Constructors[cType]; !exists || string(spec.Status) != statusDeprecated {
+			continue
+		}
+
+		u := Upgrade{Path: p, From: cType}
+		newType, body, err := upgradeProcessor(cType, node)
+		if err == nil && cType == processor.TypeConditional {
+			conf := processor.NewConfig()
+			if node.Decode(&conf) == nil {
+				u.Warning = batchWarning(conf.Conditional.Condition)
+			}
+		}
+		if err != nil {
+			u.Reason = err.Error()
+		} else {
+			u.To = newType
+			if err = d.setNode(p, replaceType(node, cType, newType, body)); err != nil {
+				return nil, err
+			}
+		}
+		upgrades = append(upgrades, u)
+	}
+
+	sort.SliceStable(upgrades, func(i, j int) bool {
+		return upgrades[i].Path < upgrades[j].Path
+	})
+	return upgrades, nil
+}
+
+// UpgradeConfig upgrades the deprecated components of a config, returning the
+// result along with the upgrades, see Document.Upgrade.
+func UpgradeConfig(confStr string) (string, []Upgrade, error) {
+	d, err := ParseDocument(confStr)
+	if err != nil {
+		return "", nil, err
+	}
+	upgrades, err := d.Upgrade()
+	if err != nil {
+		return "", nil, err
+	}
+	resBytes, err := d.Bytes()
+	if err != nil {
+		return "", nil, err
+	}
+	return string(resBytes), upgrades, nil
+}
+
+// replaceType returns a copy of a component node with the config of its old
+// type replaced by a new one, keeping its comments and common fields such as
+// its label.
+func replaceType(old *yaml.Node, oldType, newType string, body *yaml.Node) *yaml.Node {
+	node := newMapping()
+	node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	for i := 0; i < len(old.Content)-1; i += 2 {
+		key, value := old.Content[i], old.Content[i+1]
+		switch key.Value {
+		case "type", "plugin":
+		case oldType:
+			newKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: newType}
+			newKey.HeadComment, newKey.LineComment = key.HeadComment, key.LineComment
+			node.Content = append(node.Content, newKey, body)
+		default:
+			node.Content = append(node.Content, key, value)
+		}
+	}
+	if mapValue(node, newType) == nil {
+		setMapValue(node, newType, body, -1)
+	}
+	return node
+}
+
+func upgradeSwitchCases(path string, cases *yaml.Node) []Upgrade {
+	if cases == nil || cases.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var upgrades []Upgrade
+	for i, c := range cases.Content {
+		condKey := mapKey(c, "condition")
+		if condKey == nil || mapValue(c, "check") != nil {
+			continue
+		}
+		u := Upgrade{Path: IndexPath(path+".switch", i) + ".condition", From: "condition", To: "check"}
+		var cond condition.Config
+		query, err := decodeCondition(mapValue(c, "condition"), &cond)
+		if err != nil {
+			u.To, u.Reason = "", err.Error()
+		} else {
+			u.Warning = batchWarning(cond)
+			for j := 0; j < len(c.Content)-1; j += 2 {
+				if c.Content[j] == condKey {
+					condKey.Value = "check"
+					c.Content[j+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: query}
+				}
+			}
+		}
+		upgrades = append(upgrades, u)
+	}
+	return upgrades
+}
+
+// decodeCondition decodes a condition node and returns a query equivalent to
+// it that is checked against the whole batch, see batchQuery.
+func decodeCondition(node *yaml.Node, conf *condition.Config) (string, error) {
+	*conf = condition.NewConfig()
+	if err := node.Decode(conf); err != nil {
+		return "", err
+	}
+	return batchQuery(*conf)
+}
+
+// batchQuery returns a query equivalent to a condition that checks a batch
+// once. Conditions are checked against the first message of a batch, whereas
+// checks run against each message, and so the query reads the first message
+// with the from method.
+func batchQuery(conf condition.Config) (string, error) {
+	switch conf.Type {
+	case condition.TypeStatic:
+		return conditionQuery(conf)
+	case condition.TypeBloblang:
+		return "(" + string(conf.Bloblang) + ").from(0).catch(false)", nil
+	}
+	query, err := conditionQuery(conf)
+	if err != nil {
+		return "", err
+	}
+	return "(" + query + ").from(0)", nil
+}
+
+const thisWarning = "the check runs against each message of a batch rather than once, references to this read each message and not the first"
+
+// batchWarning returns a warning for a condition rewritten as a batch query
+// when the query might still read each message. The from method moves the
+// functions content, json and meta to the first message but not this.
+func batchWarning(conf condition.Config) string {
+	if !hasBloblang(conf) {
+		return ""
+	}
+	return thisWarning
+}
+
+func hasBloblang(conf condition.Config) bool {
+	switch conf.Type {
+	case condition.TypeBloblang:
+		return true
+	case condition.TypeNot:
+		return conf.Not.Config != nil && hasBloblang(*conf.Not.Config)
+	case condition.TypeAnd:
+		for _, c := range conf.And {
+			if hasBloblang(c) {
+				return true
+			}
+		}
+	case condition.TypeOr:
+		for _, c := range conf.Or {
+			if hasBloblang(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//------------------------------------------------------------------------------
+
+func bloblangNode(mapping ...string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.Join(mapping, "\n")}
+}
+
+func quote(s string) string {
+	return strconv.Quote(s)
+}
+
+func isInterpolated(s string) bool {
+	return strings.Contains(s, "${!")
+}
+
+var pathSegmentRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// bloblangPath converts a dot separated path into a bloblang path from a root,
+// such as `this` or `root`.
+func bloblangPath(root, path string) (string, error) {
+	path = strings.Trim(path, ".")
+	if len(path) == 0 {
+		return root, nil
+	}
+	for _, seg := range strings.Split(path, ".") {
+		if !pathSegmentRegex.MatchString(seg) {
+			return "", fmt.Errorf("path '%v' contains characters that need escaping", path)
+		}
+	}
+	return root + "." + path, nil
+}
+
+var errNotAllParts = errors.New("it only applies to some messages of a batch")
+
+// upgradeProcessor returns the type and config of a processor equivalent to a
+// deprecated processor node.
+func upgradeProcessor(cType string, node *yaml.Node) (string, *yaml.Node, error) {
+	conf := processor.NewConfig()
+	if err := node.Decode(&conf); err != nil {
+		return "", nil, err
+	}
+
+	var parts []int
+	var mapping []string
+	var err error
+	switch cType {
+	case processor.TypeText:
+		parts = conf.Text.Parts
+		mapping, err = upgradeText(conf.Text)
+	case processor.TypeJSON:
+		parts = conf.JSON.Parts
+		mapping, err = upgradeJSON(conf.JSON)
+	case processor.TypeMetadata:
+		parts = conf.Metadata.Parts
+		mapping, err = upgradeMetadata(conf.Metadata)
+	case processor.TypeNumber:
+		parts = conf.Number.Parts
+		mapping, err = upgradeNumber(conf.Number)
+	case processor.TypeEncode:
+		parts = conf.Encode.Parts
+		mapping, err = upgradeScheme("encode", conf.Encode.Scheme)
+	case processor.TypeDecode:
+		parts = conf.Decode.Parts
+		mapping, err = upgradeScheme("decode", conf.Decode.Scheme)
+	case processor.TypeHash:
+		parts = conf.Hash.Parts
+		mapping, err = upgradeHash(conf.Hash)
+	case processor.TypeFilterParts:
+		var query string
+		if query, err = conditionQuery(conf.FilterParts.Config); err == nil {
+			mapping = []string{fmt.Sprintf("root = if !(%v) { deleted() }", query)}
+		}
+	case processor.TypeConditional:
+		return upgradeConditional(conf.Conditional, mapValue(node, cType))
+	case processor.TypeFilter:
+		return "", nil, errors.New("it filters whole batches, use a filter_parts or bloblang processor when messages aren't batched")
+	default:
+		return "", nil, errors.New("no automatic upgrade is available")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(parts) > 0 {
+		return "", nil, errNotAllParts
+	}
+	return processor.TypeBloblang, bloblangNode(mapping...), nil
+}
+
+func upgradeText(conf processor.TextConfig) ([]string, error) {
+	if isInterpolated(conf.Value) {
+		return nil, errors.New("its value uses interpolation functions")
+	}
+	switch conf.Operator {
+	case "to_upper":
+		return []string{"root = content().uppercase()"}, nil
+	case "to_lower":
+		return []string{"root = content().lowercase()"}, nil
+	case "trim_space":
+		return []string{"root = content().trim()"}, nil
+	case "trim":
+		return []string{fmt.Sprintf("root = content().trim(%v)", quote(conf.Arg))}, nil
+	case "set":
+		return []string{"root = " + quote(conf.Value)}, nil
+	case "append":
+		return []string{fmt.Sprintf("root = content().string() + %v", quote(conf.Value))}, nil
+	case "prepend":
+		return []string{fmt.Sprintf("root = %v + content().string()", quote(conf.Value))}, nil
+	case "replace":
+		return []string{fmt.Sprintf("root = content().replace(%v, %v)", quote(conf.Arg), quote(conf.Value))}, nil
+	case "replace_regexp":
+		return []string{fmt.Sprintf("root = content().re_replace(%v, %v)", quote(conf.Arg), quote(conf.Value))}, nil
+	case "strip_html", "quote", "unquote", "escape_url_query", "unescape_url_query":
+		return []string{fmt.Sprintf("root = content().%v()", conf.Operator)}, nil
+	}
+	return nil, fmt.Errorf("operator '%v' has no equivalent", conf.Operator)
+}
+
+func upgradeJSON(conf processor.JSONConfig) ([]string, error) {
+	from, err := bloblangPath("this", conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	to, err := bloblangPath("root", conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch conf.Operator {
+	case "select":
+		return []string{"root = " + from}, nil
+	case "delete":
+		if to == "root" {
+			return nil, errors.New("deleting the root has no equivalent")
+		}
+		return []string{"root = this", to + " = deleted()"}, nil
+	case "set":
+		var value interface{}
+		if err := json.Unmarshal(conf.Value, &value); err != nil {
+			return nil, err
+		}
+		if s, isStr := value.(string); isStr && isInterpolated(s) {
+			return nil, errors.New("its value uses interpolation functions")
+		}
+		valueBytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if to == "root" {
+			return []string{"root = " + string(valueBytes)}, nil
+		}
+		return []string{"root = this", to + " = " + string(valueBytes)}, nil
+	case "copy", "move":
+		var dest string
+		if err := json.Unmarshal(conf.Value, &dest); err != nil {
+			return nil, fmt.Errorf("value must be a path: %w", err)
+		}
+		destPath, err := bloblangPath("root", dest)
+		if err != nil {
+			return nil, err
+		}
+		if to == "root" || destPath == "root" {
+			return nil, fmt.Errorf("a %v involving the root has no equivalent", conf.Operator)
+		}
+		mapping := []string{"root = this", destPath + " = " + from}
+		if conf.Operator == "move" {
+			mapping = append(mapping, to+" = deleted()")
+		}
+		return mapping, nil
+	}
+	return nil, fmt.Errorf("operator '%v' has no equivalent", conf.Operator)
+}
+
+func upgradeMetadata(conf processor.MetadataConfig) ([]string, error) {
+	errInterpolated := errors.New("its key or value uses interpolation functions")
+	switch conf.Operator {
+	case "set":
+		if isInterpolated(conf.Key) || isInterpolated(conf.Value) {
+			return nil, errInterpolated
+		}
+		return []string{fmt.Sprintf("meta %v = %v", quote(conf.Key), quote(conf.Value))}, nil
+	case "delete":
+		key := conf.Value
+		if len(key) == 0 {
+			key = conf.Key
+		}
+		if isInterpolated(key) {
+			return nil, errInterpolated
+		}
+		return []string{fmt.Sprintf("meta %v = deleted()", quote(key))}, nil
+	case "delete_all":
+		return []string{"meta = deleted()"}, nil
+	}
+	return nil, fmt.Errorf("operator '%v' has no equivalent", conf.Operator)
+}
+
+func upgradeNumber(conf processor.NumberConfig) ([]string, error) {
+	var value float64
+	switch v := conf.Value.(type) {
+	case int:
+		value = float64(v)
+	case float64:
+		value = v
+	default:
+		return nil, errors.New("its value must be a number")
+	}
+	valueStr := strconv.FormatFloat(value, 'f', -1, 64)
+	switch conf.Operator {
+	case "add":
+		return []string{"root = content().number() + " + valueStr}, nil
+	case "subtract":
+		return []string{"root = content().number() - " + valueStr}, nil
+	}
+	return nil, fmt.Errorf("operator '%v' has no equivalent", conf.Operator)
+}
+
+func upgradeScheme(method, scheme string) ([]string, error) {
+	switch scheme {
+	case "base64", "hex", "ascii85", "z85":
+		return []string{fmt.Sprintf("root = content().%v(%v)", method, quote(scheme))}, nil
+	}
+	return nil, fmt.Errorf("scheme '%v' has no equivalent", scheme)
+}
+
+func upgradeHash(conf processor.HashConfig) ([]string, error) {
+	switch conf.Algorithm {
+	case "hmac-sha1", "hmac-sha256", "hmac-sha512":
+		return []string{fmt.Sprintf("root = content().hash(%v, %v)", quote(conf.Algorithm), quote(conf.Key))}, nil
+	case "md5", "sha1", "sha256", "sha512", "xxhash64":
+		return []string{fmt.Sprintf("root = content().hash(%v)", quote(conf.Algorithm))}, nil
+	}
+	return nil, fmt.Errorf("algorithm '%v' has no equivalent", conf.Algorithm)
+}
+
+// upgradeConditional returns a switch processor with a case for the processors
+// of a conditional processor and another for its else processors, keeping the
+// nodes of both lists.
+func upgradeConditional(conf processor.ConditionalConfig, body *yaml.Node) (string, *yaml.Node, error) {
+	query, err := batchQuery(conf.Condition)
+	if err != nil {
+		return "", nil, err
+	}
+	list := func(key string) *yaml.Node {
+		if body != nil {
+			if l := mapValue(body, key); l != nil && l.Kind == yaml.SequenceNode {
+				return l
+			}
+		}
+		return newSequence()
+	}
+
+	cases := newSequence()
+	thenCase := newMapping()
+	setMapValue(thenCase, "check", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: query}, -1)
+	setMapValue(thenCase, "processors", list("processors"), -1)
+	cases.Content = append(cases.Content, thenCase)
+	if elseList := list("else_processors"); len(elseList.Content) > 0 {
+		elseCase := newMapping()
+		setMapValue(elseCase, "processors", elseList, -1)
+		cases.Content = append(cases.Content, elseCase)
+	}
+	return processor.TypeSwitch, cases, nil
+}
+
+//------------------------------------------------------------------------------
+
+// conditionQuery returns a bloblang query equivalent to a condition.
+func conditionQuery(conf condition.Config) (string, error) {
+	switch conf.Type {
+	case condition.TypeStatic:
+		return strconv.FormatBool(conf.Static), nil
+	case condition.TypeBloblang:
+		// A condition that fails to query is false.
+		return "(" + string(conf.Bloblang) + ").catch(false)", nil
+	case condition.TypeNot:
+		if conf.Not.Config == nil {
+			return "", errors.New("not condition has no child")
+		}
+		q, err := conditionQuery(*conf.Not.Config)
+		if err != nil {
+			return "", err
+		}
+		return "!(" + q + ")", nil
+	case condition.TypeAnd:
+		return joinConditions([]condition.Config(conf.And), " && ")
+	case condition.TypeOr:
+		return joinConditions([]condition.Config(conf.Or), " || ")
+	case condition.TypeText:
+		if conf.Text.Part != 0 {
+			return "", errNotAllParts
+		}
+		return compareQuery("content().string()", conf.Text.Operator, conf.Text.Arg)
+	case condition.TypeMetadata:
+		if conf.Metadata.Part != 0 {
+			return "", errNotAllParts
+		}
+		if conf.Metadata.Operator == "exists" {
+			return fmt.Sprintf("meta(%v).or(null) != null", quote(conf.Metadata.Key)), nil
+		}
+		op := conf.Metadata.Operator
+		if op == "has_prefix" {
+			op = "prefix_cs"
+		}
+		return compareQuery(fmt.Sprintf("meta(%v).or(\"\")", quote(conf.Metadata.Key)), op, conf.Metadata.Arg)
+	}
+	return "", fmt.Errorf("condition '%v' has no equivalent", conf.Type)
+}
+
+func joinConditions(children []condition.Config, op string) (string, error) {
+	if len(children) == 0 {
+		return "", errors.New("condition has no children")
+	}
+	queries := make([]string, len(children))
+	for i, c := range children {
+		q, err := conditionQuery(c)
+		if err != nil {
+			return "", err
+		}
+		queries[i] = "(" + q + ")"
+	}
+	return strings.Join(queries, op), nil
+}
+
+// compareQuery returns a query comparing a string value with an argument using
+// an operator of the text condition.
+func compareQuery(value, operator string, arg interface{}) (string, error) {
+	if operator == "enum" {
+		argBytes, err := json.Marshal(arg)
+		if err != nil {
+			return "", err
+		}
+		if _, isList := arg.([]interface{}); !isList {
+			return "", errors.New("enum argument must be a list")
+		}
+		return fmt.Sprintf("%s.contains(%v)", argBytes, value), nil
+	}
+
+	argStr, isStr := arg.(string)
+	if !isStr {
+		return "", fmt.Errorf("argument of operator '%v' must be a string", operator)
+	}
+	if !strings.HasSuffix(operator, "_cs") && !strings.HasPrefix(operator, "regexp_") {
+		value, argStr = value+".lowercase()", strings.ToLower(argStr)
+	}
+	switch strings.TrimSuffix(operator, "_cs") {
+	case "equals":
+		return fmt.Sprintf("%v == %v", value, quote(argStr)), nil
+	case "contains":
+		return fmt.Sprintf("%v.contains(%v)", value, quote(argStr)), nil
+	case "prefix":
+		return fmt.Sprintf("%v.has_prefix(%v)", value, quote(argStr)), nil
+	case "suffix":
+		return fmt.Sprintf("%v.has_suffix(%v)", value, quote(argStr)), nil
+	case "regexp_partial":
+		return fmt.Sprintf("%v.re_match(%v)", value, quote(argStr)), nil
+	case "regexp_exact":
+		return fmt.Sprintf("%v.re_match(%v)", value, quote("^(?:"+argStr+")$")), nil
+	}
+	return "", fmt.Errorf("operator '%v' has no equivalent", operator)
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,293 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Jeffail/benthos/v3/lib/log"
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/metrics"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"github.com/Jeffail/benthos/v3/lib/types"
+	"gopkg.in/yaml.v3"
+)
+
+type processedPart struct {
+	Content string
+	Meta    map[string]string
+}
+
+// runProcessor processes a batch with the processor at the root of a config,
+// each message of the batch is given the same metadata.
+func runProcessor(t *testing.T, confStr string, batch []string, meta map[string]string) []processedPart {
+	t.Helper()
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(confStr), &node); err != nil {
+		t.Fatal(err)
+	}
+	conf := processor.NewConfig()
+	if err := node.Decode(&conf); err != nil {
+		t.Fatal(err)
+	}
+	proc, err := processor.New(conf, types.NoopMgr(), log.Noop(), metrics.Noop())
+	if err != nil {
+		t.Fatalf("%v: %v", confStr, err)
+	}
+
+	var rawBatch [][]byte
+	for _, content := range batch {
+		rawBatch = append(rawBatch, []byte(content))
+	}
+	msg := message.New(rawBatch)
+	msg.Iter(func(_ int, p types.Part) error {
+		for k, v := range meta {
+			p.Metadata().Set(k, v)
+		}
+		return nil
+	})
+	msgs, _ := proc.ProcessMessage(msg)
+
+	parts := []processedPart{}
+	for _, m := range msgs {
+		m.Iter(func(_ int, p types.Part) error {
+			if processor.HasFailed(p) {
+				t.Errorf("%v: processing failed: %v", confStr, processor.GetFail(p))
+			}
+			pMeta := map[string]string{}
+			p.Metadata().Iter(func(k, v string) error {
+				pMeta[k] = v
+				return nil
+			})
+			parts = append(parts, processedPart{Content: string(p.Get()), Meta: pMeta})
+			return nil
+		})
+	}
+	return parts
+}
+
+func upgradeProcessorConf(t *testing.T, confStr string) (string, []Upgrade) {
+	t.Helper()
+	indented := "    - " + strings.ReplaceAll(strings.TrimSpace(confStr), "\n", "\n      ")
+	res, upgrades, err := UpgradeConfig("pipeline:\n  processors:\n" + indented + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ParseDocument(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := GetNode(d.Root(), "pipeline.processors.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resBytes, err := yaml.Marshal(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(resBytes), upgrades
+}
+
+func TestUpgradeEquivalence(t *testing.T) {
+	jsonDoc := `{"foo":{"bar":"Hello World"},"baz":[1,2]}`
+	meta := map[string]string{"a": "Alpha", "b": "beta"}
+
+	tests := []struct {
+		conf   string
+		inputs []string
+	}{
+		{conf: "text:\n  operator: to_upper", inputs: []string{"Hello World"}},
+		{conf: "text:\n  operator: to_lower", inputs: []string{"Hello World"}},
+		{conf: "text:\n  operator: trim_space", inputs: []string{"  Hello World \n"}},
+		{conf: "text:\n  operator: trim\n  arg: '#!'", inputs: []string{"#!Hello World!!"}},
+		{conf: "text:\n  operator: set\n  value: 'say \"hi\" ✓'", inputs: []string{"Hello World"}},
+		{conf: "text:\n  operator: append\n  value: ' & bye'", inputs: []string{"Hello World"}},
+		{conf: "text:\n  operator: prepend\n  value: 'well, '", inputs: []string{"Hello World"}},
+		{conf: "text:\n  operator: replace\n  arg: World\n  value: Lab", inputs: []string{"Hello World World"}},
+		{conf: "text:\n  operator: replace_regexp\n  arg: '(\\w+) (\\w+)'\n  value: '$2 $1'", inputs: []string{"Hello World"}},
+		{conf: "text:\n  operator: quote", inputs: []string{`Hello "World"`}},
+		{conf: "text:\n  operator: unquote", inputs: []string{`"Hello \"World\""`}},
+		{conf: "text:\n  operator: escape_url_query", inputs: []string{"a b&c"}},
+		{conf: "text:\n  operator: strip_html", inputs: []string{"<p>Hello <b>World</b></p>"}},
+		{conf: "json:\n  operator: select\n  path: foo.bar", inputs: []string{jsonDoc}},
+		{conf: "json:\n  operator: select\n  path: foo", inputs: []string{jsonDoc}},
+		{conf: "json:\n  operator: delete\n  path: foo.bar", inputs: []string{jsonDoc}},
+		{conf: "json:\n  operator: set\n  path: foo.qux\n  value: {\"a\": [1, \"b\"]}", inputs: []string{jsonDoc}},
+		{conf: "json:\n  operator: set\n  path: .\n  value: {\"a\": 1}", inputs: []string{jsonDoc}},
+		{conf: "json:\n  operator: copy\n  path: foo.bar\n  value: copied", inputs: []string{jsonDoc}},
+		{conf: "json:\n  operator: move\n  path: baz\n  value: foo.moved", inputs: []string{jsonDoc}},
+		{conf: "metadata:\n  operator: set\n  key: c\n  value: gamma", inputs: []string{"hello"}},
+		{conf: "metadata:\n  operator: delete\n  key: a\n  value: ''", inputs: []string{"hello"}},
+		{conf: "metadata:\n  operator: delete_all", inputs: []string{"hello"}},
+		{conf: "number:\n  operator: add\n  value: 5", inputs: []string{"10", "2.5"}},
+		{conf: "number:\n  operator: subtract\n  value: 1.5", inputs: []string{"10"}},
+		{conf: "encode:\n  scheme: base64", inputs: []string{"Hello World"}},
+		{conf: "encode:\n  scheme: hex", inputs: []string{"Hello World"}},
+		{conf: "decode:\n  scheme: base64", inputs: []string{"SGVsbG8gV29ybGQ="}},
+		{conf: "hash:\n  algorithm: sha256", inputs: []string{"Hello World"}},
+		{conf: "hash:\n  algorithm: hmac-sha1\n  key: secret", inputs: []string{"Hello World"}},
+		{conf: "filter_parts:\n  text:\n    operator: contains\n    arg: WORLD", inputs: []string{"Hello World", "Hello Lab"}},
+		{conf: "filter_parts:\n  text:\n    operator: equals_cs\n    arg: Hello World", inputs: []string{"Hello World", "hello world"}},
+		{conf: "filter_parts:\n  text:\n    operator: prefix\n    arg: HELLO", inputs: []string{"Hello World", "Bye"}},
+		{conf: "filter_parts:\n  text:\n    operator: suffix_cs\n    arg: World", inputs: []string{"Hello World", "Hello world"}},
+		{conf: "filter_parts:\n  text:\n    operator: regexp_exact\n    arg: 'H.*d'", inputs: []string{"Hello World", "Hello Worlds"}},
+		{conf: "filter_parts:\n  text:\n    operator: regexp_partial\n    arg: 'o W'", inputs: []string{"Hello World", "Hello"}},
+		{conf: "filter_parts:\n  text:\n    operator: enum\n    arg: [ foo, bar ]", inputs: []string{"foo", "baz"}},
+		{conf: "filter_parts:\n  metadata:\n    operator: equals\n    key: a\n    arg: ALPHA", inputs: []string{"hello"}},
+		{conf: "filter_parts:\n  metadata:\n    operator: equals\n    key: z\n    arg: ''", inputs: []string{"hello"}},
+		{conf: "filter_parts:\n  metadata:\n    operator: exists\n    key: c", inputs: []string{"hello"}},
+		{conf: "filter_parts:\n  metadata:\n    operator: exists\n    key: a", inputs: []string{"hello"}},
+		{conf: "filter_parts:\n  metadata:\n    operator: has_prefix\n    key: b\n    arg: be", inputs: []string{"hello"}},
+		{conf: "filter_parts:\n  not:\n    or:\n      - static: false\n      - and:\n          - bloblang: content().length() > 3\n          - text:\n              operator: contains\n              arg: world", inputs: []string{"Hello World", "Hello"}},
+	}
+
+	for _, test := range tests {
+		upgraded, upgrades := upgradeProcessorConf(t, test.conf)
+		if len(upgrades) != 1 || !upgrades[0].Upgraded() {
+			t.Errorf("%v: wrong upgrades: %v", test.conf, upgrades)
+			continue
+		}
+		for _, input := range test.inputs {
+			exp := runProcessor(t, test.conf, []string{input}, meta)
+			act := runProcessor(t, upgraded, []string{input}, meta)
+			if !reflect.DeepEqual(exp, act) {
+				t.Errorf("%v\nupgraded to:\n%v\ninput %q: %+v != %+v", test.conf, upgraded, input, act, exp)
+			}
+		}
+	}
+}
+
+func TestUpgradeBatchEquivalence(t *testing.T) {
+	meta := map[string]string{"a": "Alpha"}
+	shout := "\n  processors:\n    - bloblang: root = content().uppercase()"
+	whisper := "\n  else_processors:\n    - bloblang: root = content().lowercase()"
+
+	tests := []string{
+		"conditional:\n  condition:\n    text:\n      operator: equals\n      arg: yes" + shout,
+		"conditional:\n  condition:\n    text:\n      operator: equals\n      arg: yes" + shout + whisper,
+		"conditional:\n  condition:\n    metadata:\n      operator: equals\n      key: a\n      arg: alpha" + shout,
+		"conditional:\n  condition:\n    bloblang: json(\"v\") == 1" + shout + whisper,
+		"conditional:\n  condition:\n    not:\n      text:\n        operator: contains\n        arg: o" + shout,
+		"switch:\n  - condition:\n      text:\n        operator: equals\n        arg: yes" + strings.ReplaceAll(shout, "\n", "\n  "),
+		"switch:\n  - condition:\n      bloblang: content().length() > 3" + strings.ReplaceAll(shout, "\n", "\n  "),
+	}
+	batches := [][]string{
+		{"yes", "nope"},
+		{"nope", "yes"},
+		{`{"v":1}`, `{"v":2}`, "yes"},
+		{"Yes"},
+	}
+
+	for _, conf := range tests {
+		upgraded, upgrades := upgradeProcessorConf(t, conf)
+		for _, u := range upgrades {
+			if !u.Upgraded() {
+				t.Errorf("%v: wrong upgrade: %v", conf, u)
+			}
+		}
+		for _, batch := range batches {
+			exp := runProcessor(t, conf, batch, meta)
+			act := runProcessor(t, upgraded, batch, meta)
+			if !reflect.DeepEqual(exp, act) {
+				t.Errorf("%v\nupgraded to:\n%v\nbatch %q: %+v != %+v", conf, upgraded, batch, act, exp)
+			}
+		}
+	}
+}
+
+func TestUpgradeConfig(t *testing.T) {
+	conf := `pipeline:
+  processors:
+    # Shout
+    - label: shout
+      text:
+        operator: to_upper
+    - conditional:
+        condition:
+          text:
+            operator: equals_cs
+            arg: foo
+        processors:
+          - metadata:
+              operator: set
+              key: foo
+              value: bar
+        else_processors:
+          - noop: {}
+    - switch:
+        - condition:
+            bloblang: this.foo == "bar"
+          processors: []
+    - text:
+        parts: [ 0 ]
+        operator: to_lower
+    - process_field:
+        path: foo
+        processors: []
+    - bloblang: root = this
+`
+
+	res, upgrades, err := UpgradeConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `pipeline:
+  processors:
+    # Shout
+    - label: shout
+      bloblang: root = content().uppercase()
+    - switch:
+        - check: (content().string() == "foo").from(0)
+          processors:
+            - bloblang: meta "foo" = "bar"
+        - processors:
+            - noop: {}
+    - switch:
+        - check: (this.foo == "bar").from(0).catch(false)
+          processors: []
+    - text:
+        parts: [0]
+        operator: to_lower
+    - process_field:
+        path: foo
+        processors: []
+    - bloblang: root = this
+`
+	if res != exp {
+		t.Errorf("Wrong result: %v != %v", res, exp)
+	}
+
+	expUpgrades := []Upgrade{
+		{Path: "pipeline.processors.0", From: "text", To: "bloblang"},
+		{Path: "pipeline.processors.1", From: "conditional", To: "switch"},
+		{Path: "pipeline.processors.1.conditional.processors.0", From: "metadata", To: "bloblang"},
+		{Path: "pipeline.processors.2.switch.0.condition", From: "condition", To: "check", Warning: thisWarning},
+		{Path: "pipeline.processors.3", From: "text", Reason: errNotAllParts.Error()},
+		{Path: "pipeline.processors.4", From: "process_field", Reason: "no automatic upgrade is available"},
+	}
+	if !reflect.DeepEqual(expUpgrades, upgrades) {
+		t.Errorf("Wrong upgrades: %v != %v", upgrades, expUpgrades)
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/Jeffail/benthos/v3/lib/config"
+	"github.com/Jeffail/benthos/v3/lib/input"
+	"github.com/Jeffail/benthos/v3/lib/output"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+)
+
+//------------------------------------------------------------------------------
+
+// ProcessorsFunc is called for each list of processors within a config along
+// with the YAML path of the list, e.g. `pipeline.processors`. The list can be
+// modified in place.
+type ProcessorsFunc func(path string, procs *[]processor.Config)
+
+// WalkProcessors calls fn for every list of processors found within a config,
+// including those nested within other processors, inputs, outputs and
+// resources. Nested lists are always visited before the list that contains
+// them, which means fn is free to wrap or replace the elements of a list
+// without disrupting the walk.
+func WalkProcessors(conf *config.Type, fn ProcessorsFunc) {
+	walkInputProcessors("input", &conf.Input, fn)
+	walkProcessorList("pipeline.processors", &conf.Pipeline.Processors, fn)
+	walkOutputProcessors("output", &conf.Output, fn)
+
+	for _, k := range sortedKeys(conf.Manager.Inputs) {
+		c := conf.Manager.Inputs[k]
+		walkInputProcessors("resources.inputs."+k, &c, fn)
+		conf.Manager.Inputs[k] = c
+	}
+	for _, k := range sortedKeys(conf.Manager.Processors) {
+		c := conf.Manager.Processors[k]
+		walkProcessor("resources.processors."+k, &c, fn)
+		conf.Manager.Processors[k] = c
+	}
+	for _, k := range sortedKeys(conf.Manager.Outputs) {
+		c := conf.Manager.Outputs[k]
+		walkOutputProcessors("resources.outputs."+k, &c, fn)
+		conf.Manager.Outputs[k] = c
+	}
+
+	for i := range conf.ResourceInputs {
+		walkInputProcessors(IndexPath("input_resources", i), &conf.ResourceInputs[i], fn)
+	}
+	walkProcessorList("processor_resources", &conf.ResourceProcessors, fn)
+	for i := range conf.ResourceOutputs {
+		walkOutputProcessors(IndexPath("output_resources", i), &conf.ResourceOutputs[i], fn)
+	}
+}
+
+func walkInputProcessors(path string, conf *input.Config, fn ProcessorsFunc) {
+	switch conf.Type {
+	case input.TypeBroker:
+		for i := range conf.Broker.Inputs {
+			walkInputProcessors(IndexPath(path+".broker.inputs", i), &conf.Broker.Inputs[i], fn)
+		}
+	case input.TypeDynamic:
+		for _, k := range sortedKeys(conf.Dynamic.Inputs) {
+			c := conf.Dynamic.Inputs[k]
+			walkInputProcessors(path+".dynamic.inputs."+k, &c, fn)
+			conf.Dynamic.Inputs[k] = c
+		}
+	case input.TypeSequence:
+		for i := range conf.Sequence.Inputs {
+			walkInputProcessors(IndexPath(path+".sequence.inputs", i), &conf.Sequence.Inputs[i], fn)
+		}
+	case input.TypeReadUntil:
+		if conf.ReadUntil.Input != nil {
+			walkInputProcessors(path+".read_until.input", conf.ReadUntil.Input, fn)
+		}
+	}
+	walkProcessorList(path+".processors", &conf.Processors, fn)
+}
+
+func walkOutputProcessors(path string, conf *output.Config, fn ProcessorsFunc) {
+	switch conf.Type {
+	case output.TypeBroker:
+		for i := range conf.Broker.Outputs {
+			walkOutputProcessors(IndexPath(path+".broker.outputs", i), &conf.Broker.Outputs[i], fn)
+		}
+	case output.TypeDynamic:
+		for _, k := range sortedKeys(conf.Dynamic.Outputs) {
+			c := conf.Dynamic.Outputs[k]
+			walkOutputProcessors(path+".dynamic.outputs."+k, &c, fn)
+			conf.Dynamic.Outputs[k] = c
+		}
+	case output.TypeSwitch:
+		for i := range conf.Switch.Cases {
+			walkOutputProcessors(IndexPath(path+".switch.cases", i)+".output", &conf.Switch.Cases[i].Output, fn)
+		}
+		for i := range conf.Switch.Outputs {
+			walkOutputProcessors(IndexPath(path+".switch.outputs", i)+".output", &conf.Switch.Outputs[i].Output, fn)
+		}
+	case output.TypeTry:
+		for i := range conf.Try {
+			walkOutputProcessors(IndexPath(path+".try", i), &conf.Try[i], fn)
+		}
+	case output.TypeRetry:
+		if conf.Retry.Output != nil {
+			walkOutputProcessors(path+".retry.output", conf.Retry.Output, fn)
+		}
+	}
+	walkProcessorList(path+".processors", &conf.Processors, fn)
+}
+
+func walkProcessorList(path string, procs *[]processor.Config, fn ProcessorsFunc) {
+	for i := range *procs {
+		walkProcessor(IndexPath(path, i), &(*procs)[i], fn)
+	}
+	fn(path, procs)
+}
+
+func walkProcessor(path string, conf *processor.Config, fn ProcessorsFunc) {
+	switch conf.Type {
+	case processor.TypeBranch:
+		walkProcessorList(path+".branch.processors", &conf.Branch.Processors, fn)
+	case processor.TypeCatch:
+		walkProcessorList(path+".catch", (*[]processor.Config)(&conf.Catch), fn)
+	case processor.TypeConditional:
+		walkProcessorList(path+".conditional.processors", &conf.Conditional.Processors, fn)
+		walkProcessorList(path+".conditional.else_processors", &conf.Conditional.ElseProcessors, fn)
+	case processor.TypeForEach:
+		walkProcessorList(path+".for_each", (*[]processor.Config)(&conf.ForEach), fn)
+	case processor.TypeGroupBy:
+		for i := range conf.GroupBy {
+			walkProcessorList(IndexPath(path+".group_by", i)+".processors", &conf.GroupBy[i].Processors, fn)
+		}
+	case processor.TypeParallel:
+		walkProcessorList(path+".parallel.processors", &conf.Parallel.Processors, fn)
+	case processor.TypeProcessBatch:
+		walkProcessorList(path+".process_batch", (*[]processor.Config)(&conf.ProcessBatch), fn)
+	case processor.TypeProcessDAG:
+		for _, k := range sortedKeys(conf.ProcessDAG) {
+			c := conf.ProcessDAG[k]
+			walkProcessorList(path+".process_dag."+k+".processors", &c.Processors, fn)
+			conf.ProcessDAG[k] = c
+		}
+	case processor.TypeProcessMap:
+		walkProcessorList(path+".process_map.processors", &conf.ProcessMap.Processors, fn)
+	case processor.TypeSwitch:
+		for i := range conf.Switch {
+			walkProcessorList(IndexPath(path+".switch", i)+".processors", &conf.Switch[i].Processors, fn)
+		}
+	case processor.TypeTry:
+		walkProcessorList(path+".try", (*[]processor.Config)(&conf.Try), fn)
+	case processor.TypeWhile:
+		walkProcessorList(path+".while.processors", &conf.While.Processors, fn)
+	case processor.TypeWorkflow:
+		for _, k := range sortedKeys(conf.Workflow.Branches) {
+			c := conf.Workflow.Branches[k]
+			walkProcessorList(path+".workflow.branches."+k+".processors", &c.Processors, fn)
+			conf.Workflow.Branches[k] = c
+		}
+		for _, k := range sortedKeys(conf.Workflow.Stages) {
+			c := conf.Workflow.Stages[k]
+			walkProcessorList(path+".workflow.stages."+k+".processors", &c.Processors, fn)
+			conf.Workflow.Stages[k] = c
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// InputFunc is called for each input within a config along with its YAML path,
+// e.g. `input.broker.inputs.0`. The input can be modified in place.
+type InputFunc func(path string, conf *input.Config)
+
+// WalkInputs calls fn for every input found within a config, including those
+// nested within other inputs and resources. An input is always visited before
+// the inputs nested within it.
+func WalkInputs(conf *config.Type, fn InputFunc) {
+	walkInput("input", &conf.Input, fn)
+
+	for _, k := range sortedKeys(conf.Manager.Inputs) {
+		c := conf.Manager.Inputs[k]
+		walkInput("resources.inputs."+k, &c, fn)
+		conf.Manager.Inputs[k] = c
+	}
+	for i := range conf.ResourceInputs {
+		walkInput(IndexPath("input_resources", i), &conf.ResourceInputs[i], fn)
+	}
+}
+
+func walkInput(path string, conf *input.Config, fn InputFunc) {
+	fn(path, conf)
+
+	switch conf.Type {
+	case input.TypeBroker:
+		for i := range conf.Broker.Inputs {
+			walkInput(IndexPath(path+".broker.inputs", i), &conf.Broker.Inputs[i], fn)
+		}
+	case input.TypeDynamic:
+		for _, k := range sortedKeys(conf.Dynamic.Inputs) {
+			c := conf.Dynamic.Inputs[k]
+			walkInput(path+".dynamic.inputs."+k, &c, fn)
+			conf.Dynamic.Inputs[k] = c
+		}
+	case input.TypeReadUntil:
+		if conf.ReadUntil.Input != nil {
+			walkInput(path+".read_until.input", conf.ReadUntil.Input, fn)
+		}
+	case input.TypeSequence:
+		for i := range conf.Sequence.Inputs {
+			walkInput(IndexPath(path+".sequence.inputs", i), &conf.Sequence.Inputs[i], fn)
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// OutputFunc is called for each output within a config along with its YAML
+// path, e.g. `output.switch.cases.0.output`. The output can be modified in
+// place.
+type OutputFunc func(path string, conf *output.Config)
+
+// WalkOutputs calls fn for every output found within a config, including those
+// nested within other outputs and resources. An output is always visited
+// before the outputs nested within it.
+func WalkOutputs(conf *config.Type, fn OutputFunc) {
+	walkOutput("output", &conf.Output, fn)
+
+	for _, k := range sortedKeys(conf.Manager.Outputs) {
+		c := conf.Manager.Outputs[k]
+		walkOutput("resources.outputs."+k, &c, fn)
+		conf.Manager.Outputs[k] = c
+	}
+	for i := range conf.ResourceOutputs {
+		walkOutput(IndexPath("output_resources", i), &conf.ResourceOutputs[i], fn)
+	}
+}
+
+func walkOutput(path string, conf *output.Config, fn OutputFunc) {
+	fn(path, conf)
+
+	switch conf.Type {
+	case output.TypeBroker:
+		for i := range conf.Broker.Outputs {
+			walkOutput(IndexPath(path+".broker.outputs", i), &conf.Broker.Outputs[i], fn)
+		}
+	case output.TypeDynamic:
+		for _, k := range sortedKeys(conf.Dynamic.Outputs) {
+			c := conf.Dynamic.Outputs[k]
+			walkOutput(path+".dynamic.outputs."+k, &c, fn)
+			conf.Dynamic.Outputs[k] = c
+		}
+	case output.TypeRetry:
+		if conf.Retry.Output != nil {
+			walkOutput(path+".retry.output", conf.Retry.Output, fn)
+		}
+	case output.TypeSwitch:
+		for i := range conf.Switch.Cases {
+			walkOutput(IndexPath(path+".switch.cases", i)+".output", &conf.Switch.Cases[i].Output, fn)
+		}
+		for i := range conf.Switch.Outputs {
+			walkOutput(IndexPath(path+".switch.outputs", i)+".output", &conf.Switch.Outputs[i].Output, fn)
+		}
+	case output.TypeTry:
+		for i := range conf.Try {
+			walkOutput(IndexPath(path+".try", i), &conf.Try[i], fn)
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// IndexPath appends an index to a YAML path.
+func IndexPath(path string, i int) string {
+	return path + "." + strconv.Itoa(i)
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch t := m.(type) {
+	case map[string]input.Config:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]output.Config:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]processor.Config:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]processor.BranchConfig:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]processor.DepProcessMapConfig:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case processor.ProcessDAGConfig:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//------------------------------------------------------------------------------
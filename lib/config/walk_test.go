@@ -0,0 +1,271 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Jeffail/benthos/v3/lib/input"
+	"github.com/Jeffail/benthos/v3/lib/output"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+)
+
+func TestWalkProcessors(t *testing.T) {
+	conf, err := Unmarshal(`
+input:
+  stdin: {}
+  processors:
+  - bloblang: 'root = this'
+pipeline:
+  processors:
+  - switch:
+    - check: 'this.foo == "bar"'
+      processors:
+      - bloblang: 'root = "bar"'
+    - processors:
+      - try:
+        - bloblang: 'root = "baz"'
+  - catch:
+    - log:
+        message: failed
+  - workflow:
+      branches:
+        b:
+          processors:
+          - noop: {}
+        a:
+          processors:
+          - noop: {}
+processor_resources:
+- label: foo
+  branch:
+    processors:
+    - noop: {}
+resources:
+  processors:
+    bar:
+      try:
+      - noop: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type visit struct {
+		path  string
+		count int
+	}
+	var visits []visit
+	WalkProcessors(&conf, func(path string, procs *[]processor.Config) {
+		visits = append(visits, visit{path, len(*procs)})
+	})
+
+	exp := []visit{
+		{"input.processors", 1},
+		{"pipeline.processors.0.switch.0.processors", 1},
+		{"pipeline.processors.0.switch.1.processors.0.try", 1},
+		{"pipeline.processors.0.switch.1.processors", 1},
+		{"pipeline.processors.1.catch", 1},
+		{"pipeline.processors.2.workflow.branches.a.processors", 1},
+		{"pipeline.processors.2.workflow.branches.b.processors", 1},
+		{"pipeline.processors", 3},
+		{"output.processors", 0},
+		{"resources.processors.bar.try", 1},
+		{"processor_resources.0.branch.processors", 1},
+		{"processor_resources", 1},
+	}
+	if !reflect.DeepEqual(exp, visits) {
+		t.Errorf("Wrong visits: %v != %v", visits, exp)
+	}
+}
+
+func TestWalkProcessorsNested(t *testing.T) {
+	conf, err := Unmarshal(`
+input:
+  sequence:
+    inputs:
+    - read_until:
+        input:
+          stdin: {}
+          processors:
+          - noop: {}
+        condition:
+          static: true
+    - dynamic:
+        inputs:
+          foo:
+            stdin: {}
+            processors:
+            - noop: {}
+output:
+  dynamic:
+    outputs:
+      bar:
+        stdout: {}
+        processors:
+        - noop: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	WalkProcessors(&conf, func(path string, procs *[]processor.Config) {
+		if len(*procs) > 0 {
+			paths = append(paths, path)
+		}
+	})
+
+	exp := []string{
+		"input.sequence.inputs.0.read_until.input.processors",
+		"input.sequence.inputs.1.dynamic.inputs.foo.processors",
+		"output.dynamic.outputs.bar.processors",
+	}
+	if !reflect.DeepEqual(exp, paths) {
+		t.Errorf("Wrong paths: %v != %v", paths, exp)
+	}
+}
+
+func TestWalkProcessorsModify(t *testing.T) {
+	conf, err := Unmarshal(`
+pipeline:
+  processors:
+  - branch:
+      processors:
+      - noop: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	WalkProcessors(&conf, func(path string, procs *[]processor.Config) {
+		for i := range *procs {
+			(*procs)[i].Label = path
+		}
+	})
+
+	if exp, act := "pipeline.processors", conf.Pipeline.Processors[0].Label; exp != act {
+		t.Errorf("Wrong label: %v != %v", act, exp)
+	}
+	if exp, act := "pipeline.processors.0.branch.processors", conf.Pipeline.Processors[0].Branch.Processors[0].Label; exp != act {
+		t.Errorf("Wrong label: %v != %v", act, exp)
+	}
+}
+
+func TestWalkInputs(t *testing.T) {
+	conf, err := Unmarshal(`
+input:
+  broker:
+    inputs:
+    - stdin: {}
+    - read_until:
+        input:
+          sequence:
+            inputs:
+            - stdin: {}
+        check: 'false'
+input_resources:
+- label: foo
+  stdin: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	WalkInputs(&conf, func(path string, conf *input.Config) {
+		paths = append(paths, path+":"+conf.Type)
+		if conf.Type == input.TypeSTDIN {
+			conf.STDIN.Codec = "modified"
+		}
+	})
+
+	exp := []string{
+		"input:broker",
+		"input.broker.inputs.0:stdin",
+		"input.broker.inputs.1:read_until",
+		"input.broker.inputs.1.read_until.input:sequence",
+		"input.broker.inputs.1.read_until.input.sequence.inputs.0:stdin",
+		"input_resources.0:stdin",
+	}
+	if !reflect.DeepEqual(exp, paths) {
+		t.Errorf("Wrong paths: %v != %v", paths, exp)
+	}
+
+	if exp, act := "modified", conf.Input.Broker.Inputs[1].ReadUntil.Input.Sequence.Inputs[0].STDIN.Codec; exp != act {
+		t.Errorf("Nested input not modified: %v != %v", act, exp)
+	}
+	if exp, act := "modified", conf.ResourceInputs[0].STDIN.Codec; exp != act {
+		t.Errorf("Resource input not modified: %v != %v", act, exp)
+	}
+}
+
+func TestWalkOutputs(t *testing.T) {
+	conf, err := Unmarshal(`
+output:
+  switch:
+    cases:
+    - check: 'this.foo == "bar"'
+      output:
+        stdout: {}
+    - output:
+        try:
+        - stdout: {}
+        - retry:
+            output:
+              stdout: {}
+output_resources:
+- label: foo
+  stdout: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	WalkOutputs(&conf, func(path string, conf *output.Config) {
+		paths = append(paths, path+":"+conf.Type)
+		if conf.Type == output.TypeSTDOUT {
+			conf.STDOUT.Codec = "modified"
+		}
+	})
+
+	exp := []string{
+		"output:switch",
+		"output.switch.cases.0.output:stdout",
+		"output.switch.cases.1.output:try",
+		"output.switch.cases.1.output.try.0:stdout",
+		"output.switch.cases.1.output.try.1:retry",
+		"output.switch.cases.1.output.try.1.retry.output:stdout",
+		"output_resources.0:stdout",
+	}
+	if !reflect.DeepEqual(exp, paths) {
+		t.Errorf("Wrong paths: %v != %v", paths, exp)
+	}
+
+	if exp, act := "modified", conf.Output.Switch.Cases[1].Output.Try[1].Retry.Output.STDOUT.Codec; exp != act {
+		t.Errorf("Nested output not modified: %v != %v", act, exp)
+	}
+	if exp, act := "modified", conf.ResourceOutputs[0].STDOUT.Codec; exp != act {
+		t.Errorf("Resource output not modified: %v != %v", act, exp)
+	}
+}
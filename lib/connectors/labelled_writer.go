@@ -0,0 +1,80 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package connectors
+
+import (
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/message/roundtrip"
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+//------------------------------------------------------------------------------
+
+// LabelledWriter is a writer implementation similar to roundtrip.Writer, where
+// batches are added to the ResultStore located in the context of the first
+// message part, but when the store is a ResultStore of this package each
+// batch is also tagged with the label of the writer.
+type LabelledWriter struct {
+	Label string
+
+	// Fields optionally resolves the fields that each part of a batch is
+	// tagged with.
+	Fields func(index int, msg types.Message) map[string]string
+}
+
+// Connect is a noop.
+func (w LabelledWriter) Connect() error {
+	return nil
+}
+
+// Write a message batch to a ResultStore located in the first message of the
+// batch.
+func (w LabelledWriter) Write(msg types.Message) error {
+	ctx := message.GetContext(msg.Get(0))
+	switch store := ctx.Value(roundtrip.ResultStoreKey).(type) {
+	case *ResultStore:
+		var fields []map[string]string
+		if w.Fields != nil {
+			fields = make([]map[string]string, msg.Len())
+			for i := range fields {
+				fields[i] = w.Fields(i, msg)
+			}
+		}
+		store.AddAnnotated(w.Label, msg, fields)
+	case roundtrip.ResultStore:
+		store.Add(msg)
+	default:
+		return roundtrip.ErrNoStore
+	}
+	return nil
+}
+
+// CloseAsync is a noop.
+func (w LabelledWriter) CloseAsync() {}
+
+// WaitForClose is a noop.
+func (w LabelledWriter) WaitForClose(time.Duration) error {
+	return nil
+}
+
+//------------------------------------------------------------------------------
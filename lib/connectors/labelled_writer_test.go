@@ -0,0 +1,124 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package connectors
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/message/roundtrip"
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+func TestLabelledWriter(t *testing.T) {
+	var results []types.Message
+
+	r := NewRoundTripReader(func() (types.Message, error) {
+		return message.New([][]byte{[]byte("foo")}), nil
+	}, func(msgs []types.Message, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		results = msgs
+	})
+
+	msg, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = (LabelledWriter{Label: "first"}).Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err = (LabelledWriter{}).Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Acknowledge(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp, act := 2, len(results); exp != act {
+		t.Fatalf("Wrong count of results: %v != %v", act, exp)
+	}
+	if exp, act := [][]byte{[]byte("foo")}, message.GetAllBytes(results[0]); !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong result: %v != %v", act, exp)
+	}
+	if label, ok := OutputLabel(results[0].Get(0)); !ok || label != "first" {
+		t.Errorf("Wrong label: %v (%v)", label, ok)
+	}
+	if label, ok := OutputLabel(results[1].Get(0)); ok {
+		t.Errorf("Unexpected label: %v", label)
+	}
+}
+
+func TestLabelledWriterFields(t *testing.T) {
+	var results []types.Message
+
+	r := NewRoundTripReader(func() (types.Message, error) {
+		return message.New([][]byte{[]byte("foo"), []byte("bar")}), nil
+	}, func(msgs []types.Message, err error) {
+		results = msgs
+	})
+
+	msg, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := LabelledWriter{
+		Label: "foo",
+		Fields: func(index int, msg types.Message) map[string]string {
+			return map[string]string{"topic": string(msg.Get(index).Get())}
+		},
+	}
+	if err = w.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Acknowledge(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp, act := 1, len(results); exp != act {
+		t.Fatalf("Wrong count of results: %v != %v", act, exp)
+	}
+	for i, exp := range []string{"foo", "bar"} {
+		if act := OutputFields(results[0].Get(i))["topic"]; exp != act {
+			t.Errorf("Wrong field of part %v: %v != %v", i, act, exp)
+		}
+	}
+}
+
+func TestLabelledWriterForeignStore(t *testing.T) {
+	msg := message.New([][]byte{[]byte("foo")})
+	if err := (LabelledWriter{Label: "foo"}).Write(msg); err != roundtrip.ErrNoStore {
+		t.Errorf("Expected no store error, received: %v", err)
+	}
+
+	store := roundtrip.NewResultStore()
+	roundtrip.AddResultStore(msg, store)
+	if err := (LabelledWriter{Label: "foo"}).Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 1, len(store.Get()); exp != act {
+		t.Errorf("Wrong count of results: %v != %v", act, exp)
+	}
+}
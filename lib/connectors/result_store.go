@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package connectors
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+//------------------------------------------------------------------------------
+
+type outputLabelKey struct{}
+
+type outputFieldsKey struct{}
+
+// ResultStore is a roundtrip.ResultStore that is also able to record the label
+// of the output that stored each batch.
+type ResultStore struct {
+	payloads []types.Message
+	sync.RWMutex
+}
+
+// NewResultStore returns an empty ResultStore.
+func NewResultStore() *ResultStore {
+	return &ResultStore{}
+}
+
+// Add a batch to the store without a label.
+func (r *ResultStore) Add(msg types.Message) {
+	r.AddLabelled("", msg)
+}
+
+// AddLabelled adds a deep copy of a batch to the store, where each part has
+// its context replaced with one that only carries the label of the output.
+func (r *ResultStore) AddLabelled(label string, msg types.Message) {
+	r.AddAnnotated(label, msg, nil)
+}
+
+// AddAnnotated adds a batch like AddLabelled, where each part is also tagged
+// with the fields of the same index, such as the topic or key that the part
+// would have been written with.
+func (r *ResultStore) AddAnnotated(label string, msg types.Message, fields []map[string]string) {
+	ctx := context.Background()
+	if len(label) > 0 {
+		ctx = context.WithValue(ctx, outputLabelKey{}, label)
+	}
+	stored := message.New(nil)
+	msg.DeepCopy().Iter(func(i int, p types.Part) error {
+		pCtx := ctx
+		if i < len(fields) && len(fields[i]) > 0 {
+			pCtx = context.WithValue(ctx, outputFieldsKey{}, fields[i])
+		}
+		stored.Append(message.WithContext(pCtx, p))
+		return nil
+	})
+
+	r.Lock()
+	r.payloads = append(r.payloads, stored)
+	r.Unlock()
+}
+
+// Get the stored batches.
+func (r *ResultStore) Get() []types.Message {
+	r.RLock()
+	defer r.RUnlock()
+	return r.payloads
+}
+
+// Clear the stored batches.
+func (r *ResultStore) Clear() {
+	r.Lock()
+	r.payloads = nil
+	r.Unlock()
+}
+
+// OutputLabel returns the label of the output that stored a part, if any.
+func OutputLabel(p types.Part) (string, bool) {
+	label, ok := message.GetContext(p).Value(outputLabelKey{}).(string)
+	return label, ok
+}
+
+// OutputFields returns the fields that a part was tagged with when stored, if
+// any.
+func OutputFields(p types.Part) map[string]string {
+	fields, _ := message.GetContext(p).Value(outputFieldsKey{}).(map[string]string)
+	return fields
+}
+
+//------------------------------------------------------------------------------
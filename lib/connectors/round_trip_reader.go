@@ -50,7 +50,7 @@ func NewRoundTripReader(
 	return &RoundTripReader{
 		read:           read,
 		processResults: processResults,
-		store:          roundtrip.NewResultStore(),
+		store:          NewResultStore(),
 	}
 }
 
@@ -0,0 +1,292 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+//------------------------------------------------------------------------------
+
+// Kinds of difference.
+const (
+	KindAdded   = "added"
+	KindRemoved = "removed"
+	KindChanged = "changed"
+)
+
+// Difference describes a value that differs between A and B at a path. The
+// path is dot separated, with array elements referenced by their index, and is
+// empty for the root of a document.
+type Difference struct {
+	Path string
+	Kind string
+	A    interface{}
+	B    interface{}
+}
+
+// String returns a human readable description of a difference.
+func (d Difference) String() string {
+	path := d.Path
+	if len(path) == 0 {
+		path = "(root)"
+	}
+	switch d.Kind {
+	case KindAdded:
+		return fmt.Sprintf("%v: added %v", path, marshal(d.B))
+	case KindRemoved:
+		return fmt.Sprintf("%v: removed %v", path, marshal(d.A))
+	}
+	return fmt.Sprintf("%v: %v -> %v", path, marshal(d.A), marshal(d.B))
+}
+
+func marshal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// JSON returns the structural differences between two parsed JSON documents
+// sorted by path.
+func JSON(a, b interface{}) []Difference {
+	var diffs []Difference
+	walkJSON("", a, b, &diffs)
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs
+}
+
+func joinPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func walkJSON(path string, a, b interface{}, diffs *[]Difference) {
+	switch aT := a.(type) {
+	case map[string]interface{}:
+		if bT, ok := b.(map[string]interface{}); ok {
+			for k, av := range aT {
+				if bv, exists := bT[k]; exists {
+					walkJSON(joinPath(path, k), av, bv, diffs)
+				} else {
+					*diffs = append(*diffs, Difference{Path: joinPath(path, k), Kind: KindRemoved, A: av})
+				}
+			}
+			for k, bv := range bT {
+				if _, exists := aT[k]; !exists {
+					*diffs = append(*diffs, Difference{Path: joinPath(path, k), Kind: KindAdded, B: bv})
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if bT, ok := b.([]interface{}); ok {
+			for i, av := range aT {
+				p := joinPath(path, strconv.Itoa(i))
+				if i < len(bT) {
+					walkJSON(p, av, bT[i], diffs)
+				} else {
+					*diffs = append(*diffs, Difference{Path: p, Kind: KindRemoved, A: av})
+				}
+			}
+			for i := len(aT); i < len(bT); i++ {
+				*diffs = append(*diffs, Difference{Path: joinPath(path, strconv.Itoa(i)), Kind: KindAdded, B: bT[i]})
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, Difference{Path: path, Kind: KindChanged, A: a, B: b})
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// Part is a message part flattened for comparison.
+type Part struct {
+	Content  []byte
+	Metadata map[string]string
+}
+
+// PartsOf flattens batches of messages into a list of parts.
+func PartsOf(msgs []types.Message) []Part {
+	var parts []Part
+	for _, m := range msgs {
+		m.Iter(func(i int, p types.Part) error {
+			meta := map[string]string{}
+			p.Metadata().Iter(func(k, v string) error {
+				meta[k] = v
+				return nil
+			})
+			parts = append(parts, Part{
+				Content:  p.Get(),
+				Metadata: meta,
+			})
+			return nil
+		})
+	}
+	return parts
+}
+
+// PartDiff is the comparison of the parts found at the same index of A and B,
+// where either part is nil if the other list is longer.
+type PartDiff struct {
+	Index int
+	A     *Part
+	B     *Part
+
+	// JSON is true when both contents parse as JSON and were therefore
+	// compared structurally, otherwise a difference in content is a single
+	// change at the root.
+	JSON     bool
+	Content  []Difference
+	Metadata []Difference
+}
+
+// Equal returns true if both parts exist and do not differ.
+func (p PartDiff) Equal() bool {
+	return p.A != nil && p.B != nil && len(p.Content) == 0 && len(p.Metadata) == 0
+}
+
+// Parts aligns two lists of parts by index and compares them.
+func Parts(a, b []Part) []PartDiff {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	diffs := make([]PartDiff, n)
+	for i := 0; i < n; i++ {
+		d := PartDiff{Index: i}
+		if i < len(a) {
+			d.A = &a[i]
+		}
+		if i < len(b) {
+			d.B = &b[i]
+		}
+		if d.A != nil && d.B != nil {
+			d.JSON, d.Content = compareContent(d.A.Content, d.B.Content)
+			d.Metadata = compareMetadata(d.A.Metadata, d.B.Metadata)
+		}
+		diffs[i] = d
+	}
+	return diffs
+}
+
+func compareContent(a, b []byte) (bool, []Difference) {
+	var aV, bV interface{}
+	if json.Unmarshal(a, &aV) == nil && json.Unmarshal(b, &bV) == nil {
+		return true, JSON(aV, bV)
+	}
+	if bytes.Equal(a, b) {
+		return false, nil
+	}
+	return false, []Difference{{Kind: KindChanged, A: string(a), B: string(b)}}
+}
+
+func compareMetadata(a, b map[string]string) []Difference {
+	aV, bV := make(map[string]interface{}, len(a)), make(map[string]interface{}, len(b))
+	for k, v := range a {
+		aV[k] = v
+	}
+	for k, v := range b {
+		bV[k] = v
+	}
+	return JSON(aV, bV)
+}
+
+//------------------------------------------------------------------------------
+
+// Line is a line of text that is either in both A and B, removed from A or
+// added in B.
+type Line struct {
+	Kind string
+	Text string
+}
+
+// String returns the line prefixed in the style of a unified diff.
+func (l Line) String() string {
+	switch l.Kind {
+	case KindAdded:
+		return "+ " + l.Text
+	case KindRemoved:
+		return "- " + l.Text
+	}
+	return "  " + l.Text
+}
+
+// Lines returns the lines of A and B in order along with whether each was
+// removed from A, added in B or kept, using the longest common subsequence of
+// their lines.
+func Lines(a, b string) []Line {
+	aLines := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	bLines := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of aLines[i:]
+	// and bLines[j:].
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]Line, 0, len(aLines)+len(bLines))
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			lines = append(lines, Line{Text: aLines[i]})
+			i++
+			j++
+		case j == len(bLines) || i < len(aLines) && lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Kind: KindRemoved, Text: aLines[i]})
+			i++
+		default:
+			lines = append(lines, Line{Kind: KindAdded, Text: bLines[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+//------------------------------------------------------------------------------
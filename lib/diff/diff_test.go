@@ -0,0 +1,151 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+func parseJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestJSON(t *testing.T) {
+	a := parseJSON(t, `{"a":1,"b":{"c":[1,2,3],"d":"foo"},"e":true}`)
+	b := parseJSON(t, `{"a":1,"b":{"c":[1,5],"d":"bar","f":null},"e":"true"}`)
+
+	exp := []Difference{
+		{Path: "b.c.1", Kind: KindChanged, A: 2.0, B: 5.0},
+		{Path: "b.c.2", Kind: KindRemoved, A: 3.0},
+		{Path: "b.d", Kind: KindChanged, A: "foo", B: "bar"},
+		{Path: "b.f", Kind: KindAdded},
+		{Path: "e", Kind: KindChanged, A: true, B: "true"},
+	}
+	if act := JSON(a, b); !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong differences: %v != %v", act, exp)
+	}
+
+	if act := JSON(a, a); len(act) > 0 {
+		t.Errorf("Unexpected differences: %v", act)
+	}
+}
+
+func TestParts(t *testing.T) {
+	batchA := message.New([][]byte{
+		[]byte(`{"id":1,"name":"foo"}`),
+		[]byte(`not json`),
+		[]byte(`same`),
+	})
+	batchA.Get(2).Metadata().Set("key", "a")
+	batchB := message.New([][]byte{
+		[]byte(`{"name":"foo", "id":2}`),
+		[]byte(`also not json`),
+		[]byte(`same`),
+		[]byte(`extra`),
+	})
+	batchB.Get(2).Metadata().Set("key", "b")
+
+	diffs := Parts(PartsOf([]types.Message{batchA}), PartsOf([]types.Message{batchB}))
+	if exp, act := 4, len(diffs); exp != act {
+		t.Fatalf("Wrong count of diffs: %v != %v", act, exp)
+	}
+
+	if !diffs[0].JSON {
+		t.Error("Expected JSON comparison")
+	}
+	if exp, act := []Difference{{Path: "id", Kind: KindChanged, A: 1.0, B: 2.0}}, diffs[0].Content; !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong content diff: %v != %v", act, exp)
+	}
+
+	if diffs[1].JSON {
+		t.Error("Unexpected JSON comparison")
+	}
+	if exp, act := []Difference{{Kind: KindChanged, A: "not json", B: "also not json"}}, diffs[1].Content; !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong content diff: %v != %v", act, exp)
+	}
+
+	if len(diffs[2].Content) > 0 {
+		t.Errorf("Unexpected content diff: %v", diffs[2].Content)
+	}
+	if exp, act := []Difference{{Path: "key", Kind: KindChanged, A: "a", B: "b"}}, diffs[2].Metadata; !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong metadata diff: %v != %v", act, exp)
+	}
+	if diffs[2].Equal() {
+		t.Error("Expected parts with different metadata to differ")
+	}
+
+	if diffs[3].A != nil || diffs[3].B == nil || diffs[3].Equal() {
+		t.Errorf("Wrong unaligned part: %+v", diffs[3])
+	}
+}
+
+func TestPartsEqual(t *testing.T) {
+	parts := []Part{{Content: []byte(`{"a":[1,2]}`)}, {Content: []byte(`foo`)}}
+	for _, d := range Parts(parts, parts) {
+		if !d.Equal() {
+			t.Errorf("Expected part %v to be equal: %+v", d.Index, d)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	a := `pipeline:
+  processors:
+    - text:
+        operator: to_upper
+    - noop: {}
+`
+	b := `pipeline:
+  processors:
+    - bloblang: root = content().uppercase()
+    - noop: {}
+`
+	exp := []Line{
+		{Text: "pipeline:"},
+		{Text: "  processors:"},
+		{Kind: KindRemoved, Text: "    - text:"},
+		{Kind: KindRemoved, Text: "        operator: to_upper"},
+		{Kind: KindAdded, Text: "    - bloblang: root = content().uppercase()"},
+		{Text: "    - noop: {}"},
+	}
+	if act := Lines(a, b); !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong lines: %v != %v", act, exp)
+	}
+
+	if act := Lines(a, a); len(act) != 5 {
+		t.Errorf("Wrong count of lines: %v", len(act))
+	}
+	for _, l := range Lines(a, a) {
+		if l.Kind != "" {
+			t.Errorf("Unexpected difference: %v", l)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package httpmock provides an HTTP transport that serves canned responses in
+// place of real requests, and records every request made through it.
+package httpmock
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//------------------------------------------------------------------------------
+
+// Rule describes a canned response to requests of a method, where an empty
+// method or `*` matches any, and a URL pattern, where `*` matches any sequence
+// of characters.
+type Rule struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+func (r Rule) response(req *http.Request) *http.Response {
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return newResponse(req, status, r.Headers, r.Body)
+}
+
+func newResponse(req *http.Request, status int, headers map[string]string, body string) *http.Response {
+	header := http.Header{}
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%v %v", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type compiledRule struct {
+	rule Rule
+	url  *regexp.Regexp
+}
+
+func (c compiledRule) matches(method, url string) bool {
+	if m := c.rule.Method; len(m) > 0 && m != "*" && !strings.EqualFold(m, method) {
+		return false
+	}
+	return c.url.MatchString(url)
+}
+
+// globToRegexp converts a URL pattern into an anchored regular expression.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	segments := strings.Split(pattern, "*")
+	for i, s := range segments {
+		segments[i] = regexp.QuoteMeta(s)
+	}
+	return regexp.Compile("^" + strings.Join(segments, ".*") + "$")
+}
+
+//------------------------------------------------------------------------------
+
+// Request is a record of a request made through a Transport.
+type Request struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+
+	// Mocked is true when the response was served from a rule.
+	Mocked bool
+	Status int
+	Error  string
+}
+
+// MaxRequests is the number of requests a Table keeps, after which the oldest
+// are dropped.
+const MaxRequests = 1000
+
+// Table is a list of rules along with the requests that were matched against
+// them.
+type Table struct {
+	rules    []compiledRule
+	requests []Request
+	observer func(Request)
+
+	sync.Mutex
+}
+
+// NewTable returns an empty Table.
+func NewTable() *Table {
+	return &Table{}
+}
+
+// SetRules replaces the rules of the table, returning an error if a URL
+// pattern is invalid.
+func (t *Table) SetRules(rules []Rule) error {
+	compiled := make([]compiledRule, len(rules))
+	for i, r := range rules {
+		re, err := globToRegexp(r.URL)
+		if err != nil {
+			return fmt.Errorf("rule %v: %w", i, err)
+		}
+		compiled[i] = compiledRule{rule: r, url: re}
+	}
+	t.Lock()
+	t.rules = compiled
+	t.Unlock()
+	return nil
+}
+
+// Len returns the number of rules within the table.
+func (t *Table) Len() int {
+	t.Lock()
+	defer t.Unlock()
+	return len(t.rules)
+}
+
+// Match returns the first rule that matches a method and URL.
+func (t *Table) Match(method, url string) (Rule, bool) {
+	t.Lock()
+	defer t.Unlock()
+	for _, r := range t.rules {
+		if r.matches(method, url) {
+			return r.rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// SetObserver sets a function to be called with each recorded request.
+func (t *Table) SetObserver(fn func(Request)) {
+	t.Lock()
+	t.observer = fn
+	t.Unlock()
+}
+
+func (t *Table) record(req Request) {
+	t.Lock()
+	if len(t.requests) >= MaxRequests {
+		t.requests = t.requests[1:]
+	}
+	t.requests = append(t.requests, req)
+	observer := t.observer
+	t.Unlock()
+
+	if observer != nil {
+		observer(req)
+	}
+}
+
+// Requests returns the recorded requests, oldest first.
+func (t *Table) Requests() []Request {
+	t.Lock()
+	defer t.Unlock()
+	requests := make([]Request, len(t.requests))
+	copy(requests, t.requests)
+	return requests
+}
+
+// ClearRequests removes all recorded requests.
+func (t *Table) ClearRequests() {
+	t.Lock()
+	t.requests = nil
+	t.Unlock()
+}
+
+//------------------------------------------------------------------------------
+
+// Transport is an http.RoundTripper that serves requests from the first of a
+// list of tables with a matching rule. Requests that match no rule receive a
+// 404 response, unless none of the tables have rules, in which case they are
+// sent with the fallback transport. Either way the request is recorded.
+type Transport struct {
+	// Tables returns the tables to match a request against in order.
+	Tables func() []*Table
+
+	Fallback http.RoundTripper
+}
+
+// RoundTrip serves a request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := Request{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: map[string]string{},
+	}
+	for k := range req.Header {
+		rec.Headers[k] = req.Header.Get(k)
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		rec.Body = string(body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	tables := t.Tables()
+
+	var firstMocked *Table
+	for _, table := range tables {
+		if table.Len() == 0 {
+			continue
+		}
+		if firstMocked == nil {
+			firstMocked = table
+		}
+		if rule, ok := table.Match(rec.Method, rec.URL); ok {
+			res := rule.response(req)
+			rec.Mocked, rec.Status = true, res.StatusCode
+			table.record(rec)
+			return res, nil
+		}
+	}
+
+	if firstMocked != nil {
+		rec.Status = http.StatusNotFound
+		firstMocked.record(rec)
+		return newResponse(req, http.StatusNotFound, nil, fmt.Sprintf("no mock matches %v %v", rec.Method, rec.URL)), nil
+	}
+
+	res, err := t.Fallback.RoundTrip(req)
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Status = res.StatusCode
+	}
+	if len(tables) > 0 {
+		tables[0].record(rec)
+	}
+	return res, err
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,194 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package httpmock
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTableMatch(t *testing.T) {
+	table := NewTable()
+	if err := table.SetRules([]Rule{
+		{Method: "POST", URL: "http://example.com/items", Body: "created"},
+		{URL: "http://example.com/items/*", Body: "item"},
+		{Method: "*", URL: "*", Status: 503},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, url, body string
+		status            int
+	}{
+		{"POST", "http://example.com/items", "created", 0},
+		{"get", "http://example.com/items/foo/bar", "item", 0},
+		{"GET", "http://example.com/items", "", 503},
+		{"DELETE", "http://other.com/items/foo", "", 503},
+	}
+
+	for _, test := range tests {
+		rule, ok := table.Match(test.method, test.url)
+		if !ok {
+			t.Errorf("%v %v: no match", test.method, test.url)
+			continue
+		}
+		if rule.Body != test.body || rule.Status != test.status {
+			t.Errorf("%v %v: wrong rule: %+v", test.method, test.url, rule)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	table := NewTable()
+	if err := table.SetRules([]Rule{
+		{Method: "POST", URL: "http://example.com/*", Status: 201, Headers: map[string]string{"X-Foo": "bar"}, Body: "ok"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var observed []Request
+	table.SetObserver(func(r Request) {
+		observed = append(observed, r)
+	})
+
+	client := &http.Client{Transport: &Transport{
+		Tables: func() []*Table { return []*Table{NewTable(), table} },
+		Fallback: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("should not be called")
+		}),
+	}}
+
+	res, err := client.Post("http://example.com/foo", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if exp, act := 201, res.StatusCode; exp != act {
+		t.Errorf("Wrong status: %v != %v", act, exp)
+	}
+	if exp, act := "bar", res.Header.Get("X-Foo"); exp != act {
+		t.Errorf("Wrong header: %v != %v", act, exp)
+	}
+	if exp, act := "ok", string(body); exp != act {
+		t.Errorf("Wrong body: %v != %v", act, exp)
+	}
+
+	if res, err = client.Get("http://example.com/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 404, res.StatusCode; exp != act {
+		t.Errorf("Wrong status: %v != %v", act, exp)
+	}
+
+	reqs := table.Requests()
+	if exp, act := 2, len(reqs); exp != act {
+		t.Fatalf("Wrong count of requests: %v != %v", act, exp)
+	}
+	if exp, act := "hello", reqs[0].Body; exp != act {
+		t.Errorf("Wrong recorded body: %v != %v", act, exp)
+	}
+	if !reqs[0].Mocked || reqs[1].Mocked {
+		t.Errorf("Wrong mocked flags: %+v", reqs)
+	}
+	if exp, act := 2, len(observed); exp != act {
+		t.Errorf("Wrong count of observed requests: %v != %v", act, exp)
+	}
+}
+
+func TestTransportSharedTables(t *testing.T) {
+	first, second := NewTable(), NewTable()
+	if err := first.SetRules([]Rule{
+		{URL: "http://example.com/*", Status: 201},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.SetRules([]Rule{
+		{URL: "http://example.com/*", Status: 202},
+		{URL: "http://example.org/*", Status: 203},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &Transport{
+		Tables: func() []*Table { return []*Table{first, second} },
+		Fallback: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("should not be called")
+		}),
+	}}
+
+	for url, exp := range map[string]int{
+		"http://example.com/foo": 201,
+		"http://example.org/foo": 203,
+		"http://example.net/foo": 404,
+	} {
+		res, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if act := res.StatusCode; exp != act {
+			t.Errorf("Wrong status for %v: %v != %v", url, act, exp)
+		}
+	}
+
+	if exp, act := 2, len(first.Requests()); exp != act {
+		t.Errorf("Wrong count of requests in first table: %v != %v", act, exp)
+	}
+	reqs := second.Requests()
+	if exp, act := 1, len(reqs); exp != act {
+		t.Fatalf("Wrong count of requests in second table: %v != %v", act, exp)
+	}
+	if exp, act := "http://example.org/foo", reqs[0].URL; exp != act {
+		t.Errorf("Wrong recorded url: %v != %v", act, exp)
+	}
+}
+
+func TestTransportFallback(t *testing.T) {
+	table := NewTable()
+	client := &http.Client{Transport: &Transport{
+		Tables: func() []*Table { return []*Table{table} },
+		Fallback: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return newResponse(req, 202, nil, "real"), nil
+		}),
+	}}
+
+	res, err := client.Get("http://example.com/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := 202, res.StatusCode; exp != act {
+		t.Errorf("Wrong status: %v != %v", act, exp)
+	}
+
+	reqs := table.Requests()
+	if len(reqs) != 1 || reqs[0].Mocked || reqs[0].Status != 202 {
+		t.Errorf("Wrong recorded requests: %+v", reqs)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package probe
+
+import (
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+//------------------------------------------------------------------------------
+
+type chain []Hooks
+
+// Chain combines multiple hooks into one. Before hooks are called in order,
+// each receiving the batch returned by the previous, and the first error
+// encountered is returned. After hooks are called in reverse order.
+func Chain(hooks ...Hooks) Hooks {
+	return chain(hooks)
+}
+
+func (c chain) Before(info Info, msg types.Message) (types.Message, error) {
+	var err error
+	for _, h := range c {
+		if msg, err = h.Before(info, msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+func (c chain) After(info Info, msgs []types.Message, res types.Response, took time.Duration) {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i].After(info, msgs, res, took)
+	}
+}
+
+//------------------------------------------------------------------------------
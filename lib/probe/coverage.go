@@ -0,0 +1,240 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package probe
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/config"
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"github.com/Jeffail/benthos/v3/lib/types"
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+)
+
+//------------------------------------------------------------------------------
+
+type inputIndexKey struct{}
+
+// TagInput adds the index of an input batch to the context of each of its
+// parts so that probes are able to attribute coverage to it.
+func TagInput(msg types.Message, index int) types.Message {
+	tagged := message.New(nil)
+	msg.Iter(func(i int, p types.Part) error {
+		ctx := context.WithValue(message.GetContext(p), inputIndexKey{}, index)
+		tagged.Append(message.WithContext(ctx, p))
+		return nil
+	})
+	return tagged
+}
+
+// InputIndex returns the index of the input batch that a part originated from.
+func InputIndex(p types.Part) (int, bool) {
+	i, ok := message.GetContext(p).Value(inputIndexKey{}).(int)
+	return i, ok
+}
+
+//------------------------------------------------------------------------------
+
+// Hit describes how many times a processor, or a list of processors such as a
+// switch case or catch block, was reached during execution.
+type Hit struct {
+	Path  string `json:"path"`
+	Type  string `json:"type,omitempty"`
+	Label string `json:"label,omitempty"`
+
+	// Batches is the number of batches that reached the component.
+	Batches int `json:"batches"`
+
+	// Messages is the number of message parts that reached the component.
+	Messages int `json:"messages"`
+
+	// Passed is the number of message parts that remained after processing,
+	// which for filters is the number of parts that passed the condition.
+	Passed int `json:"passed"`
+
+	// Failed is the number of parts flagged as having failed after processing.
+	Failed int `json:"failed"`
+
+	// Inputs are the indexes of the input batches that reached the component.
+	Inputs []int `json:"inputs"`
+}
+
+// Coverage is a Hooks implementation that records which processors and lists
+// of processors were exercised by each input batch. Lists are keyed by their
+// own path, e.g. `pipeline.processors.0.switch.1.processors` for a switch case,
+// and are only considered hit when their first processor is reached.
+type Coverage struct {
+	enabled bool
+	hits    map[string]*Hit
+	inputs  map[string]map[int]struct{}
+
+	sync.Mutex
+}
+
+// NewCoverage creates a disabled coverage recorder.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		hits:   map[string]*Hit{},
+		inputs: map[string]map[int]struct{}{},
+	}
+}
+
+// Enable or disable the recording of coverage.
+func (c *Coverage) Enable(enabled bool) {
+	c.Lock()
+	c.enabled = enabled
+	c.Unlock()
+}
+
+// Enabled returns whether coverage is currently being recorded.
+func (c *Coverage) Enabled() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.enabled
+}
+
+// Reset clears all recorded hits and seeds an empty hit for every processor
+// and list of processors within a config, so that components that are never
+// reached are still reported.
+func (c *Coverage) Reset(conf config.Type) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.hits = map[string]*Hit{}
+	c.inputs = map[string]map[int]struct{}{}
+	labConfig.WalkProcessors(&conf, func(path string, procs *[]processor.Config) {
+		if len(*procs) == 0 {
+			return
+		}
+		c.hits[path] = &Hit{Path: path}
+		for i, p := range *procs {
+			pPath := labConfig.IndexPath(path, i)
+			c.hits[pPath] = &Hit{
+				Path:  pPath,
+				Type:  p.Type,
+				Label: p.Label,
+			}
+		}
+	})
+	for k, p := range conf.Manager.Processors {
+		pPath := "resources.processors." + k
+		c.hits[pPath] = &Hit{
+			Path:  pPath,
+			Type:  p.Type,
+			Label: p.Label,
+		}
+	}
+}
+
+func (c *Coverage) hit(path string) *Hit {
+	h, exists := c.hits[path]
+	if !exists {
+		h = &Hit{Path: path}
+		c.hits[path] = h
+	}
+	return h
+}
+
+func (c *Coverage) addInputs(path string, msg types.Message) {
+	set, exists := c.inputs[path]
+	if !exists {
+		set = map[int]struct{}{}
+		c.inputs[path] = set
+	}
+	msg.Iter(func(i int, p types.Part) error {
+		if index, ok := InputIndex(p); ok {
+			set[index] = struct{}{}
+		}
+		return nil
+	})
+}
+
+// Before records that a batch reached a processor.
+func (c *Coverage) Before(info Info, msg types.Message) (types.Message, error) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.enabled {
+		return msg, nil
+	}
+
+	h := c.hit(info.Path)
+	h.Type, h.Label = info.Type, info.Label
+	h.Batches++
+	h.Messages += msg.Len()
+	c.addInputs(info.Path, msg)
+
+	if strings.HasSuffix(info.Path, ".0") {
+		listPath := strings.TrimSuffix(info.Path, ".0")
+		lh := c.hit(listPath)
+		lh.Batches++
+		lh.Messages += msg.Len()
+		c.addInputs(listPath, msg)
+	}
+	return msg, nil
+}
+
+// After records the parts that survived a processor.
+func (c *Coverage) After(info Info, msgs []types.Message, res types.Response, took time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.enabled {
+		return
+	}
+
+	h := c.hit(info.Path)
+	for _, m := range msgs {
+		h.Passed += m.Len()
+		m.Iter(func(i int, p types.Part) error {
+			if processor.HasFailed(p) {
+				h.Failed++
+			}
+			return nil
+		})
+	}
+}
+
+// Hits returns a snapshot of all recorded hits sorted by path.
+func (c *Coverage) Hits() []Hit {
+	c.Lock()
+	defer c.Unlock()
+
+	hits := make([]Hit, 0, len(c.hits))
+	for path, h := range c.hits {
+		hCopy := *h
+		hCopy.Inputs = []int{}
+		for index := range c.inputs[path] {
+			hCopy.Inputs = append(hCopy.Inputs, index)
+		}
+		sort.Ints(hCopy.Inputs)
+		hits = append(hits, hCopy)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Path < hits[j].Path
+	})
+	return hits
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,109 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package probe
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/log"
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/metrics"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"github.com/Jeffail/benthos/v3/lib/types"
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+)
+
+func init() {
+	RegisterPlugin()
+}
+
+func TestCoverage(t *testing.T) {
+	conf, err := labConfig.Unmarshal(`
+pipeline:
+  processors:
+  - switch:
+    - check: 'this.route == "a"'
+      processors:
+      - bloblang: 'root.routed = "a"'
+    - check: 'this.route == "b"'
+      processors:
+      - bloblang: 'root.routed = "b"'
+  - bloblang: 'root = if this.routed == "a" { deleted() }'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cov := NewCoverage()
+	cov.Reset(conf)
+	cov.Enable(true)
+
+	Instrument(&conf, cov)
+
+	procs := make([]types.Processor, len(conf.Pipeline.Processors))
+	for i, pConf := range conf.Pipeline.Processors {
+		if procs[i], err = processor.New(pConf, types.NoopMgr(), log.Noop(), metrics.Noop()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inputs := []string{`{"route":"a"}`, `{"route":"a"}`, `{"route":"c"}`}
+	for i, in := range inputs {
+		msg := TagInput(message.New([][]byte{[]byte(in)}), i)
+		processor.ExecuteAll(procs, msg)
+	}
+
+	type summary struct {
+		Batches, Messages, Passed int
+		Inputs                    []int
+	}
+	act := map[string]summary{}
+	for _, h := range cov.Hits() {
+		act[h.Path] = summary{h.Batches, h.Messages, h.Passed, h.Inputs}
+	}
+
+	exp := map[string]summary{
+		"pipeline.processors":                         {3, 3, 0, []int{0, 1, 2}},
+		"pipeline.processors.0":                       {3, 3, 3, []int{0, 1, 2}},
+		"pipeline.processors.0.switch.0.processors":   {2, 2, 0, []int{0, 1}},
+		"pipeline.processors.0.switch.0.processors.0": {2, 2, 2, []int{0, 1}},
+		"pipeline.processors.0.switch.1.processors":   {0, 0, 0, []int{}},
+		"pipeline.processors.0.switch.1.processors.0": {0, 0, 0, []int{}},
+		"pipeline.processors.1":                       {3, 3, 1, []int{0, 1, 2}},
+	}
+	if !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong coverage: %v != %v", act, exp)
+	}
+}
+
+func TestCoverageDisabled(t *testing.T) {
+	cov := NewCoverage()
+	msg := message.New([][]byte{[]byte("foo")})
+	if _, err := cov.Before(Info{Path: "pipeline.processors.0"}, msg); err != nil {
+		t.Fatal(err)
+	}
+	cov.After(Info{Path: "pipeline.processors.0"}, []types.Message{msg}, nil, time.Second)
+	if hits := cov.Hits(); len(hits) > 0 {
+		t.Errorf("Unexpected hits: %v", hits)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package probe
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/config"
+	"github.com/Jeffail/benthos/v3/lib/log"
+	"github.com/Jeffail/benthos/v3/lib/metrics"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"github.com/Jeffail/benthos/v3/lib/response"
+	"github.com/Jeffail/benthos/v3/lib/types"
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+)
+
+//------------------------------------------------------------------------------
+
+// TypeProbe is the name of the processor plugin used to wrap processors.
+const TypeProbe = "benthos_lab_probe"
+
+// Info describes the processor wrapped by a probe.
+type Info struct {
+	Path  string
+	Label string
+	Type  string
+}
+
+// Hooks is implemented by types that wish to observe or intervene with batches
+// flowing through probed processors.
+type Hooks interface {
+	// Before is called with a batch before it reaches the wrapped processor.
+	// The returned batch is processed in place of the original. Returning an
+	// error drops the batch and propagates the error back to the input.
+	Before(info Info, msg types.Message) (types.Message, error)
+
+	// After is called with the result of the wrapped processor along with the
+	// time it took to process the batch.
+	After(info Info, msgs []types.Message, res types.Response, took time.Duration)
+}
+
+// PanicError is returned in the response of a probe when the wrapped processor
+// panics, and carries the stack trace of the panic.
+type PanicError struct {
+	Info  Info
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("processor '%v' (%v) panicked: %v", e.Info.Path, e.Info.Type, e.Value)
+}
+
+// Config contains the processor being wrapped by a probe. The hooks are not
+// serialisable and must therefore be set programmatically.
+type Config struct {
+	Path      string           `json:"path" yaml:"path"`
+	Processor processor.Config `json:"processor" yaml:"processor"`
+	Hooks     Hooks            `json:"-" yaml:"-"`
+}
+
+// NewConfig returns a Config with default values.
+func NewConfig() *Config {
+	return &Config{
+		Processor: processor.NewConfig(),
+	}
+}
+
+// RegisterPlugin registers the probe processor as a plugin so that it can be
+// constructed from instrumented configs.
+func RegisterPlugin() {
+	processor.RegisterPlugin(
+		TypeProbe,
+		func() interface{} {
+			return NewConfig()
+		},
+		func(conf interface{}, mgr types.Manager, logger log.Modular, stats metrics.Type) (types.Processor, error) {
+			return New(conf.(*Config), mgr, logger, stats)
+		},
+	)
+	processor.DocumentPlugin(TypeProbe, "", func(conf interface{}) interface{} { return nil })
+}
+
+//------------------------------------------------------------------------------
+
+// Instrument wraps every processor of a config, including those nested within
+// other components, with a probe that calls hooks.
+func Instrument(conf *config.Type, hooks Hooks) {
+	labConfig.WalkProcessors(conf, func(path string, procs *[]processor.Config) {
+		for i, p := range *procs {
+			wrapped := wrap(labConfig.IndexPath(path, i), p, hooks)
+			if path == "processor_resources" {
+				// Resources are registered by label.
+				wrapped.Label = p.Label
+			}
+			(*procs)[i] = wrapped
+		}
+	})
+
+	// Resources of the old style are registered by their key, which is kept.
+	for k, p := range conf.Manager.Processors {
+		conf.Manager.Processors[k] = wrap("resources.processors."+k, p, hooks)
+	}
+}
+
+func wrap(path string, conf processor.Config, hooks Hooks) processor.Config {
+	probeConf := NewConfig()
+	probeConf.Path = path
+	probeConf.Processor = conf
+	probeConf.Hooks = hooks
+
+	wrapped := processor.NewConfig()
+	wrapped.Type = TypeProbe
+	wrapped.Plugin = probeConf
+	return wrapped
+}
+
+//------------------------------------------------------------------------------
+
+// Processor is a processor that wraps another in order to expose the batches
+// flowing through it to hooks.
+type Processor struct {
+	info  Info
+	child types.Processor
+	hooks Hooks
+}
+
+// New creates a probe processor from a Config.
+func New(conf *Config, mgr types.Manager, log log.Modular, stats metrics.Type) (*Processor, error) {
+	child, err := processor.New(conf.Processor, mgr, log, stats)
+	if err != nil {
+		return nil, err
+	}
+	return &Processor{
+		info: Info{
+			Path:  conf.Path,
+			Label: conf.Processor.Label,
+			Type:  conf.Processor.Type,
+		},
+		child: child,
+		hooks: conf.Hooks,
+	}, nil
+}
+
+// ProcessMessage passes a batch through the hooks and the wrapped processor.
+// Panics from the wrapped processor are recovered and returned as a
+// PanicError.
+func (p *Processor) ProcessMessage(msg types.Message) (msgs []types.Message, res types.Response) {
+	if p.hooks == nil {
+		return p.processChild(msg)
+	}
+
+	var err error
+	if msg, err = p.hooks.Before(p.info, msg); err != nil {
+		return nil, response.NewError(err)
+	}
+
+	start := time.Now()
+	msgs, res = p.processChild(msg)
+	p.hooks.After(p.info, msgs, res, time.Since(start))
+	return msgs, res
+}
+
+func (p *Processor) processChild(msg types.Message) (msgs []types.Message, res types.Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			msgs, res = nil, response.NewError(&PanicError{
+				Info:  p.info,
+				Value: r,
+				Stack: debug.Stack(),
+			})
+		}
+	}()
+	return p.child.ProcessMessage(msg)
+}
+
+// CloseAsync shuts down the wrapped processor.
+func (p *Processor) CloseAsync() {
+	p.child.CloseAsync()
+}
+
+// WaitForClose blocks until the wrapped processor has closed down.
+func (p *Processor) WaitForClose(timeout time.Duration) error {
+	return p.child.WaitForClose(timeout)
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,258 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package probe
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/log"
+	"github.com/Jeffail/benthos/v3/lib/message"
+	"github.com/Jeffail/benthos/v3/lib/metrics"
+	"github.com/Jeffail/benthos/v3/lib/processor"
+	"github.com/Jeffail/benthos/v3/lib/types"
+	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+)
+
+type fnHooks struct {
+	before func(Info, types.Message) (types.Message, error)
+	after  func(Info, []types.Message, types.Response, time.Duration)
+}
+
+func (f fnHooks) Before(info Info, msg types.Message) (types.Message, error) {
+	return f.before(info, msg)
+}
+
+func (f fnHooks) After(info Info, msgs []types.Message, res types.Response, took time.Duration) {
+	f.after(info, msgs, res, took)
+}
+
+func TestProbeProcessor(t *testing.T) {
+	var befores, afters []Info
+	var results []types.Message
+
+	conf := NewConfig()
+	conf.Path = "pipeline.processors.0"
+	conf.Processor.Label = "foo"
+	conf.Processor.Type = processor.TypeBloblang
+	conf.Processor.Bloblang = `root = content().uppercase()`
+	conf.Hooks = fnHooks{
+		before: func(info Info, msg types.Message) (types.Message, error) {
+			befores = append(befores, info)
+			msg.Get(0).Set([]byte("replaced"))
+			return msg, nil
+		},
+		after: func(info Info, msgs []types.Message, res types.Response, took time.Duration) {
+			afters = append(afters, info)
+			results = msgs
+		},
+	}
+
+	proc, err := New(conf, types.NoopMgr(), log.Noop(), metrics.Noop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, res := proc.ProcessMessage(message.New([][]byte{[]byte("hello")}))
+	if res != nil {
+		t.Fatal(res.Error())
+	}
+	if exp, act := [][]byte{[]byte("REPLACED")}, message.GetAllBytes(msgs[0]); !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong result: %s != %s", act, exp)
+	}
+
+	expInfo := []Info{{Path: "pipeline.processors.0", Label: "foo", Type: "bloblang"}}
+	if !reflect.DeepEqual(expInfo, befores) {
+		t.Errorf("Wrong before calls: %v != %v", befores, expInfo)
+	}
+	if !reflect.DeepEqual(expInfo, afters) {
+		t.Errorf("Wrong after calls: %v != %v", afters, expInfo)
+	}
+	if !reflect.DeepEqual(msgs, results) {
+		t.Errorf("Wrong results given to hooks: %v != %v", results, msgs)
+	}
+
+	proc.CloseAsync()
+	if err = proc.WaitForClose(time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProbeProcessorBeforeError(t *testing.T) {
+	errTest := errors.New("test err")
+
+	conf := NewConfig()
+	conf.Processor.Type = processor.TypeNoop
+	conf.Hooks = fnHooks{
+		before: func(info Info, msg types.Message) (types.Message, error) {
+			return nil, errTest
+		},
+		after: func(info Info, msgs []types.Message, res types.Response, took time.Duration) {
+			t.Error("Unexpected after call")
+		},
+	}
+
+	proc, err := New(conf, types.NoopMgr(), log.Noop(), metrics.Noop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, res := proc.ProcessMessage(message.New([][]byte{[]byte("hello")}))
+	if len(msgs) > 0 {
+		t.Errorf("Unexpected messages: %v", msgs)
+	}
+	if res == nil || res.Error() != errTest {
+		t.Errorf("Wrong response: %v", res)
+	}
+}
+
+type panicProc struct{}
+
+func (panicProc) ProcessMessage(types.Message) ([]types.Message, types.Response) {
+	panic("boom")
+}
+
+func (panicProc) CloseAsync() {}
+
+func (panicProc) WaitForClose(time.Duration) error { return nil }
+
+func TestProbeProcessorPanic(t *testing.T) {
+	processor.RegisterPlugin(
+		"benthos_lab_test_panic",
+		func() interface{} {
+			s := struct{}{}
+			return &s
+		},
+		func(interface{}, types.Manager, log.Modular, metrics.Type) (types.Processor, error) {
+			return panicProc{}, nil
+		},
+	)
+
+	var afters int
+	conf := NewConfig()
+	conf.Path = "pipeline.processors.2"
+	conf.Processor.Type = "benthos_lab_test_panic"
+	conf.Hooks = fnHooks{
+		before: func(info Info, msg types.Message) (types.Message, error) {
+			return msg, nil
+		},
+		after: func(info Info, msgs []types.Message, res types.Response, took time.Duration) {
+			afters++
+		},
+	}
+
+	proc, err := New(conf, types.NoopMgr(), log.Noop(), metrics.Noop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, res := proc.ProcessMessage(message.New([][]byte{[]byte("hello")}))
+	if len(msgs) > 0 {
+		t.Errorf("Unexpected messages: %v", msgs)
+	}
+	if res == nil {
+		t.Fatal("Expected a response")
+	}
+	perr, ok := res.Error().(*PanicError)
+	if !ok {
+		t.Fatalf("Wrong error type: %T", res.Error())
+	}
+	if exp, act := "pipeline.processors.2", perr.Info.Path; exp != act {
+		t.Errorf("Wrong path: %v != %v", act, exp)
+	}
+	if exp, act := "boom", perr.Value; exp != act {
+		t.Errorf("Wrong value: %v != %v", act, exp)
+	}
+	if len(perr.Stack) == 0 {
+		t.Error("Expected a stack trace")
+	}
+	if afters != 1 {
+		t.Errorf("Wrong count of after calls: %v", afters)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	conf, err := labConfig.Unmarshal(`
+pipeline:
+  processors:
+  - label: foo
+    switch:
+    - processors:
+      - noop: {}
+processor_resources:
+- label: bar
+  noop: {}
+resources:
+  processors:
+    baz:
+      catch:
+      - noop: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Instrument(&conf, nil)
+
+	outer := conf.Pipeline.Processors[0]
+	if exp, act := TypeProbe, outer.Type; exp != act {
+		t.Fatalf("Wrong type: %v != %v", act, exp)
+	}
+	outerConf := outer.Plugin.(*Config)
+	if exp, act := "pipeline.processors.0", outerConf.Path; exp != act {
+		t.Errorf("Wrong path: %v != %v", act, exp)
+	}
+	if exp, act := "foo", outerConf.Processor.Label; exp != act {
+		t.Errorf("Wrong label: %v != %v", act, exp)
+	}
+
+	inner := outerConf.Processor.Switch[0].Processors[0]
+	if exp, act := TypeProbe, inner.Type; exp != act {
+		t.Fatalf("Wrong type: %v != %v", act, exp)
+	}
+	if exp, act := "pipeline.processors.0.switch.0.processors.0", inner.Plugin.(*Config).Path; exp != act {
+		t.Errorf("Wrong path: %v != %v", act, exp)
+	}
+
+	if exp, act := "bar", conf.ResourceProcessors[0].Label; exp != act {
+		t.Errorf("Wrong resource label: %v != %v", act, exp)
+	}
+
+	res, exists := conf.Manager.Processors["baz"]
+	if !exists {
+		t.Fatal("Resource processor baz missing")
+	}
+	if exp, act := TypeProbe, res.Type; exp != act {
+		t.Fatalf("Wrong resource type: %v != %v", act, exp)
+	}
+	resConf := res.Plugin.(*Config)
+	if exp, act := "resources.processors.baz", resConf.Path; exp != act {
+		t.Errorf("Wrong resource path: %v != %v", act, exp)
+	}
+	if exp, act := TypeProbe, resConf.Processor.Catch[0].Type; exp != act {
+		t.Errorf("Wrong nested resource type: %v != %v", act, exp)
+	}
+	if exp, act := "resources.processors.baz.catch.0", resConf.Processor.Catch[0].Plugin.(*Config).Path; exp != act {
+		t.Errorf("Wrong nested resource path: %v != %v", act, exp)
+	}
+}
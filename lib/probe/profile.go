@@ -0,0 +1,153 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package probe
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/benthos/v3/lib/types"
+)
+
+//------------------------------------------------------------------------------
+
+// ProcessorStats summarises the latency of a processor across all of the
+// batches it processed while profiling.
+type ProcessorStats struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"`
+	Label string `json:"label,omitempty"`
+
+	Calls int           `json:"calls"`
+	Total time.Duration `json:"total"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+type profileSamples struct {
+	info      Info
+	durations []time.Duration
+}
+
+// Profiler is a Hooks implementation that records the time taken by each
+// probed processor to process a batch. Since probes wrap processors that are
+// themselves nested the latency of a parent includes that of its children.
+type Profiler struct {
+	enabled bool
+	samples map[string]*profileSamples
+
+	sync.Mutex
+}
+
+// NewProfiler creates a disabled profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		samples: map[string]*profileSamples{},
+	}
+}
+
+// Enable or disable profiling.
+func (p *Profiler) Enable(enabled bool) {
+	p.Lock()
+	p.enabled = enabled
+	p.Unlock()
+}
+
+// Reset clears all recorded samples.
+func (p *Profiler) Reset() {
+	p.Lock()
+	p.samples = map[string]*profileSamples{}
+	p.Unlock()
+}
+
+// Before is a noop.
+func (p *Profiler) Before(info Info, msg types.Message) (types.Message, error) {
+	return msg, nil
+}
+
+// After records the time taken by a processor.
+func (p *Profiler) After(info Info, msgs []types.Message, res types.Response, took time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.enabled {
+		return
+	}
+	s, exists := p.samples[info.Path]
+	if !exists {
+		s = &profileSamples{info: info}
+		p.samples[info.Path] = s
+	}
+	s.durations = append(s.durations, took)
+}
+
+// Stats returns a summary of the recorded samples of each processor sorted by
+// path.
+func (p *Profiler) Stats() []ProcessorStats {
+	p.Lock()
+	defer p.Unlock()
+
+	stats := make([]ProcessorStats, 0, len(p.samples))
+	for _, s := range p.samples {
+		durations := make([]time.Duration, len(s.durations))
+		copy(durations, s.durations)
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+		stats = append(stats, ProcessorStats{
+			Path:  s.info.Path,
+			Type:  s.info.Type,
+			Label: s.info.Label,
+			Calls: len(durations),
+			Total: total,
+			Mean:  total / time.Duration(len(durations)),
+			P50:   percentile(durations, 0.5),
+			P99:   percentile(durations, 0.99),
+			Max:   durations[len(durations)-1],
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Path < stats[j].Path
+	})
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+//------------------------------------------------------------------------------
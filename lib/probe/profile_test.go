@@ -0,0 +1,98 @@
+// Copyright (c) 2019 Ashley Jeffs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package probe
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProfiler(t *testing.T) {
+	p := NewProfiler()
+
+	info := Info{Path: "pipeline.processors.0", Type: "bloblang"}
+	p.After(info, nil, nil, time.Second)
+	if stats := p.Stats(); len(stats) > 0 {
+		t.Errorf("Unexpected stats while disabled: %v", stats)
+	}
+
+	p.Enable(true)
+	for i := 100; i > 0; i-- {
+		p.After(info, nil, nil, time.Duration(i)*time.Millisecond)
+	}
+	p.After(Info{Path: "pipeline.processors.1", Type: "noop"}, nil, nil, time.Millisecond)
+
+	exp := []ProcessorStats{
+		{
+			Path:  "pipeline.processors.0",
+			Type:  "bloblang",
+			Calls: 100,
+			Total: 5050 * time.Millisecond,
+			Mean:  50500 * time.Microsecond,
+			P50:   50 * time.Millisecond,
+			P99:   99 * time.Millisecond,
+			Max:   100 * time.Millisecond,
+		},
+		{
+			Path:  "pipeline.processors.1",
+			Type:  "noop",
+			Calls: 1,
+			Total: time.Millisecond,
+			Mean:  time.Millisecond,
+			P50:   time.Millisecond,
+			P99:   time.Millisecond,
+			Max:   time.Millisecond,
+		},
+	}
+	if act := p.Stats(); !reflect.DeepEqual(exp, act) {
+		t.Errorf("Wrong stats: %+v != %+v", act, exp)
+	}
+
+	p.Reset()
+	if stats := p.Stats(); len(stats) > 0 {
+		t.Errorf("Unexpected stats after reset: %v", stats)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 10)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+	tests := []struct {
+		q   float64
+		exp time.Duration
+	}{
+		{q: 0, exp: 1},
+		{q: 0.1, exp: 1},
+		{q: 0.5, exp: 5},
+		{q: 0.50000005, exp: 6},
+		{q: 0.99, exp: 10},
+		{q: 1, exp: 10},
+		{q: 1.5, exp: 10},
+	}
+	for _, test := range tests {
+		if act := percentile(sorted, test.q); act != test.exp {
+			t.Errorf("Wrong percentile %v: %v != %v", test.q, act, test.exp)
+		}
+	}
+}
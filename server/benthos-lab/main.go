@@ -25,6 +25,7 @@ import (
 	"github.com/Jeffail/benthos/v3/lib/ratelimit"
 	"github.com/Jeffail/benthos/v3/lib/types"
 	labConfig "github.com/benthosdev/benthos-lab/lib/config"
+	"github.com/benthosdev/benthos-lab/lib/httpmock"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 )
@@ -154,6 +155,25 @@ func shareHash(content []byte) []byte {
 	return hashBytes[:hashLen]
 }
 
+// dataset is a named input of a shared session along with the method used to
+// read it, and optionally the name of the benthos_lab input it targets.
+type dataset struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Input  string `json:"input"`
+	Target string `json:"target,omitempty"`
+}
+
+// fixture is a file of a shared session that is seeded into the filesystem of
+// the runtime, binary content is stored as base64.
+type fixture struct {
+	Path    string `json:"path"`
+	Content string `json:"content,omitempty"`
+	Base64  string `json:"base64,omitempty"`
+}
+
+//------------------------------------------------------------------------------
+
 func main() {
 	cacheConf := cache.NewConfig()
 	ratelimitConf := ratelimit.NewConfig()
@@ -257,6 +277,10 @@ func main() {
 	mWASMGetNoGZIP := httpStats.GetCounter("wasm.no_gzip")
 	mHTTPNormaliseSucc := stats.GetCounter("usage.normalise_http.success")
 	mHTTPNormaliseFail := stats.GetCounter("usage.normalise_http.failed")
+	mHTTPGraphSucc := stats.GetCounter("usage.graph_http.success")
+	mHTTPGraphFail := stats.GetCounter("usage.graph_http.failed")
+	mHTTPMigrateSucc := stats.GetCounter("usage.migrate_http.success")
+	mHTTPMigrateFail := stats.GetCounter("usage.migrate_http.failed")
 	mShareSucc := stats.GetCounter("usage.share.success")
 	mShareFail := stats.GetCounter("usage.share.failed")
 	mActivity := stats.GetCounter("usage.activity")
@@ -399,6 +423,15 @@ func main() {
 		}
 		defer r.Body.Close()
 
+		query := r.URL.Query()
+		nConf, err := labConfig.ParseNormaliseConfig(query.Get("mode"), query.Get("deprecated"), query.Get("format"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Warnf("Bad normalise options: %v\n", err)
+			mHTTPNormaliseFail.Incr(1)
+			return
+		}
+
 		var conf config.Type
 		if conf, err = labConfig.Unmarshal(string(reqBody)); err != nil {
 			http.Error(w, "Failed to parse body", http.StatusBadRequest)
@@ -408,7 +441,7 @@ func main() {
 		}
 
 		var resBytes []byte
-		if resBytes, err = labConfig.Marshal(conf); err != nil {
+		if resBytes, err = labConfig.MarshalWithConfig(conf, nConf); err != nil {
 			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
 			log.Errorf("Failed to marshal response body: %v\n", err)
 			mHTTPNormaliseFail.Incr(1)
@@ -416,6 +449,162 @@ func main() {
 		}
 
 		mHTTPNormaliseSucc.Incr(1)
+		if nConf.Format == labConfig.FormatJSON {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write(resBytes)
+	})
+
+	mux.HandleFunc("/graph", func(w http.ResponseWriter, r *http.Request) {
+		mActivity.Incr(1)
+		if r.Method != "POST" {
+			http.Error(w, "Method not supported", http.StatusBadRequest)
+			log.Warnf("Bad method: %v\n", r.Method)
+			mHTTPGraphFail.Incr(1)
+			return
+		}
+		reqBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			log.Errorf("Failed to read request body: %v\n", err)
+			mHTTPGraphFail.Incr(1)
+			return
+		}
+		defer r.Body.Close()
+
+		format, err := labConfig.ParseGraphFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Warnf("Bad graph options: %v\n", err)
+			mHTTPGraphFail.Incr(1)
+			return
+		}
+
+		graph, err := labConfig.ConfigGraph(string(reqBody))
+		if err != nil {
+			http.Error(w, "Failed to parse body", http.StatusBadRequest)
+			log.Errorf("Failed to parse request body: %v\n", err)
+			mHTTPGraphFail.Incr(1)
+			return
+		}
+
+		var resBytes []byte
+		if resBytes, err = labConfig.MarshalGraph(graph, format); err != nil {
+			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+			log.Errorf("Failed to marshal response body: %v\n", err)
+			mHTTPGraphFail.Incr(1)
+			return
+		}
+
+		mHTTPGraphSucc.Incr(1)
+		if format == labConfig.GraphJSON {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		w.Write(resBytes)
+	})
+
+	// Migrates either the config of a POST body, or the config of a shared
+	// session given by the id of a GET query, to the syntax of Benthos v4.
+	mux.HandleFunc("/api/migrate", func(w http.ResponseWriter, r *http.Request) {
+		mActivity.Incr(1)
+		var confStr string
+		switch r.Method {
+		case "POST":
+			reqBody, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read body", http.StatusBadRequest)
+				log.Errorf("Failed to read request body: %v\n", err)
+				mHTTPMigrateFail.Incr(1)
+				return
+			}
+			defer r.Body.Close()
+			confStr = string(reqBody)
+		case "GET":
+			id := r.URL.Query().Get("id")
+			if len(id) == 0 {
+				http.Error(w, "Session id required", http.StatusBadRequest)
+				log.Warnf("Bad migrate id: %v\n", id)
+				mHTTPMigrateFail.Incr(1)
+				return
+			}
+
+			for {
+				tout, err := rlimit.Access()
+				if err != nil {
+					http.Error(w, "Server failed", http.StatusBadGateway)
+					log.Errorf("Failed to access rate limit: %v\n", err)
+					mHTTPMigrateFail.Incr(1)
+					return
+				}
+				if tout == 0 {
+					break
+				}
+				select {
+				case <-time.After(tout):
+				case <-r.Context().Done():
+					http.Error(w, "Timed out", http.StatusRequestTimeout)
+					mHTTPMigrateFail.Incr(1)
+					return
+				}
+			}
+
+			stateBody, err := cache.Get(id)
+			if err != nil {
+				if err == types.ErrKeyNotFound {
+					http.Error(w, "Session not found", http.StatusNotFound)
+				} else {
+					http.Error(w, "Server failed", http.StatusBadGateway)
+					log.Errorf("Failed to read state: %v\n", err)
+				}
+				mHTTPMigrateFail.Incr(1)
+				return
+			}
+			var state struct {
+				Config string `json:"config"`
+			}
+			if err = json.Unmarshal(stateBody, &state); err != nil {
+				http.Error(w, "Server failed", http.StatusBadGateway)
+				log.Errorf("Failed to parse state: %v\n", err)
+				mHTTPMigrateFail.Incr(1)
+				return
+			}
+			confStr = state.Config
+		default:
+			http.Error(w, "Method not supported", http.StatusBadRequest)
+			log.Warnf("Bad method: %v\n", r.Method)
+			mHTTPMigrateFail.Incr(1)
+			return
+		}
+
+		migrated, followUps, err := labConfig.MigrateConfigV4(confStr)
+		if err != nil {
+			http.Error(w, "Failed to parse config", http.StatusBadRequest)
+			log.Errorf("Failed to parse config: %v\n", err)
+			mHTTPMigrateFail.Incr(1)
+			return
+		}
+		if followUps == nil {
+			followUps = []labConfig.FollowUp{}
+		}
+
+		resBytes, err := json.Marshal(struct {
+			Config    string               `json:"config"`
+			FollowUps []labConfig.FollowUp `json:"follow_ups"`
+		}{
+			Config:    migrated,
+			FollowUps: followUps,
+		})
+		if err != nil {
+			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+			log.Errorf("Failed to marshal response body: %v\n", err)
+			mHTTPMigrateFail.Incr(1)
+			return
+		}
+
+		mHTTPMigrateSucc.Incr(1)
+		w.Header().Set("Content-Type", "application/json")
 		w.Write(resBytes)
 	})
 
@@ -437,9 +626,13 @@ func main() {
 		defer r.Body.Close()
 
 		state := struct {
-			Config   string            `json:"config"`
-			Input    string            `json:"input"`
-			Settings map[string]string `json:"settings"`
+			Config    string            `json:"config"`
+			Input     string            `json:"input"`
+			Datasets  []dataset         `json:"datasets,omitempty"`
+			HTTPMocks []httpmock.Rule   `json:"http_mocks,omitempty"`
+			Files     []fixture         `json:"files,omitempty"`
+			Env       map[string]string `json:"env,omitempty"`
+			Settings  map[string]string `json:"settings"`
 		}{
 			Settings: map[string]string{},
 		}